@@ -17,6 +17,7 @@ func (pt *protoTree) doAnalyze(currentIndex, finalIndex int) {
 		}
 
 		line := pt.lineList[currentIndex]
+		pt.pos = line.pos
 
 		switch {
 		case line.accept("%.#"):
@@ -25,6 +26,9 @@ func (pt *protoTree) doAnalyze(currentIndex, finalIndex int) {
 		case line.accept("=-"):
 			currentIndex = pt.actionableLine(currentIndex, finalIndex)
 			continue
+		case line.accept("+"):
+			currentIndex = pt.componentLine(currentIndex, finalIndex)
+			continue
 		case line.accept(":"):
 			for _, handler := range Filters {
 				if line.content == handler.Trigger {
@@ -32,7 +36,7 @@ func (pt *protoTree) doAnalyze(currentIndex, finalIndex int) {
 					return
 				}
 			}
-			pt.err = fmt.Errorf("Bad handler: %s", line.content)
+			pt.err = pt.errorAt(line.pos, fmt.Errorf("Bad handler: %s", line.content))
 			return
 		case line.prefix("!!!"):
 			pt.insertDoctype(line)
@@ -49,7 +53,7 @@ func (pt *protoTree) insertDoctype(line templateLine) {
 	if ok {
 		pt.insertRaw(doctype, line.indentation)
 	} else {
-		pt.err = fmt.Errorf("Bad doctype, details: '%s'", line.content)
+		pt.err = pt.errorAt(line.pos, fmt.Errorf("Bad doctype, details: '%s'", line.content))
 	}
 }
 
@@ -105,6 +109,7 @@ func (pt *protoTree) actionableLine(startIndex, finalIndex int) int {
 			}
 		}
 		pt.currNodes = parentNodes
+		pt.pos = pt.lineList[startIndex].pos
 		switch {
 		case pt.lineList[startIndex].isIf():
 			pt.insertIf(
@@ -144,12 +149,43 @@ func (pt *protoTree) actionableLine(startIndex, finalIndex int) int {
 	return currentIndex
 }
 
+// componentLine calls a component for a +name line, or fills in a slot
+// for a +:name line, with the lines nested in it as the content.
+func (pt *protoTree) componentLine(startIndex, finalIndex int) int {
+	line := pt.lineList[startIndex]
+	endIndex := startIndex + 1
+	for endIndex <= finalIndex && line.indentation < pt.lineList[endIndex].indentation {
+		endIndex++
+	}
+
+	var opening, closing string
+	if line.prefix("+:") {
+		opening = fmt.Sprintf("slot %q", strings.TrimSpace(line.content[2:]))
+		closing = "end_slot"
+	} else {
+		code := strings.TrimSpace(line.content[1:])
+		name, args := code, "."
+		if i := strings.IndexAny(code, " \t"); i >= 0 {
+			name, args = code[:i], strings.TrimSpace(code[i:])
+		}
+		opening = fmt.Sprintf("component %q %s", name, args)
+		closing = "end_component"
+	}
+
+	pt.insertExecutable(opening, line.indentation)
+	pt.doAnalyze(startIndex+1, endIndex-1)
+	pt.pos = line.pos
+	pt.insertExecutable(closing, line.indentation)
+	return endIndex
+}
+
 func (pt *protoTree) tagLike(currentIndex, finalIndex int) int {
 	if finalIndex == currentIndex || pt.lineList[currentIndex+1].indentation <= pt.lineList[currentIndex].indentation {
 		pt.currNodes = append(pt.currNodes, protoNode{
 			level:      pt.lineList[currentIndex].indentation,
 			identifier: identTag,
 			content:    pt.lineList[currentIndex].content,
+			pos:        pt.lineList[currentIndex].pos,
 		})
 		return currentIndex + 1
 	} else {
@@ -157,6 +193,7 @@ func (pt *protoTree) tagLike(currentIndex, finalIndex int) int {
 			level:      pt.lineList[currentIndex].indentation,
 			identifier: identTagOpen,
 			content:    pt.lineList[currentIndex].content,
+			pos:        pt.lineList[currentIndex].pos,
 		})
 		tagIndex := currentIndex + 1
 		for tagIndex < finalIndex && pt.lineList[tagIndex].indentation > pt.lineList[currentIndex].indentation {
@@ -170,6 +207,7 @@ func (pt *protoTree) tagLike(currentIndex, finalIndex int) int {
 			level:      pt.lineList[currentIndex].indentation,
 			identifier: identTagClose,
 			content:    pt.lineList[currentIndex].content,
+			pos:        pt.lineList[currentIndex].pos,
 		})
 		return tagIndex + 1
 	}
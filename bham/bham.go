@@ -55,6 +55,13 @@ type protoTree struct {
 	err        error
 	funcs      template.FuncMap
 	prelude    string
+	// pos of the line being analyzed
+	pos int
+}
+
+// errorAt locates err at pos in the source of the template.
+func (pt *protoTree) errorAt(pos int, err error) error {
+	return multitemplate.NewError(pt.source, pos, err)
 }
 
 type protoNode struct {
@@ -64,6 +71,7 @@ type protoNode struct {
 	filter     FilterHandler
 	list       []protoNode
 	elseList   []protoNode
+	pos        int
 }
 
 func (pn protoNode) needsRuntimeData() bool {
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"strings"
 	"text/template/parse"
+
+	"github.com/acsellers/multitemplate"
 )
 
 func (pt *protoTree) compile() {
@@ -13,13 +15,15 @@ func (pt *protoTree) compile() {
 		cleanName = pt.name[:i] + pt.name[i+5:]
 	}
 
-	pt.outputTree = newTree(pt.name, cleanName)
+	pt.outputTree = multitemplate.NewTree(cleanName, pt.source)
+	pt.outputTree.ParseName = pt.name
 
 	pt.compileToList(pt.outputTree.Root, pt.nodes)
 }
 
 func (pt *protoTree) compileToList(arr *parse.ListNode, nodes []protoNode) {
 	for _, node := range nodes {
+		start := len(arr.Nodes)
 		switch node.identifier {
 		case identRaw:
 			arr.Nodes = append(arr.Nodes, newTextNode(node.content))
@@ -30,21 +34,21 @@ func (pt *protoTree) compileToList(arr *parse.ListNode, nodes []protoNode) {
 				arr.Nodes = append(arr.Nodes, newTextNode(content))
 			}
 		case identExecutable:
-			node, err := pt.parseTemplateCode(node.content)
+			pipe, err := pt.parseTemplateCode(node.content)
 			if err == nil {
 				arr.Nodes = append(arr.Nodes, &parse.ActionNode{
 					NodeType: parse.NodeAction,
-					Pipe:     node,
+					Pipe:     pipe,
 				})
 			} else {
-				pt.err = err
+				pt.err = pt.errorAt(node.pos, err)
 			}
 		case identTag:
 			nodes, err := pt.newStandaloneTag(node.content)
 			if err == nil {
 				arr.Nodes = append(arr.Nodes, nodes...)
 			} else {
-				pt.err = err
+				pt.err = pt.errorAt(node.pos, err)
 			}
 		case identTagOpen:
 			td, c, err := pt.parseTag(node.content)
@@ -58,14 +62,14 @@ func (pt *protoTree) compileToList(arr *parse.ListNode, nodes []protoNode) {
 					arr.Nodes = append(arr.Nodes, pt.newMaybeTextNode(c)...)
 				}
 			} else {
-				pt.err = err
+				pt.err = pt.errorAt(node.pos, err)
 			}
 		case identTagClose:
 			td, _, err := pt.parseTag(node.content)
 			if err == nil {
 				arr.Nodes = append(arr.Nodes, newTextNode(td.Close()))
 			} else {
-				pt.err = err
+				pt.err = pt.errorAt(node.pos, err)
 			}
 		case identText:
 			arr.Nodes = append(arr.Nodes, pt.newMaybeTextNode(node.content)...)
@@ -75,7 +79,8 @@ func (pt *protoTree) compileToList(arr *parse.ListNode, nodes []protoNode) {
 				in := &parse.IfNode{
 					parse.BranchNode{
 						NodeType: parse.NodeIf,
-						Pipe:     branching,
+						Pos:      parse.Pos(node.pos),
+						Pipe:     pt.relocatePipe(branching, node.pos),
 						List: &parse.ListNode{
 							NodeType: parse.NodeList,
 						},
@@ -92,7 +97,7 @@ func (pt *protoTree) compileToList(arr *parse.ListNode, nodes []protoNode) {
 				}
 				arr.Nodes = append(arr.Nodes, in)
 			} else {
-				pt.err = err
+				pt.err = pt.errorAt(node.pos, err)
 			}
 
 		case identRange:
@@ -101,7 +106,8 @@ func (pt *protoTree) compileToList(arr *parse.ListNode, nodes []protoNode) {
 				in := &parse.RangeNode{
 					parse.BranchNode{
 						NodeType: parse.NodeIf,
-						Pipe:     branching,
+						Pos:      parse.Pos(node.pos),
+						Pipe:     pt.relocatePipe(branching, node.pos),
 						List: &parse.ListNode{
 							NodeType: parse.NodeList,
 						},
@@ -118,7 +124,7 @@ func (pt *protoTree) compileToList(arr *parse.ListNode, nodes []protoNode) {
 				}
 				arr.Nodes = append(arr.Nodes, in)
 			} else {
-				pt.err = err
+				pt.err = pt.errorAt(node.pos, err)
 			}
 
 		case identWith:
@@ -127,7 +133,8 @@ func (pt *protoTree) compileToList(arr *parse.ListNode, nodes []protoNode) {
 				wn := &parse.WithNode{
 					parse.BranchNode{
 						NodeType: parse.NodeWith,
-						Pipe:     branching,
+						Pos:      parse.Pos(node.pos),
+						Pipe:     pt.relocatePipe(branching, node.pos),
 						List: &parse.ListNode{
 							NodeType: parse.NodeList,
 						},
@@ -141,12 +148,27 @@ func (pt *protoTree) compileToList(arr *parse.ListNode, nodes []protoNode) {
 				}
 				arr.Nodes = append(arr.Nodes, wn)
 			} else {
-				pt.err = err
+				pt.err = pt.errorAt(node.pos, err)
 			}
 
 		default:
 			fmt.Println(node.identifier)
 			fmt.Println(node.content)
 		}
+
+		// branches position their own pipelines, their lists are
+		// already positioned by the nodes inside them
+		switch node.identifier {
+		case identIf, identRange, identWith:
+		default:
+			for i := start; i < len(arr.Nodes); i++ {
+				arr.Nodes[i] = multitemplate.Relocate(arr.Nodes[i], node.pos)
+			}
+		}
 	}
 }
+
+// relocatePipe moves a pipeline parsed from template code to pos.
+func (pt *protoTree) relocatePipe(pipe *parse.PipeNode, pos int) *parse.PipeNode {
+	return multitemplate.Relocate(pipe, pos).(*parse.PipeNode)
+}
@@ -122,6 +122,18 @@ Examples
     %email_list
       ...
 
+Components
+
+A line starting with + calls a component, with the lines nested in it as
+its content. The name of the component comes first, followed by its data,
+which is dot if it is left out. Nested lines starting with +: fill in a
+named slot of the component.
+
+  +cards/user.html .User
+    +:header
+      %h2 Profile
+    %p Details
+
 Examples
 
 This first example is a layout with a doctype, multiple yields and blocks,
@@ -11,10 +11,12 @@ func (pt *protoTree) lex() {
 	scanner := bufio.NewScanner(bytes.NewBufferString(pt.source))
 	var line, content string
 	var currentLevel, nowLevel int
-	var currentLine int
+	var currentLine, pos, nextPos int
 	for scanner.Scan() {
 		currentLine++
 		line = scanner.Text()
+		pos = nextPos
+		nextPos += len(line) + 1
 
 		if strings.TrimSpace(line) == "" {
 			continue
@@ -22,14 +24,15 @@ func (pt *protoTree) lex() {
 
 		nowLevel, content = level(line)
 		if currentLevel+1 >= nowLevel {
-			lineItem := templateLine{nowLevel, content}
+			lineItem := templateLine{nowLevel, content, pos + len(line) - len(content)}
 			tempLine := currentLine
 			for lineItem.needsContent() {
 				if scanner.Scan() {
 					tempLine++
+					nextPos += len(scanner.Text()) + 1
 					lineItem.content = lineItem.appendContent(scanner.Text())
 				} else {
-					pt.err = fmt.Errorf("Line %d is not completed", currentLine)
+					pt.err = pt.errorAt(lineItem.pos, fmt.Errorf("Line %d is not completed", currentLine))
 					return
 				}
 			}
@@ -37,7 +40,7 @@ func (pt *protoTree) lex() {
 			pt.lineList = append(pt.lineList, lineItem)
 			currentLevel = nowLevel
 		} else {
-			pt.err = fmt.Errorf("Line %d is overindented", currentLine)
+			pt.err = pt.errorAt(pos, fmt.Errorf("Line %d is overindented", currentLine))
 			return
 		}
 	}
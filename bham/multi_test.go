@@ -2,7 +2,9 @@ package bham
 
 import (
 	"bytes"
+	"errors"
 	"html/template"
+	"reflect"
 	"testing"
 
 	. "github.com/acsellers/assert"
@@ -48,3 +50,76 @@ var simpleTest = templateTest{
 		"stdlib": "<b>Test</b>",
 	},
 }
+
+func TestErrorPosition(tst *testing.T) {
+	Within(tst, func(test *Test) {
+		_, e := multitemplate.New("errors").Parse("errors", "%html\n  %body\n    :unknown\n      text", "bham")
+		me, ok := e.(*multitemplate.Error)
+		test.AreEqual(true, ok)
+		test.AreEqual("bham", me.Parser)
+		test.AreEqual(3, me.Line)
+		test.AreEqual(5, me.Column)
+
+		t, e := multitemplate.New("errors").Parse("exec", "%html\n  %body\n    = index .List 3", "bham")
+		test.NoError(e)
+		e = t.ExecuteTemplate(&bytes.Buffer{}, "exec", map[string][]string{"List": {"a"}})
+		me, ok = e.(*multitemplate.Error)
+		test.AreEqual(true, ok)
+		test.AreEqual(3, me.Line)
+		test.AreEqual("    = index .List 3", me.Excerpt)
+	})
+}
+
+func TestDecompile(tst *testing.T) {
+	Within(tst, func(test *Test) {
+		src := "%html\n\t%body\n\t\t= range .Wats\n\t\t\t%p= .\n\t\t= else\n\t\t\t%p no wat\n\t\t= if .Show\n\t\t\t#content.big\n\t\t\t\t= len .Wats"
+		t, e := multitemplate.New("bham").Parse("page", src, "bham")
+		test.IsNil(e)
+		out, e := t.Decompile("page")
+		test.IsNil(e)
+		d, e := multitemplate.New("tmpl").Parse("page", out, "tmpl")
+		test.IsNil(e)
+
+		data := map[string]interface{}{"Wats": []int{1, 2}, "Show": true}
+		expected, received := &bytes.Buffer{}, &bytes.Buffer{}
+		test.IsNil(t.ExecuteTemplate(expected, "page", data))
+		test.IsNil(d.ExecuteTemplate(received, "page", data))
+		test.AreEqual(expected.String(), received.String())
+	})
+}
+
+func TestTypeCheck(tst *testing.T) {
+	Within(tst, func(test *Test) {
+		t, e := multitemplate.New("bham").Parse("page", "%div\n  = range .Items\n    %p= .Nmae", "bham")
+		test.IsNil(e)
+		e = t.TypeCheck("page", reflect.TypeOf(struct{ Items []struct{ Name string } }{}))
+		var me *multitemplate.Error
+		test.AreEqual(true, errors.As(e, &me))
+		test.AreEqual(3, me.Line)
+		test.AreEqual("bham", me.Parser)
+	})
+}
+
+func TestRenderPartial(tst *testing.T) {
+	Within(tst, func(test *Test) {
+		t, e := multitemplate.New("bham").Parse("row", "%li= .Name", "bham")
+		test.IsNil(e)
+		t, e = t.Parse("list", "%ul\n  = render_collection \"row\" .", "bham")
+		test.IsNil(e)
+		b := &bytes.Buffer{}
+		test.IsNil(t.ExecuteTemplate(b, "list", []struct{ Name string }{{"Ann"}, {"Bo"}}))
+		test.AreEqual("<ul><li> Ann</li> <li> Bo</li> </ul>", b.String())
+	})
+}
+
+func TestComponent(tst *testing.T) {
+	Within(tst, func(test *Test) {
+		t, e := multitemplate.New("bham").Parse("card", ".card\n  = yield_slot \"header\"\n  = yield_slot", "bham")
+		test.IsNil(e)
+		t, e = t.Parse("page", "+card\n  +:header\n    %h2 Head\n  %p Body", "bham")
+		test.IsNil(e)
+		b := &bytes.Buffer{}
+		test.IsNil(t.ExecuteTemplate(b, "page", nil))
+		test.AreEqual(`<div class="card"><h2>  Head </h2> <p>  Body </p> </div>`, b.String())
+	})
+}
@@ -18,6 +18,7 @@ func (pt *protoTree) insertRaw(content string, level int) {
 		level:      level,
 		identifier: identRaw,
 		content:    content,
+		pos:        pt.pos,
 	})
 }
 
@@ -27,6 +28,7 @@ func (pt *protoTree) insertFilter(content string, level int, handler FilterHandl
 		identifier: identFilter,
 		content:    content,
 		filter:     handler,
+		pos:        pt.pos,
 	})
 }
 
@@ -35,6 +37,7 @@ func (pt *protoTree) insertText(line templateLine) {
 		level:      line.indentation,
 		identifier: identText,
 		content:    line.content,
+		pos:        pt.pos,
 	})
 }
 
@@ -45,6 +48,7 @@ func (pt *protoTree) insertIf(statement string, level int, ifNodes, elseNodes []
 		content:    statement,
 		list:       ifNodes,
 		elseList:   elseNodes,
+		pos:        pt.pos,
 	})
 }
 func (pt *protoTree) insertRange(statement string, level int, rangeNodes, elseNodes []protoNode) {
@@ -54,6 +58,7 @@ func (pt *protoTree) insertRange(statement string, level int, rangeNodes, elseNo
 		content:    statement,
 		list:       rangeNodes,
 		elseList:   elseNodes,
+		pos:        pt.pos,
 	})
 }
 func (pt *protoTree) insertWith(statement string, level int, innerNodes []protoNode) {
@@ -62,6 +67,7 @@ func (pt *protoTree) insertWith(statement string, level int, innerNodes []protoN
 		identifier: identWith,
 		content:    statement,
 		list:       innerNodes,
+		pos:        pt.pos,
 	})
 }
 func (pt *protoTree) insertExecutable(statement string, level int) {
@@ -69,5 +75,6 @@ func (pt *protoTree) insertExecutable(statement string, level int) {
 		level:      level,
 		identifier: identExecutable,
 		content:    statement,
+		pos:        pt.pos,
 	})
 }
@@ -6,15 +6,6 @@ import (
 	"text/template/parse"
 )
 
-func newTree(source, name string) *parse.Tree {
-	return &parse.Tree{
-		Name:      name,
-		ParseName: source,
-		Root: &parse.ListNode{
-			NodeType: parse.NodeList,
-		},
-	}
-}
 func newTextNode(text string) parse.Node {
 	return &parse.TextNode{
 		NodeType: parse.NodeText,
@@ -7,6 +7,8 @@ import (
 type templateLine struct {
 	indentation int
 	content     string
+	// pos is where the content starts in the source
+	pos int
 }
 
 func (t templateLine) accept(chars string) bool {
@@ -31,6 +33,7 @@ func (t templateLine) after(str string) templateLine {
 		return templateLine{
 			t.indentation,
 			strings.TrimSpace(t.content[1:]),
+			t.pos,
 		}
 	}
 
@@ -42,6 +45,7 @@ func (t templateLine) without(str string) templateLine {
 		return templateLine{
 			t.indentation,
 			strings.TrimSpace(t.content[len(str):]),
+			t.pos,
 		}
 	}
 
@@ -0,0 +1,238 @@
+package multitemplate
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io"
+	"sort"
+	"strings"
+	textTmpl "text/template"
+	"text/template/parse"
+)
+
+// A Bundle holds a template set compiled ahead of time by WriteBundle, so
+// an application can load its templates without their source files, and
+// without running the parsers for the languages they were written in.
+// The templates are kept as the source Decompile gives for them.
+type Bundle struct {
+	// Funcs names the functions the templates call, the Template a Bundle
+	// is loaded into has to have all of them
+	Funcs []string
+	// Templates in the order they were parsed
+	Templates []BundledTemplate
+
+	trees []map[string]*parse.Tree
+}
+
+// A BundledTemplate is a template and the templates defined in its
+// source, in standard Go template syntax.
+type BundledTemplate struct {
+	Name   string
+	File   string
+	Source string
+}
+
+// source is the source of a bundled template. Errors give positions in
+// the decompiled Source rather than in File, so the file is labelled as
+// decompiled.
+func (bt BundledTemplate) source() source {
+	s := source{src: bt.Source, parser: "tmpl"}
+	if bt.File != "" {
+		s.file = bt.File + " (decompiled)"
+	}
+	return s
+}
+
+// builtinFuncs are the functions text/template provides itself.
+var builtinFuncs = map[string]bool{
+	"and": true, "or": true, "not": true, "len": true, "index": true,
+	"slice": true, "print": true, "printf": true, "println": true,
+	"html": true, "js": true, "urlquery": true, "call": true,
+	"eq": true, "ne": true, "lt": true, "le": true, "gt": true, "ge": true,
+}
+
+// Parse parses the sources of the templates, generated packages call it
+// when they're initialized. Functions are only checked by name, so Parse
+// doesn't need the functions themselves.
+func (b *Bundle) Parse() error {
+	funcs := textTmpl.FuncMap{}
+	for _, name := range b.Funcs {
+		funcs[name] = func() string { return "" }
+	}
+
+	b.trees = make([]map[string]*parse.Tree, len(b.Templates))
+	for i, bt := range b.Templates {
+		tmpl, err := textTmpl.New(bt.Name).Funcs(funcs).Parse(bt.Source)
+		if err != nil {
+			return parseError(bt.Name, bt.source(), stdlibError(bt.Source, err))
+		}
+		b.trees[i] = map[string]*parse.Tree{}
+		for _, dt := range tmpl.Templates() {
+			if dt.Tree != nil {
+				b.trees[i][dt.Name()] = dt.Tree
+			}
+		}
+	}
+	return nil
+}
+
+// Load adds the templates in the Bundle to t, parsing them first if Parse
+// hasn't been called. It returns an error naming any functions the
+// templates call that t doesn't have.
+func (b *Bundle) Load(t *Template) (*Template, error) {
+	if b.trees == nil {
+		if err := b.Parse(); err != nil {
+			return nil, err
+		}
+	}
+
+	context := generateFuncs(t)
+	var missing []string
+	for _, name := range b.Funcs {
+		if _, ok := t.funcs[name]; !ok && context[name] == nil && !builtinFuncs[name] {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("multitemplate: bundle needs functions: %s", strings.Join(missing, ", "))
+	}
+
+	for i, bt := range b.Templates {
+		// the trees are shared by every Template the Bundle is loaded
+		// into, but executing a template escapes its trees in place
+		trees := make(map[string]*parse.Tree, len(b.trees[i]))
+		for n, tree := range b.trees[i] {
+			trees[n] = tree.Copy()
+		}
+		var err error
+		t, err = t.addTrees(bt.Name, bt.source(), trees)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// Bundle returns a Bundle of the templates in t. Templates that were
+// parsed together are kept together, under the name they were parsed as.
+func (t *Template) Bundle() (*Bundle, error) {
+	var names []string
+	t.eachTemplate(func(name string, tree *parse.Tree) {
+		// templates defined in another template's source are included
+		// with it
+		if s, ok := t.sources[name]; ok && s.name != name {
+			return
+		}
+		names = append(names, name)
+	})
+	sort.Strings(names)
+
+	b := &Bundle{}
+	funcs := map[string]bool{}
+	for _, name := range names {
+		src, err := t.Decompile(name)
+		if err != nil {
+			return nil, err
+		}
+		b.Templates = append(b.Templates, BundledTemplate{Name: name, File: strings.TrimSuffix(t.sources[name].file, " (decompiled)"), Source: src})
+	}
+	t.eachTemplate(func(name string, tree *parse.Tree) {
+		identifiers(tree.Root, funcs)
+	})
+	for name := range funcs {
+		b.Funcs = append(b.Funcs, name)
+	}
+	sort.Strings(b.Funcs)
+	return b, nil
+}
+
+// WriteBundle writes the source of a Go package named pkg, with a Bundle
+// variable holding the templates in t. The templates are parsed when the
+// package is initialized, then Bundle.Load adds them to a Template that
+// has the functions they need.
+func (t *Template) WriteBundle(w io.Writer, pkg string) error {
+	b, err := t.Bundle()
+	if err != nil {
+		return err
+	}
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintln(buf, "// Code generated by multitemplate bundle; DO NOT EDIT.")
+	fmt.Fprintln(buf)
+	fmt.Fprintf(buf, "package %s\n\n", pkg)
+	fmt.Fprintln(buf, `import "github.com/acsellers/multitemplate"`)
+	fmt.Fprintln(buf)
+	fmt.Fprintln(buf, "// Bundle holds the compiled templates, use Bundle.Load to add them to a")
+	fmt.Fprintln(buf, "// Template.")
+	fmt.Fprintln(buf, "var Bundle = &multitemplate.Bundle{")
+	fmt.Fprintf(buf, "Funcs: %#v,\n", b.Funcs)
+	fmt.Fprintln(buf, "Templates: []multitemplate.BundledTemplate{")
+	for _, bt := range b.Templates {
+		fmt.Fprintf(buf, "{\nName: %q,\nFile: %q,\nSource: %q,\n},\n", bt.Name, bt.File, bt.Source)
+	}
+	fmt.Fprintln(buf, "},")
+	fmt.Fprintln(buf, "}")
+	fmt.Fprintln(buf)
+	fmt.Fprintln(buf, "func init() {")
+	fmt.Fprintln(buf, "if err := Bundle.Parse(); err != nil {")
+	fmt.Fprintln(buf, "panic(err)")
+	fmt.Fprintln(buf, "}")
+	fmt.Fprintln(buf, "}")
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(src)
+	return err
+}
+
+// identifiers adds the names of the functions called under n to funcs.
+func identifiers(n parse.Node, funcs map[string]bool) {
+	eachIdentifier(n, func(id *parse.IdentifierNode) {
+		funcs[id.Ident] = true
+	})
+}
+
+// eachIdentifier calls fn with each function called under n.
+func eachIdentifier(n parse.Node, fn func(*parse.IdentifierNode)) {
+	switch n := n.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Nodes {
+			eachIdentifier(c, fn)
+		}
+	case *parse.ActionNode:
+		eachIdentifier(n.Pipe, fn)
+	case *parse.TemplateNode:
+		eachIdentifier(n.Pipe, fn)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Cmds {
+			eachIdentifier(c, fn)
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			eachIdentifier(arg, fn)
+		}
+	case *parse.ChainNode:
+		eachIdentifier(n.Node, fn)
+	case *parse.IdentifierNode:
+		fn(n)
+	case *parse.IfNode:
+		eachIdentifier(&n.BranchNode, fn)
+	case *parse.RangeNode:
+		eachIdentifier(&n.BranchNode, fn)
+	case *parse.WithNode:
+		eachIdentifier(&n.BranchNode, fn)
+	case *parse.BranchNode:
+		eachIdentifier(n.Pipe, fn)
+		eachIdentifier(n.List, fn)
+		eachIdentifier(n.ElseList, fn)
+	}
+}
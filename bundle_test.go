@@ -0,0 +1,111 @@
+package multitemplate
+
+import (
+	"bytes"
+	"go/parser"
+	"go/token"
+	"html/template"
+	"strings"
+	"testing"
+
+	. "github.com/acsellers/assert"
+)
+
+func TestBundle(t *testing.T) {
+	Within(t, func(test *Test) {
+		tmpl := parseSet(test, map[string]string{
+			"layout": `<html>{{ yield "head" (fallback "head") }}{{ exec_block "body" }}{{ end_block }}</html>`,
+			"head":   `<title>{{ .Title | printf "%s!" }}</title>`,
+			"main":   `{{ extend "layout" }}{{ define_block "body" }}{{ range .Items }}<li>{{ . }}</li>{{ end }}{{ end_block }}`,
+		})
+		render := func(t *Template) string {
+			c := NewContext(map[string]interface{}{"Title": "Hi", "Items": []string{"a", "b"}})
+			c.Main = "main"
+			b := bytes.Buffer{}
+			test.NoError(t.ExecuteContext(&b, c))
+			return b.String()
+		}
+		expected := render(tmpl)
+		test.AreEqual(`<html><title>Hi!</title><li>a</li><li>b</li></html>`, expected)
+
+		b, e := tmpl.Bundle()
+		test.NoError(e)
+		test.AreEqual(3, len(b.Templates))
+		test.AreEqual("head", b.Templates[0].Name)
+		test.NoError(b.Parse())
+
+		// a bundle can be loaded into more than one Template
+		for i := 0; i < 2; i++ {
+			loaded, e := b.Load(New("bundle"))
+			test.NoError(e)
+			test.AreEqual(expected, render(loaded))
+		}
+	})
+}
+
+func TestBundleErrors(t *testing.T) {
+	Within(t, func(test *Test) {
+		// positions are in the decompiled source, not the original file
+		b := &Bundle{Templates: []BundledTemplate{{Name: "bad", File: "views/bad.html", Source: "<p>\n{{ if }}</p>"}}}
+		e := b.Parse()
+		pe, ok := e.(*Error)
+		test.AreEqual(true, ok)
+		if ok {
+			test.AreEqual("views/bad.html (decompiled)", pe.File)
+			test.AreEqual(2, pe.Line)
+		}
+
+		b = &Bundle{Templates: []BundledTemplate{{Name: "bad", File: "views/bad.html", Source: "<p>\n{{ index . 5 }}</p>"}}}
+		loaded, e := b.Load(New("bundle"))
+		test.NoError(e)
+		e = loaded.ExecuteTemplate(&bytes.Buffer{}, "bad", []int{})
+		pe, ok = e.(*Error)
+		test.AreEqual(true, ok)
+		if ok {
+			test.AreEqual("views/bad.html (decompiled)", pe.File)
+			test.AreEqual(2, pe.Line)
+		}
+
+		// bundling a bundled template keeps the original file
+		rebundled, e := loaded.Bundle()
+		test.NoError(e)
+		test.AreEqual("views/bad.html", rebundled.Templates[0].File)
+	})
+}
+
+func TestBundleFuncs(t *testing.T) {
+	Within(t, func(test *Test) {
+		shout := template.FuncMap{"shout": strings.ToUpper}
+		tmpl, e := New("funcs").Funcs(shout).Parse("main", `{{ shout . }}{{ if may_yield "x" }}{{ yield "x" }}{{ end }}`, "tmpl")
+		test.NoError(e)
+		b, e := tmpl.Bundle()
+		test.NoError(e)
+		test.AreEqual([]string{"may_yield", "shout", "yield"}, b.Funcs)
+
+		_, e = b.Load(New("bundle"))
+		test.IsError(e)
+		test.AreEqual("multitemplate: bundle needs functions: shout", e.Error())
+
+		loaded, e := b.Load(New("bundle").Funcs(shout))
+		test.NoError(e)
+		buf := bytes.Buffer{}
+		test.NoError(loaded.ExecuteTemplate(&buf, "main", "hi"))
+		test.AreEqual("HI", buf.String())
+	})
+}
+
+func TestWriteBundle(t *testing.T) {
+	Within(t, func(test *Test) {
+		tmpl := parseSet(test, map[string]string{
+			"head": `<title>{{ .Title }}</title>`,
+			"main": `{{ exec "head" . }}<p>{{ .Body }}</p>`,
+		})
+		buf := bytes.Buffer{}
+		test.NoError(tmpl.WriteBundle(&buf, "views"))
+
+		f, e := parser.ParseFile(token.NewFileSet(), "bundle.go", buf.Bytes(), 0)
+		test.NoError(e)
+		test.AreEqual("views", f.Name.Name)
+		test.AreEqual(true, strings.Contains(buf.String(), `Name:   "main",`))
+	})
+}
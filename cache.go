@@ -0,0 +1,256 @@
+package multitemplate
+
+import (
+	"container/list"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// A Cache stores rendered fragments for the cache function. Blocks are
+// stored with their Ruleset, so a cached block is only output where it
+// could have been rendered. A ttl of zero means the fragment doesn't
+// expire. Caches are shared between renders, so they must be safe to
+// use from multiple goroutines.
+type Cache interface {
+	Get(key string) (RenderedBlock, bool)
+	Set(key string, rb RenderedBlock, ttl time.Duration) error
+}
+
+// expiry is a ttl passed to the cache function.
+type expiry time.Duration
+
+// pendingCache is a cache call waiting for its end_cache, hit is set
+// when the content came from the cache instead of being rendered.
+type pendingCache struct {
+	key string
+	ttl time.Duration
+	hit bool
+	rb  RenderedBlock
+}
+
+// cacheOptions sorts the arguments to the cache function after the key,
+// which are a template name, the data for it and a ttl from expires_in.
+func (c *Context) cacheOptions(args []interface{}) (name string, dot interface{}, ttl time.Duration, err error) {
+	dot, ttl = c.Dot, c.CacheTTL
+	var hasName, hasDot bool
+	for _, arg := range args {
+		switch arg := arg.(type) {
+		case expiry:
+			ttl = time.Duration(arg)
+		case string:
+			if !hasName {
+				name, hasName = arg, true
+				continue
+			}
+			if hasDot {
+				return "", nil, 0, fmt.Errorf("cache was given too many arguments")
+			}
+			dot, hasDot = arg, true
+		default:
+			if !hasName || hasDot {
+				return "", nil, 0, fmt.Errorf("cache can't use %T as an argument", arg)
+			}
+			dot, hasDot = arg, true
+		}
+	}
+	return name, dot, ttl, nil
+}
+
+// cached returns the content of a template from the cache, rendering
+// and storing it if it isn't there.
+func (c *Context) cached(key, name string, dot interface{}, ttl time.Duration) (RenderedBlock, error) {
+	if c.Cache != nil {
+		if rb, ok := c.Cache.Get(key); ok {
+			return rb, nil
+		}
+	}
+	rb, e := c.exec(name, dot)
+	if e != nil || c.Cache == nil {
+		return rb, e
+	}
+	return rb, c.Cache.Set(key, rb, ttl)
+}
+
+// openCache starts a cached block, it reports whether the content of the
+// block needs to be rendered. When the cache has the content, it is kept
+// for closeCache to output instead.
+func (c *Context) openCache(key string, ttl time.Duration) bool {
+	if c.Cache != nil {
+		if rb, ok := c.Cache.Get(key); ok {
+			c.caches = append(c.caches, pendingCache{key: key, hit: true, rb: rb})
+			return false
+		}
+	}
+	c.caches = append(c.caches, pendingCache{key: key, ttl: ttl})
+	c.output.OpenUnchecked(key, caching)
+	return true
+}
+
+// closeCache finishes a cached block, outputting the content from the
+// cache, or the rendered content once end_cache has given it an escaping
+// context, which is when it is stored.
+func (c *Context) closeCache() error {
+	if len(c.caches) == 0 {
+		return fmt.Errorf("end_cache without a cache")
+	}
+	pc := c.caches[len(c.caches)-1]
+	c.caches = c.caches[:len(c.caches)-1]
+	if pc.hit {
+		c.output.Immediate(pc.rb)
+		return nil
+	}
+	if _, kind := c.output.closing(); kind != caching {
+		return fmt.Errorf("end_cache for %q closes another block", pc.key)
+	}
+	c.output.CloseAt(func(rb RenderedBlock) error {
+		if c.Cache == nil {
+			return nil
+		}
+		return c.Cache.Set(pc.key, rb, pc.ttl)
+	})
+	return nil
+}
+
+// An LRUCache is an in-memory Cache holding a limited number of
+// fragments, it discards the least recently used fragment to make room
+// for a new one.
+type LRUCache struct {
+	size    int
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type lruEntry struct {
+	key     string
+	block   RenderedBlock
+	expires time.Time
+}
+
+// NewLRUCache returns an LRUCache that holds up to size fragments.
+func NewLRUCache(size int) *LRUCache {
+	return &LRUCache{
+		size:    size,
+		order:   list.New(),
+		entries: map[string]*list.Element{},
+	}
+}
+
+func (lc *LRUCache) Get(key string) (RenderedBlock, bool) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	el, ok := lc.entries[key]
+	if !ok {
+		return RenderedBlock{}, false
+	}
+	entry := el.Value.(*lruEntry)
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		lc.order.Remove(el)
+		delete(lc.entries, key)
+		return RenderedBlock{}, false
+	}
+	lc.order.MoveToFront(el)
+	return entry.block, true
+}
+
+func (lc *LRUCache) Set(key string, rb RenderedBlock, ttl time.Duration) error {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	entry := &lruEntry{key: key, block: rb}
+	if ttl > 0 {
+		entry.expires = time.Now().Add(ttl)
+	}
+	if el, ok := lc.entries[key]; ok {
+		el.Value = entry
+		lc.order.MoveToFront(el)
+		return nil
+	}
+	lc.entries[key] = lc.order.PushFront(entry)
+	for lc.order.Len() > lc.size {
+		oldest := lc.order.Back()
+		lc.order.Remove(oldest)
+		delete(lc.entries, oldest.Value.(*lruEntry).key)
+	}
+	return nil
+}
+
+// A FileCache is a Cache that keeps each fragment in a file in a
+// directory, so fragments can outlive the process, or be shared by
+// processes using the same directory.
+type FileCache struct {
+	Dir string
+}
+
+// NewFileCache returns a FileCache using dir, which is created if it
+// doesn't exist.
+func NewFileCache(dir string) (*FileCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &FileCache{Dir: dir}, nil
+}
+
+type fileEntry struct {
+	Content string
+	Type    Ruleset
+	Expires time.Time
+}
+
+func (fc *FileCache) path(key string) string {
+	sum := sha1.Sum([]byte(key))
+	return filepath.Join(fc.Dir, hex.EncodeToString(sum[:]))
+}
+
+// Get returns the fragment stored for key, fragments that can't be read
+// are treated as missing.
+func (fc *FileCache) Get(key string) (RenderedBlock, bool) {
+	b, err := os.ReadFile(fc.path(key))
+	if err != nil {
+		return RenderedBlock{}, false
+	}
+	var entry fileEntry
+	if err := json.Unmarshal(b, &entry); err != nil {
+		return RenderedBlock{}, false
+	}
+	if !entry.Expires.IsZero() && time.Now().After(entry.Expires) {
+		os.Remove(fc.path(key))
+		return RenderedBlock{}, false
+	}
+	return RenderedBlock{Content: template.HTML(entry.Content), Type: entry.Type}, true
+}
+
+// Set writes the fragment to a temporary file first, so a fragment is
+// never read while it is half written.
+func (fc *FileCache) Set(key string, rb RenderedBlock, ttl time.Duration) error {
+	entry := fileEntry{Content: string(rb.Content), Type: rb.Type}
+	if ttl > 0 {
+		entry.Expires = time.Now().Add(ttl)
+	}
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(fc.Dir, ".fragment")
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(b); err == nil {
+		err = f.Close()
+	} else {
+		f.Close()
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), fc.path(key))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
@@ -0,0 +1,160 @@
+package multitemplate
+
+import (
+	"bytes"
+	"html/template"
+	"os"
+	"testing"
+	"time"
+
+	. "github.com/acsellers/assert"
+)
+
+func TestCacheBlock(tst *testing.T) {
+	Within(tst, func(test *Test) {
+		t := parseSet(test, map[string]string{
+			"main": `<div>{{ if cache "greeting" }}<p>{{ .Name }}</p>{{ end }}{{ end_cache }}</div>`,
+		})
+		cache := NewLRUCache(10)
+		for _, ct := range []struct {
+			Cache    Cache
+			Name     string
+			Expected string
+		}{
+			{cache, "<Ann>", `<div><p>&lt;Ann&gt;</p></div>`},
+			{cache, "Bo", `<div><p>&lt;Ann&gt;</p></div>`},
+			// without a cache the block is rendered every time
+			{nil, "Bo", `<div><p>Bo</p></div>`},
+		} {
+			c := NewContext(map[string]string{"Name": ct.Name})
+			c.Main = "main"
+			c.Cache = ct.Cache
+			b := bytes.Buffer{}
+			test.NoError(t.ExecuteContext(&b, c))
+			test.AreEqual(ct.Expected, b.String())
+		}
+
+		rb, ok := cache.Get("greeting")
+		test.AreEqual(true, ok)
+		test.AreEqual(HTML, rb.Type)
+	})
+}
+
+func TestCacheSkip(tst *testing.T) {
+	Within(tst, func(test *Test) {
+		renders := 0
+		tmpl, e := New("skip").Funcs(template.FuncMap{
+			"costly": func() string {
+				renders++
+				return "costly"
+			},
+		}).Parse("main", `<p>{{ if cache "costly" }}{{ costly }}{{ end }}{{ end_cache }}</p>`, "tmpl")
+		test.NoError(e)
+
+		cache := NewLRUCache(10)
+		for i := 0; i < 3; i++ {
+			c := NewContext(nil)
+			c.Main = "main"
+			c.Cache = cache
+			b := bytes.Buffer{}
+			test.NoError(tmpl.ExecuteContext(&b, c))
+			test.AreEqual(`<p>costly</p>`, b.String())
+		}
+		// the content is only rendered when it isn't in the cache
+		test.AreEqual(1, renders)
+	})
+}
+
+func TestCacheTemplate(tst *testing.T) {
+	Within(tst, func(test *Test) {
+		t := parseSet(test, map[string]string{
+			"nav":  `<nav>{{ .Name }}</nav>`,
+			"main": `{{ cache "nav" "nav" . (expires_in "1h") }}`,
+		})
+		cache := NewLRUCache(10)
+		for _, name := range []string{"Ann", "Bo"} {
+			c := NewContext(map[string]string{"Name": name})
+			c.Main = "main"
+			c.Cache = cache
+			b := bytes.Buffer{}
+			test.NoError(t.ExecuteContext(&b, c))
+			test.AreEqual(`<nav>Ann</nav>`, b.String())
+		}
+		test.AreEqual([]string{"nav"}, t.Dependencies()["main"].Execs)
+	})
+}
+
+func TestCacheContext(tst *testing.T) {
+	Within(tst, func(test *Test) {
+		t := parseSet(test, map[string]string{
+			"html":   `{{ if cache "frag" }}<b>x</b>{{ end }}{{ end_cache }}`,
+			"script": `<script>var x = {{ if cache "frag" }}1{{ end }}{{ end_cache }};</script>`,
+			"stray":  `{{ end_cache }}`,
+		})
+		cache := NewLRUCache(10)
+		for _, ct := range []struct {
+			Main string
+			Fail bool
+		}{
+			{"html", false},
+			// a block cached as HTML can't be output in a script
+			{"script", true},
+			{"stray", true},
+		} {
+			c := NewContext(nil)
+			c.Main = ct.Main
+			c.Cache = cache
+			e := t.ExecuteContext(&bytes.Buffer{}, c)
+			if ct.Fail {
+				test.IsError(e)
+			} else {
+				test.NoError(e)
+			}
+		}
+	})
+}
+
+func TestLRUCache(tst *testing.T) {
+	Within(tst, func(test *Test) {
+		cache := NewLRUCache(2)
+		test.NoError(cache.Set("a", RenderedBlock{Content: "a"}, 0))
+		test.NoError(cache.Set("b", RenderedBlock{Content: "b"}, 0))
+		cache.Get("a")
+		test.NoError(cache.Set("c", RenderedBlock{Content: "c"}, 0))
+		_, ok := cache.Get("b")
+		test.AreEqual(false, ok)
+		_, ok = cache.Get("a")
+		test.AreEqual(true, ok)
+
+		test.NoError(cache.Set("d", RenderedBlock{Content: "d"}, time.Nanosecond))
+		time.Sleep(time.Millisecond)
+		_, ok = cache.Get("d")
+		test.AreEqual(false, ok)
+	})
+}
+
+func TestFileCache(tst *testing.T) {
+	Within(tst, func(test *Test) {
+		dir, e := os.MkdirTemp("", "fragments")
+		test.NoError(e)
+		defer os.RemoveAll(dir)
+
+		cache, e := NewFileCache(dir)
+		test.NoError(e)
+		test.NoError(cache.Set("nav", RenderedBlock{Content: "<nav></nav>", Type: HTML}, 0))
+		rb, ok := cache.Get("nav")
+		test.AreEqual(true, ok)
+		test.AreEqual(RenderedBlock{Content: "<nav></nav>", Type: HTML}, rb)
+
+		// another FileCache on the same directory sees the fragment
+		rb, ok = (&FileCache{Dir: dir}).Get("nav")
+		test.AreEqual(true, ok)
+
+		test.NoError(cache.Set("old", RenderedBlock{Content: "old"}, time.Nanosecond))
+		time.Sleep(time.Millisecond)
+		_, ok = cache.Get("old")
+		test.AreEqual(false, ok)
+		_, ok = cache.Get("missing")
+		test.AreEqual(false, ok)
+	})
+}
@@ -0,0 +1,90 @@
+package multitemplate
+
+import (
+	"context"
+	"io"
+	"text/template/parse"
+)
+
+// ExecuteContextWith is ExecuteContext, stopping when cx is cancelled or
+// its deadline passes. The error returned then wraps the error from cx,
+// so errors.Is(err, context.Canceled) can be used to check for it.
+func (t *Template) ExecuteContextWith(cx context.Context, w io.Writer, ctx *Context) error {
+	ctx.Ctx = cx
+	return t.ExecuteContext(w, ctx)
+}
+
+// ExecuteTemplateWith is ExecuteTemplate, stopping when cx is cancelled
+// or its deadline passes.
+func (t *Template) ExecuteTemplateWith(cx context.Context, w io.Writer, name string, data interface{}) error {
+	if t.ctx != nil {
+		t.ctx.Ctx = cx
+		return t.ExecuteTemplate(w, name, data)
+	}
+
+	ctx := NewContext(data)
+	ctx.Ctx = cx
+	return t.executeTemplate(ctx, w, name, data)
+}
+
+// cancelled returns the error of the Context's Ctx once it is done.
+func (c *Context) cancelled() error {
+	if c.Ctx == nil {
+		return nil
+	}
+	return c.Ctx.Err()
+}
+
+// checkpoints adds a call to checkpoint at the start of the body of each
+// range in the templates, so a render that is cancelled stops between
+// iterations. The call sets a variable, so html/template doesn't escape
+// it and nothing is written.
+func checkpoints(t *Template) {
+	t.eachTemplate(func(name string, tree *parse.Tree) {
+		addCheckpoints(tree.Root)
+	})
+}
+
+func addCheckpoints(n parse.Node) {
+	switch n := n.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, node := range n.Nodes {
+			addCheckpoints(node)
+		}
+	case *parse.IfNode:
+		addCheckpoints(n.List)
+		addCheckpoints(n.ElseList)
+	case *parse.WithNode:
+		addCheckpoints(n.List)
+		addCheckpoints(n.ElseList)
+	case *parse.RangeNode:
+		addCheckpoints(n.List)
+		addCheckpoints(n.ElseList)
+		n.List.Nodes = append([]parse.Node{checkpointNode(n.Pos, n.Line)}, n.List.Nodes...)
+	}
+}
+
+// checkpointNode is {{ $checkpoint := checkpoint }}.
+func checkpointNode(pos parse.Pos, line int) parse.Node {
+	return &parse.ActionNode{
+		NodeType: parse.NodeAction,
+		Pos:      pos,
+		Line:     line,
+		Pipe: &parse.PipeNode{
+			NodeType: parse.NodePipe,
+			Pos:      pos,
+			Line:     line,
+			Decl: []*parse.VariableNode{
+				{NodeType: parse.NodeVariable, Pos: pos, Ident: []string{"$checkpoint"}},
+			},
+			Cmds: []*parse.CommandNode{{
+				NodeType: parse.NodeCommand,
+				Pos:      pos,
+				Args:     []parse.Node{parse.NewIdentifier("checkpoint").SetPos(pos)},
+			}},
+		},
+	}
+}
@@ -0,0 +1,96 @@
+package multitemplate
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"html/template"
+	"testing"
+	"time"
+
+	. "github.com/acsellers/assert"
+)
+
+func TestCancelRange(t *testing.T) {
+	Within(t, func(test *Test) {
+		cx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		var calls int
+		tmpl, e := New("cancel").Funcs(template.FuncMap{
+			"item": func(i int) int {
+				calls++
+				if i == 3 {
+					cancel()
+				}
+				return i
+			},
+		}).Parse("list", `<script>var a = [{{ range . }}{{ item . }},{{ end }}];</script>`, "tmpl")
+		test.NoError(e)
+
+		b := bytes.Buffer{}
+		test.NoError(tmpl.ExecuteTemplateWith(context.Background(), &b, "list", []int{1, 2}))
+		test.AreEqual(`<script>var a = [ 1 , 2 ,];</script>`, b.String())
+
+		b.Reset()
+		e = tmpl.ExecuteTemplateWith(cx, &b, "list", []int{1, 2, 3, 4, 5, 6})
+		test.AreEqual(true, errors.Is(e, context.Canceled))
+		test.AreEqual(5, calls)
+		test.AreEqual("", b.String())
+	})
+}
+
+func TestCancelLayout(t *testing.T) {
+	Within(t, func(test *Test) {
+		tmpl := New("cancel")
+		for name, src := range map[string]string{
+			"page":   `<p>page</p>`,
+			"side":   `<aside>side</aside>`,
+			"layout": `{{ yield "side" }}{{ yield }}`,
+		} {
+			var e error
+			tmpl, e = tmpl.Parse(name, src, "tmpl")
+			test.NoError(e)
+		}
+
+		cx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+		defer cancel()
+		c := NewContext(nil)
+		c.Main = "page"
+		c.Layout = "layout"
+		c.Yields["side"] = "side"
+		b := bytes.Buffer{}
+		e := tmpl.ExecuteContextWith(cx, &b, c)
+		test.AreEqual(true, errors.Is(e, context.DeadlineExceeded))
+		test.AreEqual("", b.String())
+
+		c = NewContext(nil)
+		c.Main = "page"
+		c.Layout = "layout"
+		c.Yields["side"] = "side"
+		test.NoError(tmpl.ExecuteContextWith(context.Background(), &b, c))
+		test.AreEqual(`<aside>side</aside><p>page</p>`, b.String())
+	})
+}
+
+type requestKey struct{}
+
+func TestCancelContextFuncs(t *testing.T) {
+	Within(t, func(test *Test) {
+		ContextFuncs["request_user"] = func(ctx func() *Context) interface{} {
+			return func() interface{} {
+				if c := ctx(); c != nil && c.Ctx != nil {
+					return c.Ctx.Value(requestKey{})
+				}
+				return nil
+			}
+		}
+		defer delete(ContextFuncs, "request_user")
+
+		tmpl, e := New("cancel").Parse("user", `<p>{{ request_user }}</p>`, "tmpl")
+		test.NoError(e)
+		b := bytes.Buffer{}
+		cx := context.WithValue(context.Background(), requestKey{}, "andrew")
+		test.NoError(tmpl.ExecuteTemplateWith(cx, &b, "user", nil))
+		test.AreEqual(`<p>andrew</p>`, b.String())
+	})
+}
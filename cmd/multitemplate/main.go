@@ -0,0 +1,231 @@
+/*
+Command multitemplate checks, renders and converts the templates in a
+directory, using every language that multitemplate includes.
+
+	multitemplate check [-dir templates]
+	multitemplate render [-dir templates] [-data data.json] [-layout name] name
+	multitemplate dump [-dir templates] name
+	multitemplate bundle [-dir templates] [-pkg name] [-o file]
+
+check parses every template and reports each error with its position,
+then checks the references between the templates. It exits with a status
+of 1 if there were any errors, so it can be run by CI.
+
+render executes a template, or a template inside a layout, with the JSON
+in the data file as the RenderArgs, and writes the output to stdout.
+
+dump prints the standard Go template source that a bham, terse or
+mustache template was compiled to.
+
+bundle writes a Go package holding every template, compiled ahead of
+time, so an application can load its templates with Bundle.Load instead
+of parsing the source files when it starts.
+
+Templates are named by their path in the directory, without the extension
+of their language, so "app/index.html.bham" is named "app/index.html".
+*/
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/acsellers/multitemplate"
+	_ "github.com/acsellers/multitemplate/bham"
+	"github.com/acsellers/multitemplate/helpers"
+	_ "github.com/acsellers/multitemplate/mustache"
+	_ "github.com/acsellers/multitemplate/terse"
+)
+
+type command struct {
+	usage string
+	run   func(c *config, args []string) error
+}
+
+var commands = map[string]command{
+	"check":  {"check [-dir templates]", check},
+	"render": {"render [-dir templates] [-data data.json] [-layout name] name", render},
+	"dump":   {"dump [-dir templates] name", dump},
+	"bundle": {"bundle [-dir templates] [-pkg name] [-o file]", bundle},
+}
+
+// config holds the flags shared by the commands
+type config struct {
+	dir     string
+	helpers string
+	data    string
+	layout  string
+	pkg     string
+	output  string
+	stdout  io.Writer
+	stderr  io.Writer
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || commands[args[0]].run == nil {
+		usage(stderr)
+		return 2
+	}
+	cmd := commands[args[0]]
+
+	c := &config{stdout: stdout, stderr: stderr}
+	flags := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.StringVar(&c.dir, "dir", ".", "directory of templates")
+	flags.StringVar(&c.helpers, "helpers", "all", "comma separated helper modules to load")
+	if args[0] == "render" {
+		flags.StringVar(&c.data, "data", "", "JSON file of RenderArgs")
+		flags.StringVar(&c.layout, "layout", "", "layout to render the template in")
+	}
+	if args[0] == "bundle" {
+		flags.StringVar(&c.pkg, "pkg", "templates", "package name of the generated file")
+		flags.StringVar(&c.output, "o", "", "file to write, instead of stdout")
+	}
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: multitemplate", cmd.usage)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	if err := cmd.run(c, flags.Args()); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func usage(w io.Writer) {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintln(w, "usage:")
+	for _, name := range names {
+		fmt.Fprintln(w, "  multitemplate", commands[name].usage)
+	}
+}
+
+func (c *config) base() *multitemplate.Template {
+	return multitemplate.New("multitemplate").Funcs(helpers.GetHelpers(strings.Split(c.helpers, ",")...))
+}
+
+// load loads the templates in the directory, stopping at the first error.
+func (c *config) load() (*multitemplate.Template, error) {
+	return multitemplate.NewLoader(os.DirFS(c.dir)).Load(c.base())
+}
+
+// check parses each template on its own, so that every broken template
+// is reported instead of only the first one.
+func check(c *config, args []string) error {
+	if len(args) != 0 {
+		return errors.New("check takes no arguments")
+	}
+	var count, failed int
+	l := multitemplate.NewLoader(os.DirFS(c.dir))
+	l.Filter = func(path string) bool {
+		count++
+		return true
+	}
+	l.OnError = func(path string, err error) error {
+		failed++
+		fmt.Fprintln(c.stdout, err)
+		return nil
+	}
+	t, err := l.Load(c.base())
+	if err != nil {
+		return err
+	}
+
+	if failed == 0 {
+		var ce *multitemplate.CheckError
+		if err := t.Check(); errors.As(err, &ce) {
+			for _, e := range ce.Errors {
+				fmt.Fprintln(c.stdout, e)
+			}
+			failed += len(ce.Errors)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d errors in %d templates", failed, count)
+	}
+	fmt.Fprintf(c.stdout, "%d templates ok\n", count)
+	return nil
+}
+
+func render(c *config, args []string) error {
+	if len(args) != 1 {
+		return errors.New("render takes the name of one template")
+	}
+	t, err := c.load()
+	if err != nil {
+		return err
+	}
+
+	var data interface{}
+	if c.data != "" {
+		b, err := os.ReadFile(c.data)
+		if err != nil {
+			return err
+		}
+		if err = json.Unmarshal(b, &data); err != nil {
+			return fmt.Errorf("%s: %v", c.data, err)
+		}
+	}
+
+	ctx := multitemplate.NewContext(data)
+	ctx.Main = args[0]
+	ctx.Layout = c.layout
+	return t.ExecuteContext(c.stdout, ctx)
+}
+
+func dump(c *config, args []string) error {
+	if len(args) != 1 {
+		return errors.New("dump takes the name of one template")
+	}
+	t, err := c.load()
+	if err != nil {
+		return err
+	}
+	src, err := t.Decompile(args[0])
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(c.stdout, src)
+	return nil
+}
+
+func bundle(c *config, args []string) error {
+	if len(args) != 0 {
+		return errors.New("bundle takes no arguments")
+	}
+	t, err := c.load()
+	if err != nil {
+		return err
+	}
+	if c.output == "" {
+		return t.WriteBundle(c.stdout, c.pkg)
+	}
+
+	f, err := os.Create(c.output)
+	if err != nil {
+		return err
+	}
+	if err = t.WriteBundle(f, c.pkg); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
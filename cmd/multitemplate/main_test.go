@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/acsellers/assert"
+)
+
+func writeTemplates(test *Test, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "multitemplate")
+	test.NoError(err)
+	for name, src := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		test.NoError(ioutil.WriteFile(path, []byte(src), 0644))
+	}
+	return dir
+}
+
+var goodTemplates = map[string]string{
+	"layouts/main.html.tmpl": `<html>{{ yield }}</html>`,
+	"app/index.html.bham":    "%p\n  = .Name",
+	"app/[id].html.tmpl":     `<p>{{ .Name }}</p>`,
+	"data.json":              `{"Name": "World"}`,
+}
+
+func TestCheck(t *testing.T) {
+	Within(t, func(test *Test) {
+		dir := writeTemplates(test, goodTemplates)
+		defer os.RemoveAll(dir)
+		out := &bytes.Buffer{}
+		test.AreEqual(0, run([]string{"check", "-dir", dir}, out, out))
+		test.AreEqual("4 templates ok\n", out.String())
+
+		broken := map[string]string{
+			"app/a.html.tmpl":   "<p>\n{{ if }}</p>",
+			"app/b.html.bham":   "%p\n  :unknown\n    text",
+			"app/c.html.tmpl":   `{{ extend "layouts/none.html" }}`,
+			"app/[d].html.tmpl": "<p>\n\n{{ end }}",
+			"app/ok.html.tmpl":  `<p></p>`,
+		}
+		dir = writeTemplates(test, broken)
+		defer os.RemoveAll(dir)
+		out.Reset()
+		test.AreEqual(1, run([]string{"check", "-dir", dir}, out, out))
+		for _, expected := range []string{"app/a.html.tmpl:2", "app/b.html.bham:2", "app/[d].html.tmpl:3", "3 errors in 5 templates"} {
+			test.AreEqual(true, strings.Contains(out.String(), expected))
+		}
+
+		// references are checked once every template parses
+		delete(broken, "app/a.html.tmpl")
+		delete(broken, "app/b.html.bham")
+		delete(broken, "app/[d].html.tmpl")
+		dir = writeTemplates(test, broken)
+		defer os.RemoveAll(dir)
+		out.Reset()
+		test.AreEqual(1, run([]string{"check", "-dir", dir}, out, out))
+		test.AreEqual(true, strings.Contains(out.String(), `layouts/none.html`))
+	})
+}
+
+func TestRender(t *testing.T) {
+	Within(t, func(test *Test) {
+		dir := writeTemplates(test, goodTemplates)
+		defer os.RemoveAll(dir)
+		out := &bytes.Buffer{}
+		args := []string{"render", "-dir", dir, "-data", filepath.Join(dir, "data.json"), "-layout", "layouts/main.html", "app/index.html"}
+		test.AreEqual(0, run(args, out, out))
+		test.AreEqual("<html><p>World</p></html>", out.String())
+	})
+}
+
+func TestDump(t *testing.T) {
+	Within(t, func(test *Test) {
+		dir := writeTemplates(test, goodTemplates)
+		defer os.RemoveAll(dir)
+		out := &bytes.Buffer{}
+		test.AreEqual(0, run([]string{"dump", "-dir", dir, "app/index.html"}, out, out))
+		test.AreEqual(true, strings.Contains(out.String(), "<p>{{ .Name }}</p>"))
+	})
+}
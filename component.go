@@ -0,0 +1,77 @@
+package multitemplate
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A componentCall is a component whose slots are being filled in by the
+// template calling it.
+type componentCall struct {
+	name  string
+	dot   interface{}
+	slots map[string]RenderedBlock
+}
+
+// openComponent starts capturing the content of a component call, the
+// content outside of any slot becomes the default slot.
+func (c *Context) openComponent(name string, dot interface{}) {
+	c.components = append(c.components, &componentCall{
+		name:  name,
+		dot:   dot,
+		slots: map[string]RenderedBlock{},
+	})
+	c.output.OpenAs(name, componentContent)
+}
+
+// openSlot starts capturing the content of a slot for the component
+// being called.
+func (c *Context) openSlot(name string) error {
+	if len(c.components) == 0 {
+		return fmt.Errorf("slot %q is not in a component", name)
+	}
+	c.output.OpenAs(name, slotContent)
+	return nil
+}
+
+// closeSlot saves the content of the slot being captured.
+func (c *Context) closeSlot() error {
+	if _, kind := c.output.closing(); kind != slotContent {
+		return fmt.Errorf("end_slot without a slot")
+	}
+	name, rb := c.output.Close()
+	c.components[len(c.components)-1].slots[name] = rb
+	return nil
+}
+
+// closeComponent finishes capturing a component call, then renders the
+// component with the slots it was given.
+func (c *Context) closeComponent() (RenderedBlock, error) {
+	if _, kind := c.output.closing(); kind != componentContent {
+		return RenderedBlock{}, fmt.Errorf("end_component without a component")
+	}
+	_, rb := c.output.Close()
+	call := c.components[len(c.components)-1]
+	c.components = c.components[:len(c.components)-1]
+	if _, ok := call.slots[""]; !ok && strings.TrimSpace(string(rb.Content)) != "" {
+		call.slots[""] = rb
+	}
+
+	c.slots = append(c.slots, call.slots)
+	defer func() { c.slots = c.slots[:len(c.slots)-1] }()
+	return c.exec(call.name, call.dot)
+}
+
+// slot returns the content given for a slot of the component being
+// rendered.
+func (c *Context) slot(names []string) (RenderedBlock, bool, error) {
+	if len(c.slots) == 0 {
+		return RenderedBlock{}, false, fmt.Errorf("yield_slot is not in a component")
+	}
+	var name string
+	if len(names) > 0 {
+		name = names[0]
+	}
+	rb, ok := c.slots[len(c.slots)-1][name]
+	return rb, ok, nil
+}
@@ -0,0 +1,78 @@
+package multitemplate
+
+import (
+	"bytes"
+	"testing"
+
+	. "github.com/acsellers/assert"
+)
+
+func TestComponent(tst *testing.T) {
+	Within(tst, func(test *Test) {
+		t := parseSet(test, map[string]string{
+			"card":    `<div class="card">{{ if has_slot "header" }}<header>{{ yield_slot "header" }}</header>{{ else }}<header>{{ .Title }}</header>{{ end }}{{ yield_slot }}</div>`,
+			"filled":  `{{ component "card" . (locals "Title" "Hi") }}{{ slot "header" }}<h2>{{ .Name }}</h2>{{ end_slot }}<p>{{ .Name }}</p>{{ end_component }}`,
+			"default": `{{ component "card" . }}body{{ end_component }}`,
+		})
+
+		c := NewContext(map[string]string{"Name": "<Ann>"})
+		c.Main = "filled"
+		b := &bytes.Buffer{}
+		test.NoError(t.ExecuteContext(b, c))
+		test.AreEqual(`<div class="card"><header><h2>&lt;Ann&gt;</h2></header><p>&lt;Ann&gt;</p></div>`, b.String())
+		// slots belong to the component call, not the Context
+		test.AreEqual(0, len(c.Blocks))
+
+		// slots that aren't filled in are left to the component
+		c = NewContext(map[string]string{"Title": "Default"})
+		c.Main = "default"
+		b.Reset()
+		test.NoError(t.ExecuteContext(b, c))
+		test.AreEqual(`<div class="card"><header>Default</header>body</div>`, b.String())
+	})
+}
+
+func TestNestedComponent(tst *testing.T) {
+	Within(tst, func(test *Test) {
+		t := parseSet(test, map[string]string{
+			"card":  `<div class="card">{{ if has_slot "header" }}<header>{{ yield_slot "header" }}</header>{{ else }}<header>{{ .Title }}</header>{{ end }}{{ yield_slot }}</div>`,
+			"panel": `<section>{{ component "card" . }}{{ slot "header" }}Panel: {{ yield_slot "header" }}{{ end_slot }}{{ yield_slot }}{{ end_component }}</section>`,
+			"main":  `{{ component "panel" . }}{{ slot "header" }}Users{{ end_slot }}{{ component "card" . }}inner{{ end_component }}{{ end_component }}`,
+		})
+
+		c := NewContext(map[string]string{"Title": "T"})
+		c.Main = "main"
+		b := &bytes.Buffer{}
+		test.NoError(t.ExecuteContext(b, c))
+		test.AreEqual(`<section><div class="card"><header>Panel: Users</header><div class="card"><header>T</header>inner</div></div></section>`, b.String())
+	})
+}
+
+func TestComponentErrors(tst *testing.T) {
+	Within(tst, func(test *Test) {
+		t := parseSet(test, map[string]string{
+			"script":      `<script>var x = {{ yield_slot }};</script>`,
+			"slot":        `{{ slot "header" }}x{{ end_slot }}`,
+			"yield_slot":  `{{ yield_slot "header" }}`,
+			"end":         `{{ end_component }}`,
+			"script_slot": `{{ component "script" . }}<b>x</b>{{ end_component }}`,
+		})
+
+		// slots only exist in a component call, and slot content is
+		// checked against where it is output
+		for _, name := range []string{"slot", "yield_slot", "end", "script_slot"} {
+			c := NewContext(nil)
+			c.Main = name
+			test.IsError(t.ExecuteContext(&bytes.Buffer{}, c))
+		}
+	})
+}
+
+func TestComponentDependencies(tst *testing.T) {
+	Within(tst, func(test *Test) {
+		t, e := New("components").Parse("main", `{{ component "card" . }}{{ end_component }}`, "tmpl")
+		test.NoError(e)
+		test.AreEqual([]string{"card"}, t.Dependencies()["main"].Execs)
+		test.IsError(t.Check())
+	})
+}
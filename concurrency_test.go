@@ -0,0 +1,119 @@
+package multitemplate
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+
+	. "github.com/acsellers/assert"
+)
+
+func TestConcurrentExecuteContext(tst *testing.T) {
+	Within(tst, func(test *Test) {
+		tmpl := parseSet(test, map[string]string{
+			"layout":  `<html>{{ yield "head" }}<body>{{ yield }}</body>{{ yield "sidebar" }}</html>`,
+			"main":    `{{ extend "parent" }}{{ define_block "head" }}<title>{{ .Title }}</title>{{ end_block }}`,
+			"parent":  `<p>{{ root_dot.Body }}</p>{{ content_for "sidebar" "sidebar" }}`,
+			"sidebar": `<aside>{{ .Title }}</aside>`,
+		})
+
+		var wg sync.WaitGroup
+		results := make([]string, 64)
+		errs := make([]error, 64)
+		for i := range results {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				c := NewContext(map[string]string{
+					"Title": fmt.Sprint("page ", i),
+					"Body":  fmt.Sprint("body ", i),
+				})
+				c.Main = "main"
+				c.Layout = "layout"
+				b := bytes.Buffer{}
+				errs[i] = tmpl.ExecuteContext(&b, c)
+				results[i] = b.String()
+			}(i)
+		}
+		wg.Wait()
+
+		for i, result := range results {
+			test.NoError(errs[i])
+			test.AreEqual(
+				fmt.Sprintf("<html><title>page %d</title><body><p>body %d</p></body><aside>page %d</aside></html>", i, i, i),
+				result,
+			)
+		}
+	})
+}
+
+func TestConcurrentExecuteTemplate(tst *testing.T) {
+	Within(tst, func(test *Test) {
+		tmpl := parseSet(test, map[string]string{
+			"fragment": `<b>{{ . }}</b>`,
+		})
+
+		var wg sync.WaitGroup
+		results := make([]string, 64)
+		for i := range results {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				b := bytes.Buffer{}
+				if e := tmpl.ExecuteTemplate(&b, "fragment", i); e != nil {
+					results[i] = e.Error()
+					return
+				}
+				results[i] = b.String()
+			}(i)
+		}
+		wg.Wait()
+
+		for i, result := range results {
+			test.AreEqual(fmt.Sprintf("<b>%d</b>", i), result)
+		}
+	})
+}
+
+func TestBindingReuse(tst *testing.T) {
+	Within(tst, func(test *Test) {
+		tmpl := parseSet(test, map[string]string{
+			"layout":  `<html>{{ yield "head" }}<body>{{ yield }}</body>{{ yield "sidebar" }}</html>`,
+			"main":    `{{ extend "parent" }}{{ define_block "head" }}<title>{{ .Title }}</title>{{ end_block }}`,
+			"parent":  `<p>{{ root_dot.Body }}</p>{{ content_for "sidebar" "sidebar" }}`,
+			"sidebar": `<aside>{{ .Title }}</aside>`,
+		})
+		for i := 0; i < 10; i++ {
+			c := NewContext(map[string]string{"Title": "t", "Body": "b"})
+			c.Main = "main"
+			c.Layout = "layout"
+			b := bytes.Buffer{}
+			test.NoError(tmpl.ExecuteContext(&b, c))
+		}
+		// sequential renders should keep reusing a single bound clone
+		test.AreEqual(1, len(tmpl.pool.free))
+
+		tmpl, e := tmpl.Parse("extra", `extra`, "tmpl")
+		test.NoError(e)
+		test.AreEqual(0, len(tmpl.pool.free))
+	})
+}
+
+func TestPoolReset(tst *testing.T) {
+	Within(tst, func(test *Test) {
+		tmpl, e := New("pool").Parse("page", `<p>old</p>`, "tmpl")
+		test.NoError(e)
+
+		// a clone borrowed before the set changes isn't pooled again
+		tt, e := tmpl.acquire(NewContext(nil))
+		test.NoError(e)
+		tmpl, e = tmpl.Parse("page", `<p>new</p>`, "tmpl")
+		test.NoError(e)
+		tmpl.release(tt)
+
+		b := bytes.Buffer{}
+		test.NoError(tmpl.ExecuteTemplate(&b, "page", nil))
+		test.AreEqual("<p>new</p>", b.String())
+	})
+}
@@ -2,9 +2,12 @@ package multitemplate
 
 import (
 	"bytes"
+	"context"
 	"html/template"
 	"io"
+	"sort"
 	"strings"
+	"time"
 )
 
 func NewContext(data interface{}) *Context {
@@ -21,15 +24,6 @@ type RenderedBlock struct {
 	Type    Ruleset
 }
 
-type Ruleset string
-
-const (
-	User Ruleset = ""
-	HTML Ruleset = "&lt;&#34;&#39;."
-	CSS  Ruleset = "ZgotmplZ"
-	JS   Ruleset = `"\u003c\"'."`
-)
-
 // A Context allows you to setup more specialized template executions,
 // like those involving layouts
 type Context struct {
@@ -37,9 +31,19 @@ type Context struct {
 	Main        string
 	mainContent RenderedBlock
 	// Layout for rendering
-	Layout          string
+	Layout string
+	// Layouts wrap the main template, starting with the innermost. Each
+	// layout yields to the one inside it, and Layout, if it is set, is
+	// rendered last around all of them.
+	Layouts         []string
 	executingLayout bool
 	currentMode     string
+	// Stream writes the layout to the writer as it executes, holding back
+	// output only from the first block or yield that the main template
+	// has not been rendered for yet. If the writer is an http.Flusher, it
+	// will be flushed whenever held output is released.
+	Stream      bool
+	mainPending bool
 
 	// Templates set for yields
 	Yields map[string]string
@@ -47,6 +51,42 @@ type Context struct {
 	Blocks map[string]RenderedBlock
 	// Base RenderArgs for the template
 	Dot interface{}
+	// Cache stores the fragments rendered by the cache function, without
+	// one the fragments are rendered every time
+	Cache Cache
+	// CacheTTL is how long fragments are cached for when expires_in isn't
+	// given, zero means they don't expire
+	CacheTTL time.Duration
+	// Tracer is told when each template, yield and block starts and ends
+	Tracer Tracer
+	// Locale picks the messages of the Catalog for the t function, and
+	// templates for the locale over those without one
+	Locale  string
+	Catalog *Catalog
+	// CSRFToken is added to forms by the form helpers, integrations set
+	// it for each request
+	CSRFToken string
+	// Ctx stops the render between templates, yields, blocks and range
+	// iterations once it is cancelled, helpers can also use it for the
+	// values of the request. ExecuteContextWith sets it.
+	Ctx context.Context
+
+	// content appended and prepended to blocks
+	layers map[string][]blockLayer
+	// components being called, and the slots of those being rendered
+	components []*componentCall
+	slots      []map[string]RenderedBlock
+	// cache calls waiting for their end_cache
+	caches []pendingCache
+	// how far out in the chain of main, layouts and extended templates
+	// the template being rendered is, main is 1
+	depth int
+	// the templates, yields and blocks being rendered, how many of them
+	// are templates, and the steps taken since the render started
+	chain   []link
+	nested  int
+	steps   int
+	started time.Time
 
 	// Name of the parent template
 	parent string
@@ -56,11 +96,33 @@ type Context struct {
 	output *pouchWriter
 }
 
+// attach binds the context to a bound template clone, filling in any
+// maps a hand-built Context may be missing.
+func (c *Context) attach(tmpl *Template) {
+	tmpl.ctx = c
+	c.tmpl = tmpl
+	if c.Yields == nil {
+		c.Yields = make(map[string]string)
+	}
+	if c.Blocks == nil {
+		c.Blocks = make(map[string]RenderedBlock)
+	}
+	if c.output == nil {
+		c.output = newPouchWriter()
+	}
+	c.chain, c.nested = nil, 0
+	c.steps, c.started = 0, time.Now()
+	c.output.text = tmpl.IsText()
+	if tmpl.Sandbox != nil {
+		c.output.limit = tmpl.Sandbox.MaxOutput
+	}
+}
+
 func (c *Context) openableScope() bool {
 	canNest := !c.output.nesting()
 
 	hasParent := c.parent != ""
-	forthcomingLayout := c.Layout != "" && !c.executingLayout
+	forthcomingLayout := len(c.layouts()) > 0 && !c.executingLayout
 	inactiveView := strings.TrimSpace(c.output.root.String()) == ""
 	openableTemplate := hasParent || (forthcomingLayout && inactiveView)
 
@@ -68,43 +130,252 @@ func (c *Context) openableScope() bool {
 }
 
 func (c *Context) exec(name string, dot interface{}) (RenderedBlock, error) {
+	return c.execStep(ExecStep, name, dot)
+}
+
+// execStep is exec traced as the given step.
+func (c *Context) execStep(step Step, name string, dot interface{}) (RenderedBlock, error) {
+	if e := c.step(); e != nil {
+		return RenderedBlock{}, e
+	}
+	name = c.localized(name)
+	leave, e := c.enter(step, name)
+	defer leave()
+	if e != nil {
+		return RenderedBlock{}, e
+	}
+	defer c.trace(step, name)()
 	b := bytes.Buffer{}
 	// Replace the output buffer so we don't have stale data hanging around
 	// We need to have the rest of the context hanging around.
 	temp := c.output
-	c.output = newPouchWriter()
+	c.output = temp.fresh()
 
-	e := c.tmpl.ExecuteTemplate(&b, name, dot)
+	e = c.tmpl.ExecuteTemplate(&b, name, dot)
 	c.output = temp
-	return RenderedBlock{template.HTML(b.String()), HTML}, e
+	return RenderedBlock{template.HTML(b.String()), c.rendered()}, e
+}
+
+// streamPending reports whether blocks and yields that are not known yet
+// should be held, because the main template has not been rendered into
+// the streaming layout yet.
+func (c *Context) streamPending() bool {
+	return c.mainPending && c.output.stream != nil && !c.output.nesting()
 }
 
-func (c *Context) execWithFallback(name string, f fallback, dot interface{}) (RenderedBlock, error) {
+// renderPending renders the main template of a streaming layout if it
+// has not been rendered yet, then releases any output held waiting for
+// the blocks it defines.
+func (c *Context) renderPending() error {
+	if !c.mainPending {
+		return nil
+	}
+	c.mainPending = false
+	c.output.Flush()
+
+	// main is rendered as if the layout had not started, so its blocks
+	// can still be defined
+	c.executingLayout = false
+	e := c.renderInner()
+	c.executingLayout = true
+	if e != nil {
+		return e
+	}
+	return c.output.Release(c.resolveHeld)
+}
+
+// layouts returns the chain of layouts, from the innermost to the one
+// that is rendered last.
+func (c *Context) layouts() []string {
+	if c.Layout == "" {
+		return c.Layouts
+	}
+	return append(c.Layouts[:len(c.Layouts):len(c.Layouts)], c.Layout)
+}
+
+// renderInner renders the main template, then each layout but the last
+// around it, so the last layout can yield to the content of all of them.
+// Each of them is rendered like the main template, so blocks and
+// content_for can be claimed by any of them, and the first claim wins.
+func (c *Context) renderInner() error {
+	depth := c.depth
+	defer func() { c.depth = depth }()
+
+	var e error
+	c.depth = 1
+	c.mainContent, e = c.execStep(MainStep, c.Main, c.Dot)
+	layouts := c.layouts()
+	for i := 0; e == nil && i < len(layouts)-1; i++ {
+		c.depth = i + 2
+		c.mainContent, e = c.execStep(LayoutStep, layouts[i], c.Dot)
+	}
+	return e
+}
+
+// resolveHeld finds the content for a block that was held in a streaming
+// layout, preferring templates set for yields, then blocks.
+func (c *Context) resolveHeld(name string, fallback RenderedBlock) (RenderedBlock, error) {
+	if rb, ok, e := c.blockContent(name, c.Dot); ok {
+		return rb, e
+	}
+	return c.layered(name, fallback)
+}
+
+// blockContent finds the content for a yield or block, preferring the
+// template set for the yield, which is rendered with dot. ok is false if
+// neither is set.
+func (c *Context) blockContent(name string, dot interface{}) (rb RenderedBlock, ok bool, e error) {
 	if c.Yields[name] != "" {
-		return c.exec(c.Yields[name], dot)
+		rb, e = c.exec(c.Yields[name], dot)
+		ok = true
+	} else {
+		rb, ok = c.Blocks[name]
+	}
+	if ok && e == nil {
+		rb, e = c.layered(name, rb)
+	}
+	return rb, ok, e
+}
+
+// A blockLayer is content appended or prepended to a block, by the
+// template at depth.
+type blockLayer struct {
+	RenderedBlock
+	depth   int
+	prepend bool
+}
+
+// AppendBlock adds content to the end of a block, whether the block's
+// content comes from a template that claimed it or is the default
+// content of the block. Content appended in templates is added before
+// content appended here.
+func (c *Context) AppendBlock(name string, rb RenderedBlock) {
+	c.addLayer(name, blockLayer{RenderedBlock: rb, depth: c.depth})
+}
+
+// PrependBlock adds content to the start of a block, like AppendBlock.
+// Content prepended here is added before content prepended in templates.
+func (c *Context) PrependBlock(name string, rb RenderedBlock) {
+	c.addLayer(name, blockLayer{RenderedBlock: rb, depth: c.depth, prepend: true})
+}
+
+// superMarker is written where super_block is called in a block, it is
+// never written to the output.
+const superMarker template.HTML = "\x00super_block\x00"
+
+// claim saves the content of a block, unless it called super_block, in
+// which case the content before and after the call are prepended and
+// appended to the block instead, leaving it for a template further out.
+func (c *Context) claim(name string, rb RenderedBlock) {
+	before, after, ok := strings.Cut(string(rb.Content), string(superMarker))
+	if !ok {
+		c.Blocks[name] = rb
+		return
 	}
-	if rb, ok := c.Blocks[name]; ok {
+	after = strings.ReplaceAll(after, string(superMarker), "")
+	c.addLayer(name, blockLayer{RenderedBlock: RenderedBlock{template.HTML(before), rb.Type}, depth: c.depth, prepend: true})
+	c.addLayer(name, blockLayer{RenderedBlock: RenderedBlock{template.HTML(after), rb.Type}, depth: c.depth})
+}
+
+func (c *Context) addLayer(name string, bl blockLayer) {
+	if c.layers == nil {
+		c.layers = make(map[string][]blockLayer)
+	}
+	c.layers[name] = append(c.layers[name], bl)
+}
+
+// layered returns rb with the content appended and prepended to the
+// named block around it. Layers from templates further out in the chain
+// are closer to rb, like a call to super_block in each of them would be.
+func (c *Context) layered(name string, rb RenderedBlock) (RenderedBlock, error) {
+	layers := c.layers[name]
+	if len(layers) == 0 {
 		return rb, nil
 	}
-	return c.exec(string(f), dot)
+
+	var before, after []blockLayer
+	for _, bl := range layers {
+		if bl.prepend {
+			before = append(before, bl)
+		} else {
+			after = append(after, bl)
+		}
+	}
+	sort.SliceStable(before, func(i, j int) bool { return before[i].depth < before[j].depth })
+	sort.SliceStable(after, func(i, j int) bool { return after[i].depth > after[j].depth })
+
+	var content strings.Builder
+	rules := rb.Type
+	add := func(block RenderedBlock) error {
+		if block.Type != User {
+			if rules == User {
+				rules = block.Type
+			} else if !compatible(block.Type, rules) {
+				return &ContextError{Content: block.Content, Rendered: block.Type, Output: rules}
+			}
+		}
+		content.WriteString(string(block.Content))
+		return nil
+	}
+	for _, bl := range before {
+		if e := add(bl.RenderedBlock); e != nil {
+			return rb, e
+		}
+	}
+	add(RenderedBlock{Content: rb.Content})
+	for _, bl := range after {
+		if e := add(bl.RenderedBlock); e != nil {
+			return rb, e
+		}
+	}
+	return RenderedBlock{Content: template.HTML(content.String()), Type: rules}, nil
 }
 
 func (c *Context) Close(w io.Writer) error {
 	if c.parent != "" {
 		temp := c.parent
 		c.parent = ""
+		// each extended template is nested in the one extending it, so
+		// they leave the chain once the last one has rendered
+		var leaves []func()
+		defer func(depth int) {
+			for i := len(leaves) - 1; i >= 0; i-- {
+				leaves[i]()
+			}
+			c.depth = depth
+		}(c.depth)
 		for temp != "" {
-			c.output.Reset()
-			e := c.tmpl.Tmpl.ExecuteTemplate(c.output, temp, c.Dot)
+			if e := c.step(); e != nil {
+				return e
+			}
+			temp = c.localized(temp)
+			leave, e := c.enter(ExtendStep, temp)
+			leaves = append(leaves, leave)
 			if e != nil {
 				return e
 			}
+			c.depth++
+			c.parent = ""
+			c.output.Reset()
+			end := c.trace(ExtendStep, temp)
+			e = c.tmpl.run(c.output, temp, c.Dot)
+			end()
+			if e != nil {
+				return c.tmpl.execError(e)
+			}
 			temp = c.parent
 		}
 	}
 	if c.output.err != nil {
 		return c.output.err
 	}
+	if c.output.stream != nil {
+		if e := c.renderPending(); e != nil {
+			return e
+		}
+		c.output.Flush()
+		return c.output.err
+	}
 	_, e := io.WriteString(w, c.output.root.String())
 	return e
 }
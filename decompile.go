@@ -0,0 +1,194 @@
+package multitemplate
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template/parse"
+)
+
+// Decompile returns standard Go template source for a parse tree, using
+// the default {{ }} delimiters. Every language in multitemplate compiles
+// to the same parse trees, so this shows what a bham, terse or mustache
+// template turned into, and the source can be parsed again as a "tmpl"
+// template. Calls like yield, block and extend are kept as they are.
+func Decompile(tree *parse.Tree) string {
+	d := &decompiler{}
+	d.list(tree.Root)
+	return d.String()
+}
+
+// Decompile returns the source of the named template as standard Go
+// template source. Templates that were defined in the same source as it
+// are included as define actions after it.
+func (t *Template) Decompile(name string) (string, error) {
+	tree := t.lookupTree(name)
+	if tree == nil {
+		return "", fmt.Errorf("multitemplate: no template named %q", name)
+	}
+
+	src := Decompile(tree)
+	s, ok := t.sources[name]
+	if !ok {
+		return src, nil
+	}
+	var defined []string
+	for n, ns := range t.sources {
+		if n != name && ns == s {
+			defined = append(defined, n)
+		}
+	}
+	sort.Strings(defined)
+	for _, n := range defined {
+		if dt := t.lookupTree(n); dt != nil {
+			src += fmt.Sprintf("{{ define %s }}%s{{ end }}", strconv.Quote(n), Decompile(dt))
+		}
+	}
+	return src, nil
+}
+
+type decompiler struct {
+	strings.Builder
+}
+
+func (d *decompiler) list(n *parse.ListNode) {
+	if n == nil {
+		return
+	}
+	for _, c := range n.Nodes {
+		d.node(c)
+	}
+}
+
+func (d *decompiler) node(n parse.Node) {
+	switch n := n.(type) {
+	case *parse.ListNode:
+		d.list(n)
+	case *parse.TextNode:
+		d.text(string(n.Text))
+	case *parse.CommentNode:
+		d.WriteString("{{" + n.Text + "}}")
+	case *parse.ActionNode:
+		d.WriteString("{{ ")
+		d.pipe(n.Pipe)
+		d.WriteString(" }}")
+	case *parse.IfNode:
+		d.branch("if", &n.BranchNode)
+	case *parse.RangeNode:
+		d.branch("range", &n.BranchNode)
+	case *parse.WithNode:
+		d.branch("with", &n.BranchNode)
+	case *parse.TemplateNode:
+		d.WriteString("{{ template " + strconv.Quote(n.Name))
+		if n.Pipe != nil {
+			d.WriteString(" ")
+			d.pipe(n.Pipe)
+		}
+		d.WriteString(" }}")
+	case *parse.BreakNode:
+		d.WriteString("{{ break }}")
+	case *parse.ContinueNode:
+		d.WriteString("{{ continue }}")
+	default:
+		d.WriteString("{{ ")
+		d.arg(n)
+		d.WriteString(" }}")
+	}
+}
+
+// text writes text so that it won't be mistaken for an action, any {{ in
+// it, or a { that an action follows, is written as a string action.
+func (d *decompiler) text(s string) {
+	for {
+		i := strings.Index(s, "{{")
+		if i < 0 {
+			break
+		}
+		d.WriteString(s[:i])
+		d.WriteString(`{{ "{{" }}`)
+		s = s[i+2:]
+	}
+	if strings.HasSuffix(s, "{") {
+		d.WriteString(s[:len(s)-1])
+		d.WriteString(`{{ "{" }}`)
+		return
+	}
+	d.WriteString(s)
+}
+
+func (d *decompiler) branch(keyword string, n *parse.BranchNode) {
+	d.WriteString("{{ " + keyword + " ")
+	d.pipe(n.Pipe)
+	d.WriteString(" }}")
+	d.list(n.List)
+	if n.ElseList != nil && len(n.ElseList.Nodes) > 0 {
+		d.WriteString("{{ else }}")
+		d.list(n.ElseList)
+	}
+	d.WriteString("{{ end }}")
+}
+
+func (d *decompiler) pipe(n *parse.PipeNode) {
+	if n == nil {
+		return
+	}
+	for i, v := range n.Decl {
+		if i > 0 {
+			d.WriteString(", ")
+		}
+		d.arg(v)
+	}
+	if len(n.Decl) > 0 {
+		if n.IsAssign {
+			d.WriteString(" = ")
+		} else {
+			d.WriteString(" := ")
+		}
+	}
+	for i, c := range n.Cmds {
+		if i > 0 {
+			d.WriteString(" | ")
+		}
+		for j, arg := range c.Args {
+			if j > 0 {
+				d.WriteString(" ")
+			}
+			d.arg(arg)
+		}
+	}
+}
+
+func (d *decompiler) arg(n parse.Node) {
+	switch n := n.(type) {
+	case *parse.PipeNode:
+		d.WriteString("(")
+		d.pipe(n)
+		d.WriteString(")")
+	case *parse.ChainNode:
+		if _, ok := n.Node.(*parse.PipeNode); ok {
+			d.arg(n.Node)
+		} else {
+			d.WriteString("(")
+			d.arg(n.Node)
+			d.WriteString(")")
+		}
+		d.WriteString("." + strings.Join(n.Field, "."))
+	case *parse.StringNode:
+		d.WriteString(strconv.Quote(n.Text))
+	case *parse.FieldNode:
+		d.WriteString("." + strings.Join(n.Ident, "."))
+	case *parse.VariableNode:
+		d.WriteString(strings.Join(n.Ident, "."))
+	case *parse.IdentifierNode:
+		d.WriteString(n.Ident)
+	case *parse.NumberNode:
+		d.WriteString(n.Text)
+	case *parse.BoolNode:
+		d.WriteString(strconv.FormatBool(n.True))
+	case *parse.DotNode:
+		d.WriteString(".")
+	case *parse.NilNode:
+		d.WriteString("nil")
+	}
+}
@@ -0,0 +1,65 @@
+package multitemplate
+
+import (
+	"bytes"
+	"testing"
+	"text/template/parse"
+
+	. "github.com/acsellers/assert"
+)
+
+func TestDecompile(tst *testing.T) {
+	Within(tst, func(test *Test) {
+		t := parseSet(test, map[string]string{
+			"layout": `<html>{{ yield "head" (fallback "head") }}{{ yield }}</html>`,
+			"head":   `<title>{{ .Title | printf "%s!" }}</title>`,
+			"main": `{{ extend "layout" }}{{/* a comment */}}{{ define_block "head" }}<h1>{{ .Title }}</h1>{{ end_block }}
+{{ $n := len .Items }}{{ range $i, $v := .Items }}{{ if eq $i 1 }}{{ continue }}{{ end }}<li>{{ $v }}{{ "{{" }}</li>{{ else }}none{{ end }}
+{{ with .Title }}{{ . }}{{ else }}untitled{{ end }}{{ $n = 3 }}{{ (printf "%d" $n) }} { {{ template "sub" .Title }}{{ define "sub" }}<b>{{ . }}</b>{{ end }}`,
+		})
+		render := func(t *Template) string {
+			c := NewContext(map[string]interface{}{"Title": "Hi", "Items": []string{"a", "b", "c"}})
+			c.Main = "main"
+			b := bytes.Buffer{}
+			test.NoError(t.ExecuteContext(&b, c))
+			return b.String()
+		}
+
+		srcs := map[string]string{}
+		for _, name := range []string{"layout", "head", "main"} {
+			src, e := t.Decompile(name)
+			test.NoError(e)
+			srcs[name] = src
+		}
+		test.AreEqual(`<html>{{ yield "head" (fallback "head") }}{{ yield }}</html>`, srcs["layout"])
+		// the decompiled templates render just like the originals
+		test.AreEqual(render(t), render(parseSet(test, srcs)))
+
+		_, e := t.Decompile("missing")
+		test.IsError(e)
+	})
+}
+
+func TestDecompileBuiltTree(tst *testing.T) {
+	Within(tst, func(test *Test) {
+		// parsers may leave Quoted unset when they build string nodes
+		tree := NewTree("built", "")
+		tree.Root.Nodes = append(tree.Root.Nodes,
+			&parse.TextNode{NodeType: parse.NodeText, Text: []byte("a{")},
+			&parse.ActionNode{
+				NodeType: parse.NodeAction,
+				Pipe: &parse.PipeNode{
+					NodeType: parse.NodePipe,
+					Cmds: []*parse.CommandNode{{
+						NodeType: parse.NodeCommand,
+						Args: []parse.Node{
+							&parse.IdentifierNode{NodeType: parse.NodeIdentifier, Ident: "yield"},
+							&parse.StringNode{NodeType: parse.NodeString, Quoted: "side", Text: "side"},
+						},
+					}},
+				},
+			},
+		)
+		test.AreEqual(`a{{ "{" }}{{ yield "side" }}`, Decompile(tree))
+	})
+}
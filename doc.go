@@ -43,6 +43,194 @@ to define Layouts to be executed. The Main template should set up content
 that can then be yielded using the Main template. Yielding without a name
 will cause the main template's content to be output.
 
+Layouts can be nested by listing them in the Layouts field of a Context,
+innermost first, with Layout (if set) wrapped around all of them. Each
+layout in the chain yields the content of the one inside it, and blocks
+and content_for calls made anywhere in the chain follow the same rules as
+for a single layout, the first template to claim a block wins.
+
+  ctx.Layouts = []string{"layouts/admin.html", "layouts/site.html"}
+  ctx.Layout = "layouts/shell.html"
+
+Concurrency
+
+A Template that has finished parsing may be shared by every goroutine in
+your program. Each render borrows a copy of the template set that has its
+yield and block functions bound to that render's Context, and returns it
+to the Template once the render is done, so copies are only made when
+more renders are running at once than there are idle copies. Parsing new
+templates or adding functions while renders are running is not safe, and
+throws away the idle copies.
+
+Streaming
+
+Normally a layout and its main template are rendered completely before
+anything is written. Setting Stream on a Context writes the layout as it
+executes instead, so the top of the page can reach the browser while the
+main template is still rendering. The main template is rendered when the
+layout first yields to it, and output after any yield or block the main
+template hasn't defined yet is held back until it has been rendered. If
+the writer is an http.Flusher, it is flushed before output is held and
+again when it is released.
+
+Tracing
+
+Setting a Tracer on a Context tells it when each step of the render
+starts and ends: the main template, each layout, extended templates, and
+calls to yield, exec, block and exec_block, with partials and components
+traced as exec steps. Steps are nested, and the outermost layout contains
+the rest of the render. A TraceTree collects the steps, and prints them as
+a tree with the time each took and its share of the whole render. A
+RuntimeTracer marks each step as a runtime/trace region, so renders can be
+seen in go tool trace.
+
+  tree := &multitemplate.TraceTree{}
+  ctx.Tracer = tree
+  templates.ExecuteContext(writer, ctx)
+  log.Print(tree)
+
+Cancellation
+
+ExecuteContextWith and ExecuteTemplateWith take a context.Context, and
+stop rendering once it is cancelled or its deadline passes, so a render
+for a client that has gone away doesn't run to the end. It is checked
+before each template, yield, block and extended template, and at the
+start of each iteration of a range. The error returned wraps the error of
+the context.Context, so errors.Is(err, context.Canceled) finds it. The
+context.Context is kept in the Ctx field of the Context, where helpers
+can reach it, and the checkpoint function checks it from a template.
+
+  templates.ExecuteContextWith(request.Context(), writer, ctx)
+
+Sandboxes
+
+Templates written by the users of a site, like customised emails, can be
+limited by setting a Sandbox on the Template before they are parsed. Only
+the functions in its Funcs and the builtin functions of text/template can
+be called, so the functions for yields and blocks need to be listed if
+the templates use them. It can also limit how deeply templates are nested
+by exec, yield and extend, how many bytes are written, and how many steps
+and how long a render may take. A render that breaks a limit stops with a
+*SandboxError naming the limit.
+
+  templates := multitemplate.New("emails")
+  templates.Sandbox = &multitemplate.Sandbox{
+    Funcs:     []string{"yield", "t", "number_to_currency"},
+    MaxDepth:  8,
+    MaxOutput: 1 << 20,
+    Timeout:   time.Second,
+  }
+
+Errors
+
+Errors from parsing and executing templates are returned as an *Error,
+which has the name of the template, the file it was parsed from, the
+line and column of the error, and that line of the source, whichever
+language the template was written in. Errors from a template executed
+for a yield or block keep the position in that template, so use
+errors.As to find them.
+
+Escaping contexts
+
+Blocks remember the html/template escaping context they were rendered in,
+which is one of the Ruleset constants: text, RCDATA like a title, quoted and
+unquoted attributes, URLs, srcsets, CSS and CSS strings, and JavaScript
+values, strings, template literals and regular expressions. A block can be
+output in the context it was rendered in, or in one that is escaped at least
+as strictly, so a block rendered in an attribute can be output as text or in
+a textarea, and a JavaScript template literal can be output in a JavaScript
+string. Text can also be output in a title. Anything else returns a
+*ContextError naming both contexts. Blocks set on a Context with the User
+Ruleset are trusted wherever they are output.
+
+Text templates
+
+Emails, CSV exports and config files that aren't HTML can be rendered with
+a Template from NewText, which uses text/template instead, so nothing is
+escaped and blocks can be output anywhere. Layouts, yields, blocks and the
+parsers all work the same way. AsText copies an HTML Template set, so the
+same templates can render both parts of an email.
+
+  text, err := templates.AsText()
+  text.ExecuteContext(writer, ctx)
+
+Emails
+
+A Mailer renders the .html and .txt variants of a template, in whichever
+languages they were written, as the parts of an email. Both parts use the
+layouts and yields of the Context, picking their .html or .txt variants
+when there are some. The rules of style elements in the HTML part are
+moved into style attributes for mail clients that ignore them, and the
+Email writes a multipart/alternative body ready to send.
+
+  mailer, err := multitemplate.NewMailer(templates)
+  ctx := multitemplate.NewContext(user)
+  ctx.Layout = "layouts/mail"
+  email, err := mailer.Render("mail/welcome", ctx)
+  email.WriteTo(writer)
+
+Loading templates
+
+A Loader parses every template in an fs.FS, such as an embed.FS, a zip
+archive or os.DirFS, and ParseFS parses the files matching glob patterns.
+Templates are named by their path without the parser's extension, so
+"app/index.html.bham" is named "app/index.html". The other extensions are
+kept in the order they're written, so "a.min.js.tmpl" is named "a.min.js".
+Older versions reversed them, naming it "a.js.min", so look templates like
+that up by their new names. The integrations use a Loader for each of
+their template directories.
+
+Reloading templates
+
+A Registry keeps a Template loaded from file systems up to date. Reload
+parses only the files that changed, and the files using templates from
+them, then swaps in the new Template. Watch calls Reload on an interval.
+When a reload fails the last good Template is kept, and Err returns the
+error until the templates are fixed. The integrations use a Registry, so
+they all reload the same way.
+
+Checking references
+
+Names given to extend, exec, content_for and fallback are only looked up
+when a template executes. Dependencies lists the templates each template
+extends and executes, the names it yields to and the blocks it declares,
+as far as they are written as strings. Check uses those lists to report
+references to missing templates, and templates that extend themselves,
+as errors at the reference. Names that are only known when the template
+executes, like yields set on the Context, can't be checked. Loaders and
+Registries that are Strict run Check once the templates are loaded, a
+Strict Registry keeps the last Template that passed until a reload does.
+
+TypeCheck goes further for a template that is always given the same type
+of data. Given that type, it follows the fields, methods and functions
+the template uses through with, range, variables, and the templates it
+runs with exec, template, extend or a yield fallback. Unknown fields,
+unexported fields and calls with the wrong number of arguments are
+reported the same way as Check reports problems. Values typed as
+interfaces aren't checked.
+
+Decompiling
+
+Every language compiles to the same text/template parse trees, and
+Decompile turns a tree back into standard Go template source, keeping
+calls like yield, block and extend. Template.Decompile does the same for
+a template by name, along with the templates defined in its source. The
+output parses again as a "tmpl" template, so it shows what a bham, terse
+or mustache template does, and is a way to move templates off a
+language.
+
+Bundles
+
+WriteBundle generates a Go package with a Bundle of every template in a
+set, kept as decompiled source along with the names of the functions
+they call. The package parses the templates when it is initialized, so
+neither the source files nor the language parsers are needed at runtime.
+Bundle.Load adds the templates to a Template, after checking that it has
+every function they call. Errors from bundled templates give the line
+and column in the decompiled source, so their file is labelled as
+decompiled. The multitemplate command's bundle subcommand writes the
+package for a template directory.
+
 Integrations
 
 While multitemplate is available to use as a library in all
@@ -185,6 +373,96 @@ layouts/main.html
     </body>
   </html>
 
+Caching fragments
+
+The cache function stores the output of a fragment in the Cache set on the Context,
+so later renders can output it without rendering it again. NewLRUCache keeps a number
+of fragments in memory, and NewFileCache keeps them in files in a directory. Other
+stores can be used by implementing the Cache interface. Fragments are stored with
+the escaping context they were rendered in, and outputting one in a different
+context is an error, the same as for blocks.
+
+Given a key and the name of a template, cache outputs the template, only rendering
+it if it isn't in the cache. The data for the template comes after its name, and
+defaults to the Dot of the Context.
+
+  {{ cache "footer" "shared/footer.html" . }}
+  {{ cache (printf "tile-%d" .Product.ID) "products/tile.html" .Product (expires_in "10m") }}
+
+Without a template name, cache stores everything up to end_cache, and reports whether
+that content needs to be rendered, so it is used with if. When the fragment is in the
+cache, the content is skipped and end_cache outputs the fragment instead, so blocks
+defined or appended to in the content are only set when it is rendered.
+
+  {{ if cache "nav" }}<nav>{{ .Nav }}</nav>{{ end }}{{ end_cache }}
+
+expires_in takes a duration string like "10m", or a number of seconds. Without it,
+fragments are kept for the CacheTTL of the Context, and a CacheTTL of zero keeps
+them until the Cache throws them away. Without a Cache, fragments are rendered every
+time.
+
+Components
+
+Components are templates that can be reused with different content, like a card or
+a modal dialog. A component declares slots with yield_slot, and the template calling
+it fills them in with slot and end_slot. Content outside of any slot fills in the
+unnamed slot, which is output by yield_slot without a name. Slots only exist for the
+one call of the component, so they never claim blocks, and has_slot tells whether
+the caller filled a slot in. The data for the component is passed like
+render_partial, with any locals merged over it.
+
+components/card.html
+  <div class="card">
+    {{ if has_slot "header" }}<header>{{ yield_slot "header" }}</header>{{ end }}
+    {{ yield_slot }}
+  </div>
+
+users/show.html
+  {{ component "components/card.html" . (locals "Class" "user") }}
+    {{ slot "header" }}<h2>{{ .User.Name }}</h2>{{ end_slot }}
+    <p>{{ .User.Bio }}</p>
+  {{ end_component }}
+
+Terse and bham call components with a line starting with +, followed by the name
+of the component and its data (dot if it is left out), with the slots as lines
+starting with +: nested in it.
+
+  +components/card.html .
+    +:header
+      h2= .User.Name
+    p= .User.Bio
+
+Translations
+
+The t function, and its longer name translate, looks up a message in the Catalog set
+on the Context for the Locale of the Context. Messages missing from a locale like
+"fr-CA" are looked up in "fr", then the Fallback locale of the Catalog, and a message
+missing from all of them is an error. The arguments after the key are pairs of names
+and values, each replacing %{name} in the message. A value named count picks the
+plural form of the message with the PluralRules of the locale. Messages with keys
+ending in _html or .html are output without escaping, with the values put in them
+escaped instead.
+
+  <h1>{{ t "users.title" }}</h1>
+  <p>{{ t "users.count" "count" (len .Users) }}</p>
+  <p>{{ t "users.welcome_html" "name" .User.Name }}</p>
+
+Catalogs are loaded from JSON and YAML files with a locale at the top level and
+messages nested under it, and from gettext .po files, with LoadFile or LoadGlob.
+Messages with plural forms have a key for each category the locale uses.
+
+  fr:
+    users:
+      title: Utilisateurs
+      count:
+        one: "%{count} utilisateur"
+        other: "%{count} utilisateurs"
+
+The Locale of the Context also picks between templates. A template named with the
+locale before its format, like users/show.fr.html from users/show.fr.html.terse, is
+rendered in place of users/show.html for the main template, layouts, yields, partials
+and extended templates, and locale returns the Locale in a template.
+
 Functions Reference
 
 yield allows for rendering template aliases or simply rendering nothing. Rendering
@@ -241,6 +519,22 @@ of that key. Keys are claimed by the first block to render to them.
 
 end_block ends the content are started by block
 
+append_block and prepend_block add content to the end or start of a block, without
+claiming it. The content is added around whatever the block ends up with, whether
+that's the block's own content in the layout, or content from a block that claimed
+it. Context has AppendBlock and PrependBlock functions to do the same from Go.
+
+  {{ append_block "scripts" }}
+    <script src="/js/users.js"></script>
+  {{ end_block }}
+
+super_block outputs the content the block would have had without the block it is
+called in, so a block can add to the layout's content instead of replacing it. When
+layouts are nested, content added by a layout further out is closer to the
+layout's content.
+
+  {{ define_block "title" }}Users | {{ super_block }}{{ end_block }}
+
 extend marks that the current template is made up of blocks that will be executed
 in the context of another template. Template inheritence can be carried to arbitrary
 levels, you are not limited to using extend only once in template execution.
@@ -255,6 +549,23 @@ exec execute an arbitrary template with the passed name and data
 
   {{ exec .Header.Path . }}
 
+render_partial executes a template like exec, with named values from locals merged
+over the data. The fields of a struct or the entries of a map are copied into a new
+map along with the locals, any other data can be found under Dot. Without locals the
+template gets the data unchanged.
+
+  {{ render_partial "users/row.html" .User (locals "Class" "current") }}
+
+render_collection executes a template once for each element of a slice or array,
+merging any locals over each element. spacer_template names a template to execute
+between elements, and empty_template one to execute in place of a collection
+without any elements.
+
+  {{ render_collection "users/row.html" .Users (spacer_template "users/divider.html") (empty_template "users/none.html") }}
+
+Partials are always HTML, like templates run with exec, so they can't be output in
+a script or style element.
+
 fallback sets a specific template to be rendered in the case that a yield call finds
 that there is no content set for the key of the yield.
 
@@ -273,8 +584,10 @@ named in the Yields map. Within the templates, the rule is the first to claim th
 wins. Any integrations that hide the Context, will operate under the assumption that the
 last claim before template execution should win.
 
-Getting an error about a stack overflow during template execution is most likely a
-template that is yielding itself.
+Templates that yield to, extend or exec each other in a loop return a *LoopError with the
+chain of templates, yields and blocks that led back around, like
+layouts/main -> yield "content" -> app/index -> extend layouts/main. A template may exec
+itself, say for a tree of comments, as long as it stops before it is nested MaxDepth deep.
 
 The block function has two related functions, define_block and exec_block. If you need
 to define a block, even when it would normally execute the block (for instance, if you
@@ -0,0 +1,190 @@
+package multitemplate
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+)
+
+// A Mailer renders emails from the .html and .txt variants of templates,
+// like "mail/welcome.html.bham" and "mail/welcome.txt.tmpl", with the HTML
+// variants rendered by an HTML Template and the text variants by a text
+// copy of it.
+type Mailer struct {
+	HTML *Template
+	Text *Template
+}
+
+// NewMailer returns a Mailer for the templates of t, which should have
+// all its templates parsed, as they are copied for the text variants.
+func NewMailer(t *Template) (*Mailer, error) {
+	text, e := t.AsText()
+	if e != nil {
+		return nil, e
+	}
+	return &Mailer{HTML: t, Text: text}, nil
+}
+
+// An Email is the rendered parts of a message. Either part may be empty,
+// but not both.
+type Email struct {
+	// HTML is the HTML part, with the CSS of its style elements inlined
+	HTML string
+	// Text is the plain text part
+	Text string
+	// Boundary separates the parts of the body
+	Boundary string
+}
+
+// Render renders the .html and .txt variants of name, so "mail/welcome"
+// renders "mail/welcome.html" and "mail/welcome.txt", with the Locale of
+// ctx picking localized variants as usual. The layouts and yields of ctx
+// are used for both parts, with their .html and .txt variants when the
+// templates have them, so a Layout of "layouts/mail" is rendered as
+// "layouts/mail.html" for the HTML part. Each part is rendered with its
+// own copy of ctx, so blocks from one part don't end up in the other.
+// The Cache of ctx is only used for the HTML part, as the keys of cached
+// fragments don't say which part they are for.
+func (m *Mailer) Render(name string, ctx *Context) (*Email, error) {
+	email := &Email{Boundary: multipart.NewWriter(ioutil.Discard).Boundary()}
+	parts := []struct {
+		tmpl *Template
+		ext  string
+		body *string
+	}{
+		{m.HTML, "html", &email.HTML},
+		{m.Text, "txt", &email.Text},
+	}
+
+	found := false
+	for _, part := range parts {
+		main, ok := ctx.variant(part.tmpl, name, part.ext)
+		if !ok {
+			continue
+		}
+		found = true
+		pc := ctx.part(part.tmpl, part.ext)
+		pc.Main = main
+		if part.ext != "html" {
+			pc.Cache = nil
+		}
+		b := bytes.Buffer{}
+		if e := part.tmpl.ExecuteContext(&b, pc); e != nil {
+			return nil, e
+		}
+		*part.body = b.String()
+	}
+	if !found {
+		return nil, fmt.Errorf("multitemplate: no %s.html or %s.txt template for an email", name, name)
+	}
+	if email.HTML != "" {
+		email.HTML = InlineCSS(email.HTML)
+	}
+	return email, nil
+}
+
+// variant returns the name of the ext variant of a template, and whether
+// the template set has it, in any locale of the Context.
+func (c *Context) variant(t *Template, name, ext string) (string, bool) {
+	v := name + "." + ext
+	if t.defined(v) {
+		return v, true
+	}
+	for _, l := range localeChain(c.Locale, "") {
+		if t.defined(localizedName(v, l)) {
+			return v, true
+		}
+	}
+	return name, false
+}
+
+// part copies the Context for the ext part of an email, using the ext
+// variants of its layouts and yields.
+func (c *Context) part(t *Template, ext string) *Context {
+	pc := NewContext(c.Dot)
+	if c.Layout != "" {
+		pc.Layout, _ = c.variant(t, c.Layout, ext)
+	}
+	for _, l := range c.Layouts {
+		l, _ = c.variant(t, l, ext)
+		pc.Layouts = append(pc.Layouts, l)
+	}
+	for k, v := range c.Yields {
+		pc.Yields[k], _ = c.variant(t, v, ext)
+	}
+	for k, v := range c.Blocks {
+		pc.Blocks[k] = v
+	}
+	pc.Cache, pc.CacheTTL = c.Cache, c.CacheTTL
+	pc.Tracer = c.Tracer
+	pc.Locale, pc.Catalog = c.Locale, c.Catalog
+	pc.CSRFToken = c.CSRFToken
+	pc.Ctx = c.Ctx
+	return pc
+}
+
+// ContentType is the Content-Type header of the body written by WriteTo.
+func (e *Email) ContentType() string {
+	return mime.FormatMediaType("multipart/alternative", map[string]string{"boundary": e.Boundary})
+}
+
+// WriteTo writes the MIME-Version and Content-Type headers of the email
+// and its multipart/alternative body, with each part quoted-printable
+// encoded. The text part comes first, since mail clients show the last
+// part they can. The From, To and Subject headers should be written
+// before it.
+func (e *Email) WriteTo(w io.Writer) (int64, error) {
+	cw := &countWriter{w: w}
+	_, err := fmt.Fprintf(cw, "MIME-Version: 1.0\r\nContent-Type: %s\r\n\r\n", e.ContentType())
+	mw := multipart.NewWriter(cw)
+	if err == nil {
+		err = mw.SetBoundary(e.Boundary)
+	}
+	for _, part := range []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", e.Text},
+		{"text/html; charset=utf-8", e.HTML},
+	} {
+		if err != nil || part.body == "" {
+			continue
+		}
+		var pw io.Writer
+		pw, err = mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err == nil {
+			qw := quotedprintable.NewWriter(pw)
+			if _, err = io.WriteString(qw, part.body); err == nil {
+				err = qw.Close()
+			}
+		}
+	}
+	if err == nil {
+		err = mw.Close()
+	}
+	return cw.n, err
+}
+
+// Bytes returns what WriteTo writes, for smtp.SendMail after the other
+// headers of the message.
+func (e *Email) Bytes() ([]byte, error) {
+	b := bytes.Buffer{}
+	_, err := e.WriteTo(&b)
+	return b.Bytes(), err
+}
+
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
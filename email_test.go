@@ -0,0 +1,117 @@
+package multitemplate
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"testing"
+
+	. "github.com/acsellers/assert"
+)
+
+func TestInlineCSS(t *testing.T) {
+	Within(t, func(test *Test) {
+		inlineTests := []struct {
+			Doc      string
+			Expected string
+		}{
+			{
+				`<style>p { color: red }</style><p>Hi</p>`,
+				`<p style="color: red">Hi</p>`,
+			},
+			{
+				`<style>.note { color: red; margin: 0 } p.note { color: blue }</style><p class="big note" style="margin: 4px">Hi</p>`,
+				`<p class="big note" style="color: blue; margin: 4px">Hi</p>`,
+			},
+			{
+				`<style>#main a { color: red } a { color: blue !important } td > a[href] { font-family: "Helvetica" }</style><div id="main"><table><td><a href="/">Home</a></td></table></div><a>Out</a>`,
+				`<div id="main"><table><td><a href="/" style="font-family: &#34;Helvetica&#34;; color: blue">Home</a></td></table></div><a style="color: blue">Out</a>`,
+			},
+			{
+				`<head><style>body { margin: 0 } a:hover { color: red } @media (max-width: 600px) { body { margin: 4px } }</style></head><body><br/></body>`,
+				"<head><style>\na:hover { color: red }\n@media (max-width: 600px) { body { margin: 4px } }\n</style></head><body style=\"margin: 0\"><br/></body>",
+			},
+			{
+				`<style media="print">p { color: red }</style><p>Hi</p>`,
+				`<style media="print">p { color: red }</style><p>Hi</p>`,
+			},
+			{
+				`<p>No styles</p>`,
+				`<p>No styles</p>`,
+			},
+		}
+		for _, it := range inlineTests {
+			test.AreEqual(it.Expected, InlineCSS(it.Doc))
+		}
+	})
+}
+
+func TestEmail(t *testing.T) {
+	Within(t, func(test *Test) {
+		tmpl := New("mail")
+		for name, src := range map[string]string{
+			"layouts/mail.html":   `<html><head><style>p { color: #333 }</style></head><body>{{ yield }}</body></html>`,
+			"layouts/mail.txt":    "{{ yield }}\n-- The Shop",
+			"mail/welcome.html":   `<p>Welcome {{ .Name }}</p>`,
+			"mail/welcome.txt":    `Welcome {{ .Name }}`,
+			"mail/reminder.txt":   `Don't forget, {{ .Name }}`,
+			"mail/welcome.fr.txt": `Bienvenue {{ .Name }}`,
+		} {
+			var e error
+			tmpl, e = tmpl.Parse(name, src, "tmpl")
+			test.NoError(e)
+		}
+		mailer, e := NewMailer(tmpl)
+		test.NoError(e)
+
+		ctx := NewContext(map[string]string{"Name": "Tom & Jerry"})
+		ctx.Layout = "layouts/mail"
+		email, e := mailer.Render("mail/welcome", ctx)
+		test.NoError(e)
+		if email != nil {
+			test.AreEqual(`<html><head></head><body><p style="color: #333">Welcome Tom &amp; Jerry</p></body></html>`, email.HTML)
+			test.AreEqual("Welcome Tom & Jerry\n-- The Shop", email.Text)
+
+			b, e := email.Bytes()
+			test.NoError(e)
+			msg, e := mail.ReadMessage(bytes.NewReader(b))
+			test.NoError(e)
+			media, params, e := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+			test.NoError(e)
+			test.AreEqual("multipart/alternative", media)
+
+			parts := []string{}
+			mr := multipart.NewReader(msg.Body, params["boundary"])
+			for p, e := mr.NextRawPart(); e == nil; p, e = mr.NextRawPart() {
+				body, _ := ioutil.ReadAll(quotedprintable.NewReader(p))
+				parts = append(parts, p.Header.Get("Content-Type")+" "+string(body))
+			}
+			test.AreEqual(2, len(parts))
+			if len(parts) == 2 {
+				// line breaks are sent as CRLF
+				test.AreEqual("text/plain; charset=utf-8 Welcome Tom & Jerry\r\n-- The Shop", parts[0])
+				test.AreEqual("text/html; charset=utf-8 "+email.HTML, parts[1])
+			}
+		}
+
+		email, e = mailer.Render("mail/reminder", ctx)
+		test.NoError(e)
+		if email != nil {
+			test.AreEqual("", email.HTML)
+			test.AreEqual("Don't forget, Tom & Jerry\n-- The Shop", email.Text)
+		}
+
+		ctx.Locale = "fr"
+		email, e = mailer.Render("mail/welcome", ctx)
+		test.NoError(e)
+		if email != nil {
+			test.AreEqual("Bienvenue Tom & Jerry\n-- The Shop", email.Text)
+		}
+
+		_, e = mailer.Render("mail/missing", ctx)
+		test.IsError(e)
+	})
+}
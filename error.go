@@ -0,0 +1,153 @@
+package multitemplate
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// An Error is a parse or execution error that has been traced back to the
+// source of the template it happened in. Line and Column start at 1, and
+// are 0 when they aren't known.
+type Error struct {
+	// Name of the template, as given to Parse
+	Name string
+	// File the template was read from, if it was read from a file
+	File string
+	// Line and Column in the source of the template
+	Line   int
+	Column int
+	// Excerpt is the line of source the error happened on
+	Excerpt string
+	// Parser is the extension of the parser for the template, like terse
+	Parser string
+	// Err is the underlying error
+	Err error
+}
+
+// NewError returns an Error for err, located at the byte offset pos of
+// src. Parsers should use it for the errors they return from
+// ParseTemplate. If err came from text/template parsing a snippet of src,
+// the location text/template gave for the snippet is dropped.
+func NewError(src string, pos int, err error) *Error {
+	if pos < 0 {
+		pos = 0
+	}
+	if pos > len(src) {
+		pos = len(src)
+	}
+	if m := snippetLocation.FindStringSubmatch(err.Error()); m != nil {
+		err = errors.New(m[1])
+	}
+	start := strings.LastIndex(src[:pos], "\n") + 1
+	line := 1 + strings.Count(src[:pos], "\n")
+	return &Error{
+		Line:    line,
+		Column:  1 + pos - start,
+		Excerpt: excerpt(src, line),
+		Err:     err,
+	}
+}
+
+func (e *Error) Error() string {
+	loc := e.Name
+	if e.File != "" {
+		loc = e.File
+	}
+	if e.Line > 0 {
+		loc += ":" + strconv.Itoa(e.Line)
+		if e.Column > 0 {
+			loc += ":" + strconv.Itoa(e.Column)
+		}
+	}
+	if e.Parser != "" {
+		return fmt.Sprintf("%s: %s: %s", e.Parser, loc, e.Err)
+	}
+	return fmt.Sprintf("%s: %s", loc, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+var (
+	snippetLocation = regexp.MustCompile(`^template: [^:]*:\d+(?::\d+)?: (.*)$`)
+	execLocation    = regexp.MustCompile(`^template: ([^:]*):(\d+):(\d+): `)
+)
+
+// excerpt returns the given line of src, counting from 1.
+func excerpt(src string, line int) string {
+	lines := strings.Split(src, "\n")
+	if line < 1 || line > len(lines) {
+		return ""
+	}
+	return strings.TrimRight(lines[line-1], "\r")
+}
+
+// source records where a template came from, so that errors can be
+// traced back to it.
+type source struct {
+	// name the source was parsed as, templates defined in it have their
+	// own names
+	name   string
+	file   string
+	src    string
+	parser string
+}
+
+// parseError fills in the details of a parse error that the parser
+// can't know about.
+func parseError(name string, s source, err error) *Error {
+	e, ok := err.(*Error)
+	if !ok {
+		e = &Error{Err: err}
+	}
+	if e.Name == "" {
+		e.Name = name
+	}
+	if e.File == "" {
+		e.File = s.file
+	}
+	if e.Parser == "" {
+		e.Parser = s.parser
+	}
+	if e.Excerpt == "" {
+		e.Excerpt = excerpt(s.src, e.Line)
+	}
+	return e
+}
+
+// execError traces an error from executing a template back to the
+// template source it happened in. Errors that already carry an Error,
+// like those from a yield or block, are returned as they are.
+func (t *Template) execError(err error) error {
+	var e *Error
+	if err == nil || errors.As(err, &e) {
+		return err
+	}
+
+	var name string
+	var line, col int
+	var he *template.Error
+	if errors.As(err, &he) {
+		name, line = he.Name, he.Line
+	} else if m := execLocation.FindStringSubmatch(err.Error()); m != nil {
+		name = m[1]
+		line, _ = strconv.Atoi(m[2])
+		col, _ = strconv.Atoi(m[3])
+		col++
+	} else {
+		return err
+	}
+
+	e = &Error{Name: name, Line: line, Column: col, Err: err}
+	if s, ok := t.sources[name]; ok {
+		e.File = s.file
+		e.Parser = s.parser
+		e.Excerpt = excerpt(s.src, line)
+	}
+	return e
+}
@@ -0,0 +1,85 @@
+package multitemplate
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/acsellers/assert"
+)
+
+func TestParseError(t *testing.T) {
+	Within(t, func(test *Test) {
+		tmpl := New("errors")
+		_, e := tmpl.Parse("broken", "<p>\n{{ .Name }}\n{{ if }}</p>", "tmpl")
+		test.IsError(e)
+
+		var me *Error
+		test.AreEqual(true, errors.As(e, &me))
+		test.AreEqual("broken", me.Name)
+		test.AreEqual("tmpl", me.Parser)
+		test.AreEqual(3, me.Line)
+		test.AreEqual("{{ if }}</p>", me.Excerpt)
+		test.AreEqual("tmpl: broken:3: missing value for if", e.Error())
+	})
+}
+
+func TestParseFileError(t *testing.T) {
+	Within(t, func(test *Test) {
+		dir, e := ioutil.TempDir("", "multitemplate")
+		test.NoError(e)
+		defer os.RemoveAll(dir)
+
+		file := filepath.Join(dir, "broken.html.tmpl")
+		test.NoError(ioutil.WriteFile(file, []byte("<p>{{ end }}</p>"), 0644))
+
+		_, e = New(dir).ParseFiles(file)
+		var me *Error
+		test.AreEqual(true, errors.As(e, &me))
+		test.AreEqual("broken.html", me.Name)
+		test.AreEqual(file, me.File)
+		test.AreEqual(1, me.Line)
+	})
+}
+
+func TestExecuteError(t *testing.T) {
+	Within(t, func(test *Test) {
+		tmpl := New("errors")
+		var e error
+		tmpl, e = tmpl.Parse("layout", `<html>{{ yield "side" }}</html>`, "tmpl")
+		test.NoError(e)
+		tmpl, e = tmpl.Parse("side", "<aside>\n  {{ index .List 3 }}</aside>", "tmpl")
+		test.NoError(e)
+		tmpl, e = tmpl.Parse("main", `{{ content_for "side" "side" }}`, "tmpl")
+		test.NoError(e)
+
+		c := NewContext(map[string][]string{"List": []string{"a"}})
+		c.Main = "main"
+		c.Layout = "layout"
+		b := bytes.Buffer{}
+		e = tmpl.ExecuteContext(&b, c)
+		test.IsError(e)
+
+		var me *Error
+		test.AreEqual(true, errors.As(e, &me))
+		test.AreEqual("side", me.Name)
+		test.AreEqual("tmpl", me.Parser)
+		test.AreEqual(2, me.Line)
+		test.AreEqual(6, me.Column)
+		test.AreEqual("  {{ index .List 3 }}</aside>", me.Excerpt)
+	})
+}
+
+func TestNewError(t *testing.T) {
+	Within(t, func(test *Test) {
+		src := "first\nsecond line\nthird"
+		e := NewError(src, 13, errors.New("template: mule:1: bad code"))
+		test.AreEqual(2, e.Line)
+		test.AreEqual(8, e.Column)
+		test.AreEqual("second line", e.Excerpt)
+		test.AreEqual("bad code", e.Err.Error())
+	})
+}
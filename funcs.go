@@ -1,79 +1,110 @@
 package multitemplate
 
-import "html/template"
+import (
+	"fmt"
+	"html/template"
+	"time"
+)
 
 func generateFuncs(t *Template) template.FuncMap {
-	return template.FuncMap{
-		"may_yield": func(name string) bool {
+	funcs := template.FuncMap{
+		"may_yield": func(name string) (bool, error) {
+			if e := t.ctx.renderPending(); e != nil {
+				return false, e
+			}
 			if _, ok := t.ctx.Yields[name]; ok {
-				return true
+				return true, nil
 			}
 			_, ok := t.ctx.Blocks[name]
-			return ok
+			return ok || len(t.ctx.layers[name]) > 0, nil
 		},
-		"yield": func(vals ...interface{}) (string, error) {
-			var e error
-			switch len(vals) {
-			case 0:
+		"yield": func(vals ...interface{}) (template.HTML, error) {
+			if e := t.ctx.step(); e != nil {
+				return "", e
+			}
+			if len(vals) == 0 {
+				if e := t.ctx.renderPending(); e != nil {
+					return "", e
+				}
 				t.ctx.output.Immediate(t.ctx.mainContent)
-				return "<\"'.", nil
-			case 1:
-				if name, ok := vals[0].(string); ok {
-					if t.ctx.Yields[name] != "" {
-						rb, e := t.ctx.exec(t.ctx.Yields[name], t.ctx.Dot)
+				return sentinel, nil
+			}
+
+			name, ok := vals[0].(string)
+			if ok {
+				leave, e := t.ctx.enter(YieldStep, name)
+				defer leave()
+				if e != nil {
+					return "", e
+				}
+				defer t.ctx.trace(YieldStep, name)()
+			}
+			if len(vals) == 1 {
+				if ok {
+					if rb, ok, e := t.ctx.blockContent(name, t.ctx.Dot); ok {
 						t.ctx.output.Immediate(rb)
-						if e != nil {
-							return "<\"'.", e
-						}
+						return sentinel, e
+					}
+					if t.ctx.streamPending() {
+						t.ctx.output.Defer(name, RenderedBlock{})
+						return sentinel, nil
 					}
-					if rb, ok := t.ctx.Blocks[name]; ok {
+					if len(t.ctx.layers[name]) > 0 {
+						rb, e := t.ctx.layered(name, RenderedBlock{})
 						t.ctx.output.Immediate(rb)
-						return "<\"'.", nil
+						return sentinel, e
 					}
 				}
 				rb, e := t.ctx.exec(t.ctx.Main, vals[0])
 				t.ctx.output.Immediate(rb)
-				return "<\"'.", e
-			case 2:
-				if name, ok := vals[0].(string); ok {
-					// Use provided fallback if necessary
-					if f, ok := vals[0].(fallback); ok {
-						t.ctx.output.next, e = t.ctx.execWithFallback(name, f, t.ctx.Dot)
-						return "<\"'.", e
-						// Provided data to run
-					} else {
-						if t.ctx.Yields[name] != "" {
-							t.ctx.output.next, e = t.ctx.exec(t.ctx.Yields[name], vals[0])
-							return "<\"'.", e
-						}
-						if rb, ok := t.ctx.Blocks[name]; ok {
-							t.ctx.output.next = rb
-							return "<\"'.", nil
-						}
-						return "", nil
-					}
+				if t.ctx.mainPending && t.ctx.output.stream != nil && e == nil {
+					t.ctx.mainPending = false
+					e = t.ctx.output.Release(t.ctx.resolveHeld)
 				}
-			default:
-				if name, ok := vals[0].(string); ok {
-					var d interface{}
-					for _, v := range vals {
-						if f, ok := v.(fallback); ok {
-							if d == nil {
-								t.ctx.execWithFallback(name, f, vals[1])
-							} else {
-								t.ctx.execWithFallback(name, f, d)
-							}
-						} else {
-							if d == nil {
-								d = v
-							}
-						}
-					}
-					t.ctx.output.next, e = t.ctx.exec(name, d)
-					return "<\"'.", e
+				return sentinel, e
+			}
+			if !ok {
+				return "", nil
+			}
+
+			// The remaining arguments are the data for the template and an
+			// optional fallback template, in either order.
+			var f fallback
+			var d interface{}
+			var hasData bool
+			for _, v := range vals[1:] {
+				if fb, ok := v.(fallback); ok {
+					f = fb
+				} else if !hasData {
+					d, hasData = v, true
 				}
 			}
-			return "", nil
+			if !hasData {
+				d = t.ctx.Dot
+			}
+
+			if rb, ok, e := t.ctx.blockContent(name, d); ok {
+				t.ctx.output.Immediate(rb)
+				return sentinel, e
+			}
+			var rb RenderedBlock
+			if f != "" {
+				var e error
+				rb, e = t.ctx.exec(string(f), d)
+				if e != nil {
+					return "", e
+				}
+			}
+			if t.ctx.streamPending() {
+				t.ctx.output.Defer(name, rb)
+				return sentinel, nil
+			}
+			if f == "" && len(t.ctx.layers[name]) == 0 {
+				return "", nil
+			}
+			rb, e := t.ctx.layered(name, rb)
+			t.ctx.output.Immediate(rb)
+			return sentinel, e
 		},
 		"content_for": func(name string, templateName string) string {
 			if t.ctx.Yields[name] == "" {
@@ -83,57 +114,211 @@ func generateFuncs(t *Template) template.FuncMap {
 			}
 			return ""
 		},
+		"t": func(key string, args ...interface{}) (interface{}, error) {
+			return t.ctx.translate(key, args)
+		},
+		"translate": func(key string, args ...interface{}) (interface{}, error) {
+			return t.ctx.translate(key, args)
+		},
+		"locale": func() string {
+			return t.ctx.Locale
+		},
+		"checkpoint": func() (string, error) {
+			return "", t.ctx.step()
+		},
 		"root_dot": func() interface{} {
 			return t.ctx.Dot
 		},
-		"exec": func(templateName string, dot interface{}) (string, error) {
+		"exec": func(templateName string, dot interface{}) (template.HTML, error) {
 			rb, e := t.ctx.exec(templateName, dot)
-			t.ctx.output.next = rb
-			return "<\"'.", e
+			t.ctx.output.Immediate(rb)
+			return sentinel, e
+		},
+		"render_partial": func(templateName string, dot interface{}, opts ...locals) (template.HTML, error) {
+			rb, e := t.ctx.renderPartial(templateName, dot, mergeLocals(opts))
+			t.ctx.output.Immediate(rb)
+			return sentinel, e
+		},
+		"render_collection": func(templateName string, collection interface{}, opts ...interface{}) (template.HTML, error) {
+			rb, e := t.ctx.renderCollection(templateName, collection, opts...)
+			t.ctx.output.Immediate(rb)
+			return sentinel, e
+		},
+		"component": func(templateName string, dot interface{}, opts ...locals) template.HTML {
+			t.ctx.openComponent(templateName, mergeLocals(opts).merge(dot))
+			return sentinel
+		},
+		"end_component": func() (template.HTML, error) {
+			rb, e := t.ctx.closeComponent()
+			if e != nil {
+				return "", e
+			}
+			t.ctx.output.Immediate(rb)
+			return sentinel, nil
+		},
+		"slot": func(name string) (template.HTML, error) {
+			if e := t.ctx.openSlot(name); e != nil {
+				return "", e
+			}
+			return sentinel, nil
+		},
+		"end_slot": func() (template.HTML, error) {
+			return "", t.ctx.closeSlot()
 		},
-		"block": func(name string) (string, error) {
+		"yield_slot": func(name ...string) (template.HTML, error) {
+			rb, ok, e := t.ctx.slot(name)
+			if !ok || e != nil {
+				return "", e
+			}
+			t.ctx.output.Immediate(rb)
+			return sentinel, nil
+		},
+		"has_slot": func(name ...string) (bool, error) {
+			_, ok, e := t.ctx.slot(name)
+			return ok, e
+		},
+		"cache": func(key string, args ...interface{}) (interface{}, error) {
+			name, dot, ttl, e := t.ctx.cacheOptions(args)
+			if e != nil {
+				return "", e
+			}
+			if name == "" {
+				return t.ctx.openCache(key, ttl), nil
+			}
+			rb, e := t.ctx.cached(key, name, dot, ttl)
+			t.ctx.output.Immediate(rb)
+			return sentinel, e
+		},
+		"end_cache": func() (template.HTML, error) {
+			if e := t.ctx.closeCache(); e != nil {
+				return "", e
+			}
+			return sentinel, nil
+		},
+		"block": func(name string) (template.HTML, error) {
+			if e := t.ctx.step(); e != nil {
+				return "", e
+			}
+			leave, e := t.ctx.enter(BlockStep, name)
+			defer leave()
+			if e != nil {
+				return "", e
+			}
+			// the step ends when end_block closes the block
+			end := t.ctx.trace(BlockStep, name)
 			if t.ctx.openableScope() {
 				t.ctx.output.Open(name)
 			} else {
 				if _, ok := t.ctx.Yields[name]; ok {
 					rb, e := t.ctx.exec(t.ctx.Yields[name], t.ctx.Dot)
+					if e == nil {
+						rb, e = t.ctx.layered(name, rb)
+					}
 					t.ctx.output.Nop(rb)
-					return "", e
+					t.ctx.output.EndWith(end)
+					return sentinel, e
 				} else if rb, ok := t.ctx.Blocks[name]; ok {
+					rb, e := t.ctx.layered(name, rb)
 					t.ctx.output.Nop(rb)
+					t.ctx.output.EndWith(end)
+					return sentinel, e
+				} else if t.ctx.streamPending() {
+					t.ctx.output.OpenHeld(name)
+				} else if len(t.ctx.layers[name]) > 0 {
+					t.ctx.output.OpenAs(name, layering)
 				} else {
+					t.ctx.output.Inline(end)
 					return "", nil
 				}
 			}
-			return "<\"'.", nil
+			t.ctx.output.EndWith(end)
+			return sentinel, nil
 		},
-		"exec_block": func(name string) (string, error) {
+		"exec_block": func(name string) (template.HTML, error) {
+			if e := t.ctx.step(); e != nil {
+				return "", e
+			}
+			leave, e := t.ctx.enter(BlockStep, name)
+			defer leave()
+			if e != nil {
+				return "", e
+			}
+			end := t.ctx.trace(BlockStep, name)
 			if _, ok := t.ctx.Yields[name]; ok {
 				rb, e := t.ctx.exec(t.ctx.Yields[name], t.ctx.Dot)
+				if e == nil {
+					rb, e = t.ctx.layered(name, rb)
+				}
 				t.ctx.output.Nop(rb)
-				return "<\"'.", e
+				t.ctx.output.EndWith(end)
+				return sentinel, e
 			} else if rb, ok := t.ctx.Blocks[name]; ok {
+				rb, e := t.ctx.layered(name, rb)
 				t.ctx.output.Nop(rb)
-				return "<\"'.", nil
+				t.ctx.output.EndWith(end)
+				return sentinel, e
+			} else if t.ctx.streamPending() {
+				t.ctx.output.OpenHeld(name)
+				t.ctx.output.EndWith(end)
+				return sentinel, nil
+			} else if len(t.ctx.layers[name]) > 0 {
+				t.ctx.output.OpenAs(name, layering)
+				t.ctx.output.EndWith(end)
+				return sentinel, nil
 			} else {
+				t.ctx.output.Inline(end)
 				return "", nil
 			}
 		},
-		"define_block": func(name string) string {
+		"define_block": func(name string) template.HTML {
 			t.ctx.output.Open(name)
-			return "<\"'."
+			return sentinel
+		},
+		"append_block": func(name string) template.HTML {
+			t.ctx.output.OpenAs(name, appending)
+			return sentinel
+		},
+		"prepend_block": func(name string) template.HTML {
+			t.ctx.output.OpenAs(name, prepending)
+			return sentinel
+		},
+		"super_block": func() template.HTML {
+			if n, kind := t.ctx.output.closing(); n == "" || kind != capturing {
+				return ""
+			}
+			t.ctx.output.Immediate(RenderedBlock{Content: superMarker})
+			return sentinel
 		},
-		"end_block": func() string {
+		"end_block": func() (template.HTML, error) {
+			if t.ctx.output.CloseInline() {
+				return "", nil
+			}
+			_, kind := t.ctx.output.closing()
 			n, rb := t.ctx.output.Close()
+			switch kind {
+			case holding:
+				t.ctx.output.Hold(n, rb)
+				return "", nil
+			case layering:
+				rb, e := t.ctx.layered(n, rb)
+				if e != nil {
+					return "", e
+				}
+				t.ctx.output.Immediate(rb)
+				return sentinel, nil
+			case appending, prepending:
+				t.ctx.addLayer(n, blockLayer{RenderedBlock: rb, depth: t.ctx.depth, prepend: kind == prepending})
+				return "", nil
+			}
 			if n == "" {
-				return ""
+				return "", nil
 			}
 			if _, ok := t.ctx.Blocks[n]; !ok {
 				if t.ctx.Yields[n] == "" {
-					t.ctx.Blocks[n] = rb
+					t.ctx.claim(n, rb)
 				}
 			}
-			return ""
+			return "", nil
 		},
 
 		"extend": func(parent string) string {
@@ -142,6 +327,14 @@ func generateFuncs(t *Template) template.FuncMap {
 			return ""
 		},
 	}
+	ctx := func() *Context { return t.ctx }
+	for k, f := range ContextFuncs {
+		funcs[k] = f(ctx)
+	}
+	for k, f := range t.contextFuncs {
+		funcs[k] = f(ctx)
+	}
+	return funcs
 }
 
 // Functions that are not tied to a context, but are part of the core
@@ -150,7 +343,35 @@ var StaticFuncs = template.FuncMap{
 	"fallback": func(s string) fallback {
 		return fallback(s)
 	},
+	"locals": newLocals,
+	"expires_in": func(d interface{}) (expiry, error) {
+		switch d := d.(type) {
+		case string:
+			ttl, e := time.ParseDuration(d)
+			return expiry(ttl), e
+		case time.Duration:
+			return expiry(d), nil
+		case int:
+			return expiry(time.Duration(d) * time.Second), nil
+		}
+		return 0, fmt.Errorf("expires_in needs a duration, got %T", d)
+	},
+	"spacer_template": func(s string) spacer {
+		return spacer(s)
+	},
+	"empty_template": func(s string) emptyTemplate {
+		return emptyTemplate(s)
+	},
 }
 
 // LoadedFuncs is the place to load functions to be loaded.
 var LoadedFuncs = template.FuncMap{}
+
+// A ContextFunc returns a template function that uses the Context of the
+// render, ctx returns the Context when the function is called, or nil if
+// the template isn't being rendered with one.
+type ContextFunc func(ctx func() *Context) interface{}
+
+// ContextFuncs is the place to load functions that need the Context of
+// the render, like its Locale.
+var ContextFuncs = map[string]ContextFunc{}
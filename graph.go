@@ -0,0 +1,260 @@
+package multitemplate
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"text/template/parse"
+)
+
+// Dependencies lists what a template refers to by name, as found in its
+// parse tree. Only names given as string literals can be found, so a
+// template like {{ exec .Header.Path . }} has no listed dependencies.
+type Dependencies struct {
+	// Name of the template
+	Name string
+	// Extends holds the templates named by extend
+	Extends []string
+	// Execs holds the templates executed by exec, template, content_for,
+	// fallback, component, cache, and the render_partial family of
+	// functions
+	Execs []string
+	// Yields holds the names yielded to, which may be blocks, or templates
+	// set with content_for or on a Context
+	Yields []string
+	// Blocks holds the blocks declared by block, define_block,
+	// exec_block, append_block and prepend_block
+	Blocks []string
+
+	refs []reference
+}
+
+// A reference is one use of a name by a template.
+type reference struct {
+	kind string
+	name string
+	pos  parse.Pos
+}
+
+// referenceKinds are the functions with a name as an argument, and what
+// that name refers to.
+var referenceKinds = map[string]string{
+	"extend":            "extend",
+	"exec":              "exec",
+	"content_for":       "exec",
+	"fallback":          "exec",
+	"render_partial":    "exec",
+	"render_collection": "exec",
+	"spacer_template":   "exec",
+	"empty_template":    "exec",
+	"component":         "exec",
+	"cache":             "exec",
+	"yield":             "yield",
+	"block":             "block",
+	"define_block":      "block",
+	"exec_block":        "block",
+	"append_block":      "block",
+	"prepend_block":     "block",
+}
+
+// Dependencies returns the Dependencies of every template in the set, by
+// the name of the template.
+func (t *Template) Dependencies() map[string]*Dependencies {
+	deps := map[string]*Dependencies{}
+	t.eachTemplate(func(name string, tree *parse.Tree) {
+		if tree.Root != nil {
+			deps[name] = dependencies(name, tree)
+		}
+	})
+	return deps
+}
+
+func dependencies(name string, tree *parse.Tree) *Dependencies {
+	d := &Dependencies{Name: name}
+	references(tree.Root, &d.refs)
+
+	seen := map[reference]bool{}
+	for _, ref := range d.refs {
+		key := reference{kind: ref.kind, name: ref.name}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		switch ref.kind {
+		case "extend":
+			d.Extends = append(d.Extends, ref.name)
+		case "exec":
+			d.Execs = append(d.Execs, ref.name)
+		case "yield":
+			d.Yields = append(d.Yields, ref.name)
+		case "block":
+			d.Blocks = append(d.Blocks, ref.name)
+		}
+	}
+	return d
+}
+
+// Templates returns the names of the templates d extends or executes.
+func (d *Dependencies) Templates() []string {
+	return append(append([]string{}, d.Extends...), d.Execs...)
+}
+
+// references adds the references made by the nodes under n to refs.
+func references(n parse.Node, refs *[]reference) {
+	switch n := n.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Nodes {
+			references(c, refs)
+		}
+	case *parse.ActionNode:
+		references(n.Pipe, refs)
+	case *parse.TemplateNode:
+		*refs = append(*refs, reference{kind: "exec", name: n.Name, pos: n.Pos})
+		references(n.Pipe, refs)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Cmds {
+			references(c, refs)
+		}
+	case *parse.CommandNode:
+		if len(n.Args) == 0 {
+			return
+		}
+		if id, ok := n.Args[0].(*parse.IdentifierNode); ok && referenceKinds[id.Ident] != "" {
+			// content_for "key" "template" and cache "key" "template"
+			// name the key first
+			arg := 1
+			if id.Ident == "content_for" || id.Ident == "cache" {
+				arg = 2
+			}
+			if len(n.Args) > arg {
+				if s, ok := n.Args[arg].(*parse.StringNode); ok {
+					*refs = append(*refs, reference{kind: referenceKinds[id.Ident], name: s.Text, pos: s.Pos})
+				}
+			}
+		}
+		for _, arg := range n.Args {
+			references(arg, refs)
+		}
+	case *parse.IfNode:
+		references(&n.BranchNode, refs)
+	case *parse.RangeNode:
+		references(&n.BranchNode, refs)
+	case *parse.WithNode:
+		references(&n.BranchNode, refs)
+	case *parse.BranchNode:
+		references(n.Pipe, refs)
+		references(n.List, refs)
+		references(n.ElseList, refs)
+	}
+}
+
+// A CheckError holds the problems Check found in a template set, each one
+// is an *Error at the reference that caused it.
+type CheckError struct {
+	Errors []*Error
+}
+
+func (e *CheckError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Unwrap returns the Errors, so errors.As can find them.
+func (e *CheckError) Unwrap() []error {
+	errs := make([]error, len(e.Errors))
+	for i, err := range e.Errors {
+		errs[i] = err
+	}
+	return errs
+}
+
+// Check looks for references to templates that aren't in the set, and for
+// templates that end up extending themselves. It returns a *CheckError if
+// it finds any, these would otherwise only be found when the templates
+// are executed.
+func (t *Template) Check() error {
+	deps := t.Dependencies()
+	names := make([]string, 0, len(deps))
+	for name := range deps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs []*Error
+	for _, name := range names {
+		for _, ref := range deps[name].refs {
+			if ref.kind != "extend" && ref.kind != "exec" {
+				continue
+			}
+			if _, ok := deps[ref.name]; !ok {
+				err := fmt.Errorf("%s of undefined template %q", ref.kind, ref.name)
+				errs = append(errs, t.errorAt(name, ref.pos, err))
+			}
+		}
+	}
+
+	// follow the extends from each template, a template seen twice on
+	// the way is a cycle, which is reported at the extend that closes it
+	done := map[string]bool{}
+	for _, name := range names {
+		var path []string
+		on := map[string]bool{}
+		var visit func(string)
+		visit = func(name string) {
+			if done[name] || deps[name] == nil {
+				return
+			}
+			path = append(path, name)
+			on[name] = true
+			for _, ref := range deps[name].refs {
+				if ref.kind != "extend" {
+					continue
+				}
+				if on[ref.name] {
+					cycle := path[indexOf(path, ref.name):]
+					err := fmt.Errorf("extend cycle: %s -> %s", strings.Join(cycle, " -> "), ref.name)
+					errs = append(errs, t.errorAt(name, ref.pos, err))
+					continue
+				}
+				visit(ref.name)
+			}
+			on[name] = false
+			path = path[:len(path)-1]
+			done[name] = true
+		}
+		visit(name)
+	}
+
+	if len(errs) > 0 {
+		return &CheckError{Errors: errs}
+	}
+	return nil
+}
+
+// errorAt locates err at the position pos in the named template.
+func (t *Template) errorAt(name string, pos parse.Pos, err error) *Error {
+	s := t.sources[name]
+	e := &Error{Err: err}
+	if s.src != "" {
+		e = NewError(s.src, int(pos), err)
+	}
+	return parseError(name, s, e)
+}
+
+func indexOf(list []string, s string) int {
+	for i, v := range list {
+		if v == s {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,86 @@
+package multitemplate
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	. "github.com/acsellers/assert"
+)
+
+func TestDependencies(t *testing.T) {
+	Within(t, func(test *Test) {
+		tmpl := New("graph")
+		var e error
+		tmpl, e = tmpl.Parse("layout", `<html>{{ yield "head" }}{{ yield }}{{ template "footer" }}</html>`, "tmpl")
+		test.NoError(e)
+		tmpl, e = tmpl.Parse("footer", `<footer></footer>`, "tmpl")
+		test.NoError(e)
+		tmpl, e = tmpl.Parse("main", `{{ extend "layout" }}
+{{ define_block "head" }}<title></title>{{ end_block }}
+{{ content_for "side" "sidebar" }}
+{{ if . }}{{ exec "footer" . }}{{ end }}
+{{ yield "nav" (fallback "footer") }}`, "tmpl")
+		test.NoError(e)
+
+		deps := tmpl.Dependencies()
+		main := deps["main"]
+		test.AreEqual([]string{"layout"}, main.Extends)
+		test.AreEqual([]string{"sidebar", "footer"}, main.Execs)
+		test.AreEqual([]string{"nav"}, main.Yields)
+		test.AreEqual([]string{"head"}, main.Blocks)
+
+		layout := deps["layout"]
+		test.AreEqual([]string{"footer"}, layout.Execs)
+		test.AreEqual([]string{"head"}, layout.Yields)
+	})
+}
+
+func TestCheck(t *testing.T) {
+	Within(t, func(test *Test) {
+		tmpl := New("graph")
+		var e error
+		tmpl, e = tmpl.Parse("layout", `<html>{{ yield }}</html>`, "tmpl")
+		test.NoError(e)
+		tmpl, e = tmpl.Parse("main", "<p></p>\n{{ extend \"layouts/main\" }}", "tmpl")
+		test.NoError(e)
+		tmpl, e = tmpl.Parse("a", `{{ extend "b" }}`, "tmpl")
+		test.NoError(e)
+		tmpl, e = tmpl.Parse("b", `{{ extend "a" }}`, "tmpl")
+		test.NoError(e)
+
+		e = tmpl.Check()
+		var ce *CheckError
+		test.AreEqual(true, errors.As(e, &ce))
+		test.AreEqual(2, len(ce.Errors))
+
+		test.AreEqual("main", ce.Errors[0].Name)
+		test.AreEqual(2, ce.Errors[0].Line)
+		test.AreEqual(11, ce.Errors[0].Column)
+		test.AreEqual(`extend of undefined template "layouts/main"`, ce.Errors[0].Err.Error())
+		test.AreEqual(`extend cycle: a -> b -> a`, ce.Errors[1].Err.Error())
+
+		var me *Error
+		test.AreEqual(true, errors.As(e, &me))
+	})
+}
+
+func TestLoaderCheck(t *testing.T) {
+	Within(t, func(test *Test) {
+		fsys := loaderMapFS()
+		fsys["app/show.html.tmpl"] = &fstest.MapFile{Data: []byte(`{{ extend "layouts/missing.html" }}`)}
+
+		// broken references are only reported by a Strict Loader
+		l := NewLoader(fsys)
+		_, e := l.Load(New("loader"))
+		test.NoError(e)
+
+		l.Strict = true
+		tmpl, e := l.Load(New("loader"))
+		test.IsNotNil(tmpl)
+		var me *Error
+		test.AreEqual(true, errors.As(e, &me))
+		test.AreEqual("app/show.html.tmpl", me.File)
+		test.AreEqual(1, me.Line)
+	})
+}
@@ -0,0 +1,110 @@
+package helpers
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"strings"
+
+	"github.com/acsellers/multitemplate"
+)
+
+// CSRFFieldName is the name of the hidden field that form_tag adds the
+// CSRF token in, and the csrf-param given by csrf_meta_tags.
+var CSRFFieldName = "authenticity_token"
+
+// CSRFHeader is the header that javascript should send the token from
+// csrf_meta_tags in.
+const CSRFHeader = "X-CSRF-Token"
+
+const csrfLength = 32
+
+var csrfEncoding = base64.RawURLEncoding
+
+// NewCSRFSecret returns a random secret to keep in a session, tokens for
+// the session's forms are made from it with MaskCSRFToken.
+func NewCSRFSecret() (string, error) {
+	b := make([]byte, csrfLength)
+	if _, e := rand.Read(b); e != nil {
+		return "", e
+	}
+	return csrfEncoding.EncodeToString(b), nil
+}
+
+// MaskCSRFToken returns a token for the secret, which is different each
+// time so the secret can't be worked out from compressed pages.
+func MaskCSRFToken(secret string) (string, error) {
+	s, e := csrfEncoding.DecodeString(secret)
+	if e != nil || len(s) != csrfLength {
+		return "", fmt.Errorf("helpers: the CSRF secret is not from NewCSRFSecret")
+	}
+	token := make([]byte, 2*csrfLength)
+	if _, e := rand.Read(token[:csrfLength]); e != nil {
+		return "", e
+	}
+	for i, b := range s {
+		token[csrfLength+i] = token[i] ^ b
+	}
+	return csrfEncoding.EncodeToString(token), nil
+}
+
+// ValidCSRFToken reports whether the token sent with a request was made
+// from the secret of its session.
+func ValidCSRFToken(secret, token string) bool {
+	s, e := csrfEncoding.DecodeString(secret)
+	if e != nil || len(s) != csrfLength {
+		return false
+	}
+	t, e := csrfEncoding.DecodeString(token)
+	if e != nil || len(t) != 2*csrfLength {
+		return false
+	}
+	unmasked := make([]byte, csrfLength)
+	for i := range unmasked {
+		unmasked[i] = t[i] ^ t[csrfLength+i]
+	}
+	return subtle.ConstantTimeCompare(unmasked, s) == 1
+}
+
+var csrfFuncs = map[string]multitemplate.ContextFunc{
+	"form_tag": func(ctx func() *multitemplate.Context) interface{} {
+		return func(target string, options ...AttrList) template.HTML {
+			return formTag(contextCSRFToken(ctx), target, options...)
+		}
+	},
+	"csrf_meta_tags": func(ctx func() *multitemplate.Context) interface{} {
+		return func() template.HTML {
+			token := contextCSRFToken(ctx)
+			if token == "" {
+				return ""
+			}
+			return template.HTML(fmt.Sprintf(
+				`<meta name="csrf-param" content="%s" /><meta name="csrf-token" content="%s" />`,
+				template.HTMLEscapeString(CSRFFieldName),
+				template.HTMLEscapeString(token),
+			))
+		}
+	},
+}
+
+func contextCSRFToken(ctx func() *multitemplate.Context) string {
+	if c := ctx(); c != nil {
+		return c.CSRFToken
+	}
+	return ""
+}
+
+// csrfField is the hidden field for a token, forms sent with get don't
+// change anything so they don't need one.
+func csrfField(token string, al AttrList) template.HTML {
+	if token == "" || strings.EqualFold(fmt.Sprint(al["method"]), "get") {
+		return ""
+	}
+	return template.HTML(fmt.Sprintf(
+		`<input type="hidden" name="%s" value="%s" />`,
+		template.HTMLEscapeString(CSRFFieldName),
+		template.HTMLEscapeString(token),
+	))
+}
@@ -0,0 +1,93 @@
+package helpers
+
+import (
+	"bytes"
+	"html/template"
+	"strings"
+	"testing"
+
+	. "github.com/acsellers/assert"
+	"github.com/acsellers/multitemplate"
+)
+
+func TestCSRFToken(t *testing.T) {
+	Within(t, func(test *Test) {
+		secret, e := NewCSRFSecret()
+		test.NoError(e)
+		token, e := MaskCSRFToken(secret)
+		test.NoError(e)
+		other, e := MaskCSRFToken(secret)
+		test.NoError(e)
+
+		test.AreEqual(true, token != other)
+		test.AreEqual(true, ValidCSRFToken(secret, token))
+		test.AreEqual(true, ValidCSRFToken(secret, other))
+
+		otherSecret, e := NewCSRFSecret()
+		test.NoError(e)
+		test.AreEqual(false, ValidCSRFToken(otherSecret, token))
+		test.AreEqual(false, ValidCSRFToken(secret, ""))
+		test.AreEqual(false, ValidCSRFToken(secret, secret))
+		tampered := []byte(token)
+		if tampered[5] == 'A' {
+			tampered[5] = 'B'
+		} else {
+			tampered[5] = 'A'
+		}
+		test.AreEqual(false, ValidCSRFToken(secret, string(tampered)))
+
+		_, e = MaskCSRFToken("not a secret")
+		test.IsError(e)
+	})
+}
+
+func TestCSRFForms(t *testing.T) {
+	Within(t, func(test *Test) {
+		LoadHelpers("form")
+		tmpl, e := multitemplate.New("csrf").Parse(
+			"form",
+			`{{ csrf_meta_tags }}{{ form_tag "/find" (attrs "method" "GET") }}{{ form_tag "/users" }}{{ form_tag "/search" (attrs "method" "get") }}`,
+			"tmpl",
+		)
+		test.NoError(e)
+
+		c := multitemplate.NewContext(nil)
+		c.Main = "form"
+		c.CSRFToken = "abc<def"
+		b := bytes.Buffer{}
+		test.NoError(tmpl.ExecuteContext(&b, c))
+		meta := `<meta name="csrf-param" content="authenticity_token" /><meta name="csrf-token" content="abc&lt;def" />`
+		field := `<input type="hidden" name="authenticity_token" value="abc&lt;def" />`
+		test.AreEqual(true, strings.HasPrefix(b.String(), meta))
+		test.AreEqual(1, strings.Count(b.String(), field))
+		test.AreEqual(true, strings.HasSuffix(b.String(), field+`<form action="/search" method="get">`) ||
+			strings.HasSuffix(b.String(), field+`<form method="get" action="/search">`))
+
+		b.Reset()
+		c = multitemplate.NewContext(nil)
+		c.Main = "form"
+		test.NoError(tmpl.ExecuteContext(&b, c))
+		test.AreEqual(true, strings.HasPrefix(b.String(), "<form "))
+		test.AreEqual(false, strings.Contains(b.String(), "authenticity_token"))
+
+		f := GetHelpers("forms")["form_tag"].(func(string, ...AttrList) template.HTML)
+		test.AreEqual(false, strings.Contains(string(f("/users")), "authenticity_token"))
+	})
+}
+
+func TestCSRFContextHelpers(t *testing.T) {
+	Within(t, func(test *Test) {
+		tmpl, e := multitemplate.New("csrf").
+			Funcs(GetHelpers("forms")).
+			ContextFuncs(GetContextHelpers("form")).
+			Parse("form", `{{ form_tag "/users" }}`, "tmpl")
+		test.NoError(e)
+
+		c := multitemplate.NewContext(nil)
+		c.Main = "form"
+		c.CSRFToken = "abc"
+		b := bytes.Buffer{}
+		test.NoError(tmpl.ExecuteContext(&b, c))
+		test.AreEqual(true, strings.Contains(b.String(), `<input type="hidden" name="authenticity_token" value="abc" />`))
+	})
+}
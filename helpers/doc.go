@@ -5,7 +5,7 @@
   modules that are loaded using the LoadHelpers function. All modules
   depend on a "core" module that will always be loaded. The modules may
   be all be loaded by asking for the "all" module, or they can be loaded
-  by their names, which are "form", "general", "link" and "asset".
+  by their names, which are "form", "general", "link", "asset" and "format".
 
   Core functions
 
@@ -43,7 +43,9 @@
 
   - file_field_tag: Input field with a type of file, make sure that the form tag has an enctype of "multipart/form-data"
 
-  - form_tag: Open a form tag, this does not yet add any csrf protection, though it is planned.
+  - form_tag: Open a form tag, when the multitemplate Context has a CSRFToken it is added as a hidden authenticity_token field, except for get forms.
+
+  - csrf_meta_tags: Meta tags with the name of the CSRF field and the CSRFToken of the Context, for javascript to send in the X-CSRF-Token header
 
   - end_form_tag: Closes a form tag, for auto-closing template languages
 
@@ -185,5 +187,36 @@
   - rss_link: Returns a link tag for a rss feed based on the RootURL + the path you send.
 
   - stylesheet_link: Return the link tags for one or more stylesheets base on the StylesheetRoot + paths given.
+
+  Format Functions
+
+  Format Functions use the Locale of the multitemplate Context being rendered, falling back from a locale
+  like "fr-CA" to its language, then to English. Formats for more locales can be added to LocaleFormats.
+  The number functions take attrs of precision, delimiter, separator, unit, strip_insignificant_zeros
+  and locale, which overrides the Locale of the Context.
+
+      {{ number_to_currency .Total (attrs "precision" 0) }}
+
+  - number_with_delimiter: Group the thousands of a number, like 12,345,678.05
+
+  - number_to_currency: Format a number as money in the currency of the locale, with 2 places after the decimal point in most locales
+
+  - number_to_percentage: Format a number as a percentage, with 3 places after the decimal point unless a precision is given
+
+  - time_ago_in_words: Describe the time since (or until) a time, like "about 3 hours"
+
+  - distance_of_time_in_words: Describe the time between two times, like "3 days"
+
+  - format_date: Format the date of a time with the "default", "short" or "long" format of the locale, or a strftime style format
+
+  - format_time: Format a time with the "default", "short" or "long" format of the locale, or a strftime style format
+
+  CSRF Tokens
+
+  A secret for each session is made with NewCSRFSecret, then each page gets a different token made from
+  it with MaskCSRFToken, set as the CSRFToken of the Context. ValidCSRFToken checks the token sent back
+  with a form against the secret. The Martini and Revel integrations do this for you when CSRF is turned
+  on. form_tag and csrf_meta_tags only see the token when they're loaded with LoadHelpers, or added to a
+  single Template with GetContextHelpers and Template.ContextFuncs.
 */
 package helpers
@@ -44,13 +44,7 @@ var formTagFuncs = template.FuncMap{
 		return buildTag("input", "", al)
 	},
 	"form_tag": func(target string, options ...AttrList) template.HTML {
-		al := combine("", "", options)
-		al["action"] = target
-		if _, ok := al["method"]; !ok {
-			al["method"] = "post"
-		}
-		al["MT_skip_close"] = true
-		return buildTag("form", "", al)
+		return formTag("", target, options...)
 	},
 	"end_form_tag": func() template.HTML {
 		return "</form>"
@@ -129,6 +123,18 @@ var formTagFuncs = template.FuncMap{
 	},
 }
 
+// formTag opens a form, with a hidden field for the CSRF token if there
+// is one.
+func formTag(token, target string, options ...AttrList) template.HTML {
+	al := combine("", "", options)
+	al["action"] = target
+	if _, ok := al["method"]; !ok {
+		al["method"] = "post"
+	}
+	al["MT_skip_close"] = true
+	return buildTag("form", csrfField(token, al), al)
+}
+
 /*
   Ignored tags
   * color_field_tag
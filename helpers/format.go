@@ -0,0 +1,574 @@
+package helpers
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/acsellers/multitemplate"
+)
+
+// These functions come from Rails, with the locale taken from the Context
+// of the render
+
+var formatFuncs = map[string]multitemplate.ContextFunc{
+	"number_with_delimiter": func(ctx func() *multitemplate.Context) interface{} {
+		return func(n interface{}, opts ...AttrList) (string, error) {
+			return numberWithDelimiter(contextLocale(ctx), n, opts...)
+		}
+	},
+	"number_to_currency": func(ctx func() *multitemplate.Context) interface{} {
+		return func(n interface{}, opts ...AttrList) (string, error) {
+			return numberToCurrency(contextLocale(ctx), n, opts...)
+		}
+	},
+	"number_to_percentage": func(ctx func() *multitemplate.Context) interface{} {
+		return func(n interface{}, opts ...AttrList) (string, error) {
+			return numberToPercentage(contextLocale(ctx), n, opts...)
+		}
+	},
+	"time_ago_in_words": func(ctx func() *multitemplate.Context) interface{} {
+		return func(t time.Time, opts ...AttrList) string {
+			return distanceOfTimeInWords(contextLocale(ctx), t, time.Now(), opts...)
+		}
+	},
+	"distance_of_time_in_words": func(ctx func() *multitemplate.Context) interface{} {
+		return func(from, to time.Time, opts ...AttrList) string {
+			return distanceOfTimeInWords(contextLocale(ctx), from, to, opts...)
+		}
+	},
+	"format_date": func(ctx func() *multitemplate.Context) interface{} {
+		return func(t time.Time, format ...string) string {
+			lf := findLocaleFormat(contextLocale(ctx))
+			return formatTime(lf, t, lf.DateFormats, format)
+		}
+	},
+	"format_time": func(ctx func() *multitemplate.Context) interface{} {
+		return func(t time.Time, format ...string) string {
+			lf := findLocaleFormat(contextLocale(ctx))
+			return formatTime(lf, t, lf.TimeFormats, format)
+		}
+	},
+}
+
+// A LocaleFormat is how numbers, money, dates and times are written in a
+// locale. Formats for more locales can be added to LocaleFormats.
+type LocaleFormat struct {
+	// Delimiter goes between each group of thousands, and Separator
+	// between whole numbers and their fractions
+	Delimiter string
+	Separator string
+	// Unit is the currency symbol, placed by CurrencyFormat where %u is,
+	// with the number where %n is, and shown with CurrencyPrecision
+	// decimal places
+	Unit              string
+	CurrencyFormat    string
+	CurrencyPrecision int
+	// PercentFormat places the number where %n is
+	PercentFormat string
+
+	Months     [12]string
+	AbbrMonths [12]string
+	// Days start with Sunday
+	Days     [7]string
+	AbbrDays [7]string
+	// DateFormats and TimeFormats are named strftime formats, which must
+	// include "default", "short" and "long"
+	DateFormats map[string]string
+	TimeFormats map[string]string
+	// Distances are the words for a distance of time, with forms for one
+	// and more than one, which have the count where %d is
+	Distances map[string][2]string
+}
+
+var (
+	enMonths     = [12]string{"January", "February", "March", "April", "May", "June", "July", "August", "September", "October", "November", "December"}
+	enAbbrMonths = [12]string{"Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sep", "Oct", "Nov", "Dec"}
+	enDays       = [7]string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"}
+	enAbbrDays   = [7]string{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"}
+	enDistances  = map[string][2]string{
+		"less_than_x_minutes": {"less than a minute", "less than %d minutes"},
+		"x_minutes":           {"1 minute", "%d minutes"},
+		"about_x_hours":       {"about 1 hour", "about %d hours"},
+		"x_days":              {"1 day", "%d days"},
+		"about_x_months":      {"about 1 month", "about %d months"},
+		"x_months":            {"1 month", "%d months"},
+		"about_x_years":       {"about 1 year", "about %d years"},
+		"over_x_years":        {"over 1 year", "over %d years"},
+		"almost_x_years":      {"almost 1 year", "almost %d years"},
+	}
+)
+
+// LocaleFormats are the formats for each locale, a locale like "fr-CA"
+// without its own format uses the format for its language, and English
+// is used for languages without a format.
+var LocaleFormats = map[string]*LocaleFormat{
+	"en": {
+		Delimiter: ",", Separator: ".",
+		Unit: "$", CurrencyFormat: "%u%n", CurrencyPrecision: 2,
+		PercentFormat: "%n%",
+		Months:        enMonths, AbbrMonths: enAbbrMonths,
+		Days: enDays, AbbrDays: enAbbrDays,
+		DateFormats: map[string]string{"default": "%Y-%m-%d", "short": "%b %d", "long": "%B %d, %Y"},
+		TimeFormats: map[string]string{"default": "%a, %d %b %Y %H:%M:%S", "short": "%d %b %H:%M", "long": "%B %d, %Y %H:%M"},
+		Distances:   enDistances,
+	},
+	"en-GB": {
+		Delimiter: ",", Separator: ".",
+		Unit: "£", CurrencyFormat: "%u%n", CurrencyPrecision: 2,
+		PercentFormat: "%n%",
+		Months:        enMonths, AbbrMonths: enAbbrMonths,
+		Days: enDays, AbbrDays: enAbbrDays,
+		DateFormats: map[string]string{"default": "%d/%m/%Y", "short": "%d %b", "long": "%d %B %Y"},
+		TimeFormats: map[string]string{"default": "%a, %d %b %Y %H:%M:%S", "short": "%d %b %H:%M", "long": "%d %B %Y %H:%M"},
+		Distances:   enDistances,
+	},
+	"fr": {
+		Delimiter: "\u202f", Separator: ",",
+		Unit: "€", CurrencyFormat: "%n\u00a0%u", CurrencyPrecision: 2,
+		PercentFormat: "%n\u00a0%",
+		Months:        [12]string{"janvier", "février", "mars", "avril", "mai", "juin", "juillet", "août", "septembre", "octobre", "novembre", "décembre"},
+		AbbrMonths:    [12]string{"janv.", "févr.", "mars", "avr.", "mai", "juin", "juil.", "août", "sept.", "oct.", "nov.", "déc."},
+		Days:          [7]string{"dimanche", "lundi", "mardi", "mercredi", "jeudi", "vendredi", "samedi"},
+		AbbrDays:      [7]string{"dim.", "lun.", "mar.", "mer.", "jeu.", "ven.", "sam."},
+		DateFormats:   map[string]string{"default": "%d/%m/%Y", "short": "%e %b", "long": "%e %B %Y"},
+		TimeFormats:   map[string]string{"default": "%d %B %Y %H:%M:%S", "short": "%d %b %H:%M", "long": "%A %d %B %Y %H:%M"},
+		Distances: map[string][2]string{
+			"less_than_x_minutes": {"moins d'une minute", "moins de %d minutes"},
+			"x_minutes":           {"1 minute", "%d minutes"},
+			"about_x_hours":       {"environ une heure", "environ %d heures"},
+			"x_days":              {"1 jour", "%d jours"},
+			"about_x_months":      {"environ un mois", "environ %d mois"},
+			"x_months":            {"1 mois", "%d mois"},
+			"about_x_years":       {"environ un an", "environ %d ans"},
+			"over_x_years":        {"plus d'un an", "plus de %d ans"},
+			"almost_x_years":      {"presque un an", "presque %d ans"},
+		},
+	},
+	"de": {
+		Delimiter: ".", Separator: ",",
+		Unit: "€", CurrencyFormat: "%n\u00a0%u", CurrencyPrecision: 2,
+		PercentFormat: "%n\u00a0%",
+		Months:        [12]string{"Januar", "Februar", "März", "April", "Mai", "Juni", "Juli", "August", "September", "Oktober", "November", "Dezember"},
+		AbbrMonths:    [12]string{"Jan", "Feb", "Mär", "Apr", "Mai", "Jun", "Jul", "Aug", "Sep", "Okt", "Nov", "Dez"},
+		Days:          [7]string{"Sonntag", "Montag", "Dienstag", "Mittwoch", "Donnerstag", "Freitag", "Samstag"},
+		AbbrDays:      [7]string{"So", "Mo", "Di", "Mi", "Do", "Fr", "Sa"},
+		DateFormats:   map[string]string{"default": "%d.%m.%Y", "short": "%e. %b", "long": "%e. %B %Y"},
+		TimeFormats:   map[string]string{"default": "%A, %d. %B %Y, %H:%M Uhr", "short": "%d. %B, %H:%M Uhr", "long": "%A, %d. %B %Y, %H:%M Uhr"},
+		Distances: map[string][2]string{
+			"less_than_x_minutes": {"weniger als eine Minute", "weniger als %d Minuten"},
+			"x_minutes":           {"eine Minute", "%d Minuten"},
+			"about_x_hours":       {"etwa eine Stunde", "etwa %d Stunden"},
+			"x_days":              {"ein Tag", "%d Tage"},
+			"about_x_months":      {"etwa ein Monat", "etwa %d Monate"},
+			"x_months":            {"ein Monat", "%d Monate"},
+			"about_x_years":       {"etwa ein Jahr", "etwa %d Jahre"},
+			"over_x_years":        {"mehr als ein Jahr", "mehr als %d Jahre"},
+			"almost_x_years":      {"fast ein Jahr", "fast %d Jahre"},
+		},
+	},
+	"es": {
+		Delimiter: ".", Separator: ",",
+		Unit: "€", CurrencyFormat: "%n\u00a0%u", CurrencyPrecision: 2,
+		PercentFormat: "%n\u00a0%",
+		Months:        [12]string{"enero", "febrero", "marzo", "abril", "mayo", "junio", "julio", "agosto", "septiembre", "octubre", "noviembre", "diciembre"},
+		AbbrMonths:    [12]string{"ene", "feb", "mar", "abr", "may", "jun", "jul", "ago", "sept", "oct", "nov", "dic"},
+		Days:          [7]string{"domingo", "lunes", "martes", "miércoles", "jueves", "viernes", "sábado"},
+		AbbrDays:      [7]string{"dom", "lun", "mar", "mié", "jue", "vie", "sáb"},
+		DateFormats:   map[string]string{"default": "%d/%m/%Y", "short": "%e %b", "long": "%e de %B de %Y"},
+		TimeFormats:   map[string]string{"default": "%A, %e de %B de %Y %H:%M:%S", "short": "%e %b %H:%M", "long": "%e de %B de %Y %H:%M"},
+		Distances: map[string][2]string{
+			"less_than_x_minutes": {"menos de un minuto", "menos de %d minutos"},
+			"x_minutes":           {"1 minuto", "%d minutos"},
+			"about_x_hours":       {"alrededor de 1 hora", "alrededor de %d horas"},
+			"x_days":              {"1 día", "%d días"},
+			"about_x_months":      {"alrededor de 1 mes", "alrededor de %d meses"},
+			"x_months":            {"1 mes", "%d meses"},
+			"about_x_years":       {"alrededor de 1 año", "alrededor de %d años"},
+			"over_x_years":        {"más de 1 año", "más de %d años"},
+			"almost_x_years":      {"casi 1 año", "casi %d años"},
+		},
+	},
+	"it": {
+		Delimiter: ".", Separator: ",",
+		Unit: "€", CurrencyFormat: "%n\u00a0%u", CurrencyPrecision: 2,
+		PercentFormat: "%n%",
+		Months:        [12]string{"gennaio", "febbraio", "marzo", "aprile", "maggio", "giugno", "luglio", "agosto", "settembre", "ottobre", "novembre", "dicembre"},
+		AbbrMonths:    [12]string{"gen", "feb", "mar", "apr", "mag", "giu", "lug", "ago", "set", "ott", "nov", "dic"},
+		Days:          [7]string{"domenica", "lunedì", "martedì", "mercoledì", "giovedì", "venerdì", "sabato"},
+		AbbrDays:      [7]string{"dom", "lun", "mar", "mer", "gio", "ven", "sab"},
+		DateFormats:   map[string]string{"default": "%d/%m/%Y", "short": "%e %b", "long": "%e %B %Y"},
+		TimeFormats:   map[string]string{"default": "%a %d %b %Y, %H:%M:%S", "short": "%d %b %H:%M", "long": "%d %B %Y %H:%M"},
+		Distances: map[string][2]string{
+			"less_than_x_minutes": {"meno di un minuto", "meno di %d minuti"},
+			"x_minutes":           {"1 minuto", "%d minuti"},
+			"about_x_hours":       {"circa un'ora", "circa %d ore"},
+			"x_days":              {"1 giorno", "%d giorni"},
+			"about_x_months":      {"circa un mese", "circa %d mesi"},
+			"x_months":            {"1 mese", "%d mesi"},
+			"about_x_years":       {"circa un anno", "circa %d anni"},
+			"over_x_years":        {"più di un anno", "più di %d anni"},
+			"almost_x_years":      {"quasi un anno", "quasi %d anni"},
+		},
+	},
+	"pt": {
+		Delimiter: ".", Separator: ",",
+		Unit: "R$", CurrencyFormat: "%u\u00a0%n", CurrencyPrecision: 2,
+		PercentFormat: "%n%",
+		Months:        [12]string{"janeiro", "fevereiro", "março", "abril", "maio", "junho", "julho", "agosto", "setembro", "outubro", "novembro", "dezembro"},
+		AbbrMonths:    [12]string{"jan", "fev", "mar", "abr", "mai", "jun", "jul", "ago", "set", "out", "nov", "dez"},
+		Days:          [7]string{"domingo", "segunda-feira", "terça-feira", "quarta-feira", "quinta-feira", "sexta-feira", "sábado"},
+		AbbrDays:      [7]string{"dom", "seg", "ter", "qua", "qui", "sex", "sáb"},
+		DateFormats:   map[string]string{"default": "%d/%m/%Y", "short": "%e de %b", "long": "%e de %B de %Y"},
+		TimeFormats:   map[string]string{"default": "%a, %d de %B de %Y, %H:%M:%S", "short": "%d de %b, %H:%M", "long": "%d de %B de %Y, %H:%M"},
+		Distances: map[string][2]string{
+			"less_than_x_minutes": {"menos de um minuto", "menos de %d minutos"},
+			"x_minutes":           {"1 minuto", "%d minutos"},
+			"about_x_hours":       {"aproximadamente 1 hora", "aproximadamente %d horas"},
+			"x_days":              {"1 dia", "%d dias"},
+			"about_x_months":      {"aproximadamente 1 mês", "aproximadamente %d meses"},
+			"x_months":            {"1 mês", "%d meses"},
+			"about_x_years":       {"aproximadamente 1 ano", "aproximadamente %d anos"},
+			"over_x_years":        {"mais de 1 ano", "mais de %d anos"},
+			"almost_x_years":      {"quase 1 ano", "quase %d anos"},
+		},
+	},
+	"nl": {
+		Delimiter: ".", Separator: ",",
+		Unit: "€", CurrencyFormat: "%u\u00a0%n", CurrencyPrecision: 2,
+		PercentFormat: "%n%",
+		Months:        [12]string{"januari", "februari", "maart", "april", "mei", "juni", "juli", "augustus", "september", "oktober", "november", "december"},
+		AbbrMonths:    [12]string{"jan", "feb", "mrt", "apr", "mei", "jun", "jul", "aug", "sep", "okt", "nov", "dec"},
+		Days:          [7]string{"zondag", "maandag", "dinsdag", "woensdag", "donderdag", "vrijdag", "zaterdag"},
+		AbbrDays:      [7]string{"zo", "ma", "di", "wo", "do", "vr", "za"},
+		DateFormats:   map[string]string{"default": "%d-%m-%Y", "short": "%e %b", "long": "%e %B %Y"},
+		TimeFormats:   map[string]string{"default": "%a %d %b %Y %H:%M:%S", "short": "%e %b %H:%M", "long": "%d %B %Y %H:%M"},
+		Distances: map[string][2]string{
+			"less_than_x_minutes": {"minder dan een minuut", "minder dan %d minuten"},
+			"x_minutes":           {"1 minuut", "%d minuten"},
+			"about_x_hours":       {"ongeveer een uur", "ongeveer %d uur"},
+			"x_days":              {"1 dag", "%d dagen"},
+			"about_x_months":      {"ongeveer een maand", "ongeveer %d maanden"},
+			"x_months":            {"1 maand", "%d maanden"},
+			"about_x_years":       {"ongeveer een jaar", "ongeveer %d jaar"},
+			"over_x_years":        {"meer dan een jaar", "meer dan %d jaar"},
+			"almost_x_years":      {"bijna een jaar", "bijna %d jaar"},
+		},
+	},
+	"ja": {
+		Delimiter: ",", Separator: ".",
+		Unit: "¥", CurrencyFormat: "%u%n", CurrencyPrecision: 0,
+		PercentFormat: "%n%",
+		Months:        [12]string{"1月", "2月", "3月", "4月", "5月", "6月", "7月", "8月", "9月", "10月", "11月", "12月"},
+		AbbrMonths:    [12]string{"1月", "2月", "3月", "4月", "5月", "6月", "7月", "8月", "9月", "10月", "11月", "12月"},
+		Days:          [7]string{"日曜日", "月曜日", "火曜日", "水曜日", "木曜日", "金曜日", "土曜日"},
+		AbbrDays:      [7]string{"日", "月", "火", "水", "木", "金", "土"},
+		DateFormats:   map[string]string{"default": "%Y/%m/%d", "short": "%m/%d", "long": "%Y年%-m月%-d日(%a)"},
+		TimeFormats:   map[string]string{"default": "%Y/%m/%d %H:%M:%S", "short": "%y/%m/%d %H:%M", "long": "%Y年%-m月%-d日(%a) %H時%M分%S秒"},
+		Distances: map[string][2]string{
+			"less_than_x_minutes": {"1分未満", "%d分未満"},
+			"x_minutes":           {"1分", "%d分"},
+			"about_x_hours":       {"約1時間", "約%d時間"},
+			"x_days":              {"1日", "%d日"},
+			"about_x_months":      {"約1ヶ月", "約%dヶ月"},
+			"x_months":            {"1ヶ月", "%dヶ月"},
+			"about_x_years":       {"約1年", "約%d年"},
+			"over_x_years":        {"1年以上", "%d年以上"},
+			"almost_x_years":      {"1年弱", "%d年弱"},
+		},
+	},
+}
+
+// contextLocale returns the Locale of the Context of the render.
+func contextLocale(ctx func() *multitemplate.Context) string {
+	if c := ctx(); c != nil {
+		return c.Locale
+	}
+	return ""
+}
+
+// findLocaleFormat returns the format for the locale, or its language.
+func findLocaleFormat(locale string) *LocaleFormat {
+	if lf, ok := LocaleFormats[locale]; ok {
+		return lf
+	}
+	if i := strings.IndexAny(locale, "-_"); i > 0 {
+		if lf, ok := LocaleFormats[locale[:i]]; ok {
+			return lf
+		}
+	}
+	return LocaleFormats["en"]
+}
+
+// numberOptions are the options of the number functions, given as attrs.
+type numberOptions struct {
+	locale    *LocaleFormat
+	precision int
+	strip     bool
+	delimiter string
+	separator string
+	unit      string
+}
+
+// makeNumberOptions reads the options, precision returns the default
+// precision for the format of the locale.
+func makeNumberOptions(locale string, precision func(*LocaleFormat) int, opts []AttrList) (numberOptions, error) {
+	al := combine("", "", opts)
+	if l, ok := al["locale"]; ok {
+		locale = fmt.Sprint(l)
+	}
+	lf := findLocaleFormat(locale)
+	no := numberOptions{
+		locale:    lf,
+		precision: precision(lf),
+		delimiter: lf.Delimiter,
+		separator: lf.Separator,
+		unit:      lf.Unit,
+	}
+	for k, v := range al {
+		switch k {
+		case "precision":
+			p, ok := v.(int)
+			if !ok {
+				return no, fmt.Errorf("precision must be an int, not %T", v)
+			}
+			no.precision = p
+		case "strip_insignificant_zeros":
+			no.strip = v == true
+		case "delimiter":
+			no.delimiter = fmt.Sprint(v)
+		case "separator":
+			no.separator = fmt.Sprint(v)
+		case "unit":
+			no.unit = fmt.Sprint(v)
+		}
+	}
+	return no, nil
+}
+
+// format writes the number with the delimiter and separator, with
+// precision decimal places, or as many as it has when precision is
+// negative. The sign is returned apart from the number.
+func (no numberOptions) format(n interface{}) (string, bool, error) {
+	var digits string
+	var negative bool
+	v := reflect.ValueOf(n)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i := v.Int()
+		negative = i < 0
+		if no.precision < 0 {
+			digits = strconv.FormatUint(uint64(i), 10)
+			if negative {
+				digits = strconv.FormatUint(uint64(-i), 10)
+			}
+		} else {
+			digits = strconv.FormatFloat(math.Abs(float64(i)), 'f', no.precision, 64)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if no.precision < 0 {
+			digits = strconv.FormatUint(v.Uint(), 10)
+		} else {
+			digits = strconv.FormatFloat(float64(v.Uint()), 'f', no.precision, 64)
+		}
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		negative = f < 0
+		digits = strconv.FormatFloat(math.Abs(f), 'f', no.precision, 64)
+	default:
+		return "", false, fmt.Errorf("can't format %T as a number", n)
+	}
+
+	whole, fraction, _ := strings.Cut(digits, ".")
+	if no.strip {
+		fraction = strings.TrimRight(fraction, "0")
+	}
+	var b strings.Builder
+	for i, r := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteString(no.delimiter)
+		}
+		b.WriteRune(r)
+	}
+	if fraction != "" {
+		b.WriteString(no.separator)
+		b.WriteString(fraction)
+	}
+	return b.String(), negative && strings.Trim(digits, "0.") != "", nil
+}
+
+func numberWithDelimiter(locale string, n interface{}, opts ...AttrList) (string, error) {
+	no, e := makeNumberOptions(locale, func(*LocaleFormat) int { return -1 }, opts)
+	if e != nil {
+		return "", e
+	}
+	s, negative, e := no.format(n)
+	if negative {
+		s = "-" + s
+	}
+	return s, e
+}
+
+func numberToCurrency(locale string, n interface{}, opts ...AttrList) (string, error) {
+	no, e := makeNumberOptions(locale, func(lf *LocaleFormat) int { return lf.CurrencyPrecision }, opts)
+	if e != nil {
+		return "", e
+	}
+	s, negative, e := no.format(n)
+	if e != nil {
+		return "", e
+	}
+	s = strings.NewReplacer("%u", no.unit, "%n", s).Replace(no.locale.CurrencyFormat)
+	if negative {
+		s = "-" + s
+	}
+	return s, nil
+}
+
+func numberToPercentage(locale string, n interface{}, opts ...AttrList) (string, error) {
+	no, e := makeNumberOptions(locale, func(*LocaleFormat) int { return 3 }, opts)
+	if e != nil {
+		return "", e
+	}
+	s, negative, e := no.format(n)
+	if e != nil {
+		return "", e
+	}
+	if negative {
+		s = "-" + s
+	}
+	return strings.Replace(no.locale.PercentFormat, "%n", s, 1), nil
+}
+
+// distanceOfTimeInWords describes the time between from and to, rounded
+// the same way as Rails.
+func distanceOfTimeInWords(locale string, from, to time.Time, opts ...AttrList) string {
+	if l, ok := combine("", "", opts)["locale"]; ok {
+		locale = fmt.Sprint(l)
+	}
+	lf := findLocaleFormat(locale)
+	words := func(key string, n int) string {
+		forms := lf.Distances[key]
+		if n == 1 {
+			return forms[0]
+		}
+		return strings.Replace(forms[1], "%d", strconv.Itoa(n), 1)
+	}
+
+	d := to.Sub(from)
+	if d < 0 {
+		d = -d
+	}
+	minutes := int(math.Round(d.Minutes()))
+	switch {
+	case minutes == 0:
+		return words("less_than_x_minutes", 1)
+	case minutes < 2:
+		return words("x_minutes", 1)
+	case minutes < 45:
+		return words("x_minutes", minutes)
+	case minutes < 90:
+		return words("about_x_hours", 1)
+	case minutes < 1440:
+		return words("about_x_hours", int(math.Round(float64(minutes)/60)))
+	case minutes < 2520:
+		return words("x_days", 1)
+	case minutes < 43200:
+		return words("x_days", int(math.Round(float64(minutes)/1440)))
+	case minutes < 86400:
+		return words("about_x_months", int(math.Round(float64(minutes)/43200)))
+	case minutes < 525600:
+		return words("x_months", int(math.Round(float64(minutes)/43200)))
+	}
+	years, remainder := minutes/525600, minutes%525600
+	switch {
+	case remainder < 131400:
+		return words("about_x_years", years)
+	case remainder < 394200:
+		return words("over_x_years", years)
+	}
+	return words("almost_x_years", years+1)
+}
+
+// formatTime formats a time with a named format of the locale, or with
+// the format itself if it isn't the name of one.
+func formatTime(lf *LocaleFormat, t time.Time, formats map[string]string, format []string) string {
+	f := formats["default"]
+	if len(format) > 0 {
+		if named, ok := formats[format[0]]; ok {
+			f = named
+		} else {
+			f = format[0]
+		}
+	}
+	return localStrftime(lf, t, f)
+}
+
+// localStrftime formats a time with the names of months and days from the
+// locale. It understands %Y %y %m %-m %d %-d %e %B %b %A %a %H %I %M %S
+// %p and %%.
+func localStrftime(lf *LocaleFormat, t time.Time, format string) string {
+	var b strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i+1 == len(format) {
+			b.WriteByte(format[i])
+			continue
+		}
+		i++
+		pad := true
+		if format[i] == '-' && i+1 < len(format) {
+			pad = false
+			i++
+		}
+		number := func(n int) {
+			if pad {
+				fmt.Fprintf(&b, "%02d", n)
+			} else {
+				b.WriteString(strconv.Itoa(n))
+			}
+		}
+		switch format[i] {
+		case 'Y':
+			b.WriteString(strconv.Itoa(t.Year()))
+		case 'y':
+			fmt.Fprintf(&b, "%02d", t.Year()%100)
+		case 'm':
+			number(int(t.Month()))
+		case 'd':
+			number(t.Day())
+		case 'e':
+			b.WriteString(strconv.Itoa(t.Day()))
+		case 'B':
+			b.WriteString(lf.Months[t.Month()-1])
+		case 'b':
+			b.WriteString(lf.AbbrMonths[t.Month()-1])
+		case 'A':
+			b.WriteString(lf.Days[t.Weekday()])
+		case 'a':
+			b.WriteString(lf.AbbrDays[t.Weekday()])
+		case 'H':
+			number(t.Hour())
+		case 'I':
+			number((t.Hour()+11)%12 + 1)
+		case 'M':
+			number(t.Minute())
+		case 'S':
+			number(t.Second())
+		case 'p':
+			if t.Hour() < 12 {
+				b.WriteString("AM")
+			} else {
+				b.WriteString("PM")
+			}
+		case '%':
+			b.WriteByte('%')
+		default:
+			b.WriteByte('%')
+			b.WriteByte(format[i])
+		}
+	}
+	return b.String()
+}
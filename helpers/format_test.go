@@ -0,0 +1,146 @@
+package helpers
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	. "github.com/acsellers/assert"
+	"github.com/acsellers/multitemplate"
+)
+
+func TestNumberFormat(t *testing.T) {
+	Within(t, func(test *Test) {
+		numberTests := []struct {
+			Locale   string
+			Func     func(string, interface{}, ...AttrList) (string, error)
+			Number   interface{}
+			Attrs    []AttrList
+			Expected string
+		}{
+			{"", numberWithDelimiter, 12345678, nil, "12,345,678"},
+			{"en", numberWithDelimiter, 12345678.05, nil, "12,345,678.05"},
+			{"en", numberWithDelimiter, -1234, nil, "-1,234"},
+			{"en", numberWithDelimiter, 123, nil, "123"},
+			{"de", numberWithDelimiter, 1234567.5, nil, "1.234.567,5"},
+			{"fr", numberWithDelimiter, 1234567, nil, "1 234 567"},
+			{"fr-CA", numberWithDelimiter, 1234, nil, "1 234"},
+			{"en", numberWithDelimiter, 1234567, []AttrList{{"delimiter": "_"}}, "1_234_567"},
+			{"en", numberToCurrency, 1234.5, nil, "$1,234.50"},
+			{"en", numberToCurrency, -1234.5, nil, "-$1,234.50"},
+			{"en", numberToCurrency, 1234, []AttrList{{"precision": 0}}, "$1,234"},
+			{"en", numberToCurrency, 1234, []AttrList{{"locale": "ja"}}, "¥1,234"},
+			{"en-GB", numberToCurrency, 9.99, nil, "£9.99"},
+			{"de", numberToCurrency, 1234.5, nil, "1.234,50 €"},
+			{"pt-BR", numberToCurrency, 1234.5, nil, "R$ 1.234,50"},
+			{"de", numberToCurrency, 10, []AttrList{{"unit": "CHF"}}, "10,00 CHF"},
+			{"en", numberToPercentage, 100, nil, "100.000%"},
+			{"en", numberToPercentage, 12.5, []AttrList{{"precision": 1}}, "12.5%"},
+			{"en", numberToPercentage, 12.5, []AttrList{{"strip_insignificant_zeros": true}}, "12.5%"},
+			{"fr", numberToPercentage, 12.5, []AttrList{{"precision": 1}}, "12,5 %"},
+		}
+		for _, nt := range numberTests {
+			s, e := nt.Func(nt.Locale, nt.Number, nt.Attrs...)
+			test.NoError(e)
+			test.AreEqual(nt.Expected, s)
+		}
+
+		_, e := numberWithDelimiter("en", "many")
+		test.IsError(e)
+		_, e = numberToCurrency("en", 1, AttrList{"precision": "2"})
+		test.IsError(e)
+	})
+}
+
+func TestTimeFormat(t *testing.T) {
+	Within(t, func(test *Test) {
+		from := time.Date(2014, time.March, 7, 9, 5, 0, 0, time.UTC)
+		distanceTests := []struct {
+			Locale   string
+			To       time.Duration
+			Expected string
+		}{
+			{"en", 20 * time.Second, "less than a minute"},
+			{"en", 50 * time.Second, "1 minute"},
+			{"en", 10 * time.Minute, "10 minutes"},
+			{"en", 50 * time.Minute, "about 1 hour"},
+			{"en", 5 * time.Hour, "about 5 hours"},
+			{"en", 30 * time.Hour, "1 day"},
+			{"en", 3 * 24 * time.Hour, "3 days"},
+			{"en", 40 * 24 * time.Hour, "about 1 month"},
+			{"en", 100 * 24 * time.Hour, "3 months"},
+			{"en", 400 * 24 * time.Hour, "about 1 year"},
+			{"en", 500 * 24 * time.Hour, "over 1 year"},
+			{"en", 700 * 24 * time.Hour, "almost 2 years"},
+			{"en", -3 * 24 * time.Hour, "3 days"},
+			{"fr", 5 * time.Hour, "environ 5 heures"},
+			{"de", 3 * 24 * time.Hour, "3 Tage"},
+			{"ja", 10 * time.Minute, "10分"},
+		}
+		for _, dt := range distanceTests {
+			test.AreEqual(dt.Expected, distanceOfTimeInWords(dt.Locale, from, from.Add(dt.To)))
+		}
+		test.AreEqual("10 Minuten", distanceOfTimeInWords("en", from, from.Add(10*time.Minute), AttrList{"locale": "de"}))
+
+		dateTests := []struct {
+			Locale, Format, Expected string
+			Formats                  func(*LocaleFormat) map[string]string
+		}{
+			{"en", "", "2014-03-07", nil},
+			{"en", "long", "March 07, 2014", nil},
+			{"en-GB", "", "07/03/2014", nil},
+			{"fr", "long", "7 mars 2014", nil},
+			{"de", "", "07.03.2014", nil},
+			{"es", "long", "7 de marzo de 2014", nil},
+			{"ja", "long", "2014年3月7日(金)", nil},
+			{"en", "%A %-d %B", "Friday 7 March", nil},
+			{"en", "short", "07 Mar 09:05", func(lf *LocaleFormat) map[string]string { return lf.TimeFormats }},
+			{"de", "long", "Freitag, 07. März 2014, 09:05 Uhr", func(lf *LocaleFormat) map[string]string { return lf.TimeFormats }},
+		}
+		for _, dt := range dateTests {
+			lf := findLocaleFormat(dt.Locale)
+			formats := lf.DateFormats
+			if dt.Formats != nil {
+				formats = dt.Formats(lf)
+			}
+			var format []string
+			if dt.Format != "" {
+				format = []string{dt.Format}
+			}
+			test.AreEqual(dt.Expected, formatTime(lf, from, formats, format))
+		}
+	})
+}
+
+func TestFormatLocale(t *testing.T) {
+	Within(t, func(test *Test) {
+		LoadHelpers("format")
+		tmpl, e := multitemplate.New("format").Parse(
+			"price",
+			`{{ number_to_currency .Price }} {{ format_date .Date "long" }} {{ time_ago_in_words .Date }}`,
+			"tmpl",
+		)
+		test.NoError(e)
+
+		data := map[string]interface{}{
+			"Price": 1234.5,
+			"Date":  time.Now().Add(-3 * 24 * time.Hour),
+		}
+		c := multitemplate.NewContext(data)
+		c.Main = "price"
+		c.Locale = "de"
+		b := bytes.Buffer{}
+		test.NoError(tmpl.ExecuteContext(&b, c))
+		expected := "1.234,50 € " + localStrftime(LocaleFormats["de"], data["Date"].(time.Time), "%e. %B %Y") + " 3 Tage"
+		test.AreEqual(expected, b.String())
+
+		b.Reset()
+		test.NoError(tmpl.ExecuteTemplate(&b, "price", data))
+		test.AreEqual(true, bytes.HasPrefix(b.Bytes(), []byte("$1,234.50 ")))
+
+		f := GetHelpers("format")["number_with_delimiter"].(func(interface{}, ...AttrList) (string, error))
+		s, e := f(1234)
+		test.NoError(e)
+		test.AreEqual("1,234", s)
+	})
+}
@@ -10,7 +10,8 @@ import (
 // multitemplate function map. All modules
 // depend on a "core" module that will always be loaded. The modules may
 // be all be loaded by asking for the "all" module, or they can be loaded
-// by their names, which are "form", "general", "link" and "asset".
+// by their names, which are "form", "general", "link", "asset" and
+// "format".
 func LoadHelpers(modules ...string) {
 	loadFuncs(coreFuncs)
 	for _, module := range modules {
@@ -18,18 +19,23 @@ func LoadHelpers(modules ...string) {
 		case "all":
 			loadFuncs(formTagFuncs)
 			loadFuncs(selectTagFuncs)
+			loadContextFuncs(csrfFuncs)
 			loadFuncs(generalFuncs)
 			loadFuncs(linkFuncs)
 			loadFuncs(assetFuncs)
+			loadContextFuncs(formatFuncs)
 		case "form":
 			loadFuncs(formTagFuncs)
 			loadFuncs(selectTagFuncs)
+			loadContextFuncs(csrfFuncs)
 		case "general":
 			loadFuncs(generalFuncs)
 		case "link":
 			loadFuncs(linkFuncs)
 		case "asset":
 			loadFuncs(assetFuncs)
+		case "format":
+			loadContextFuncs(formatFuncs)
 		}
 	}
 }
@@ -38,7 +44,8 @@ func LoadHelpers(modules ...string) {
 // then returns that FuncMap. Since helpers does not depend on
 // any special functions from multitemplate, this would allow
 // you to use these helpers in any Go template library that allows
-// you to add helper functions.
+// you to add helper functions. Without a Context, the format helpers
+// use English and forms don't have a CSRF token.
 func GetHelpers(modules ...string) template.FuncMap {
 	tf := template.FuncMap{}
 	getFuncs(tf, coreFuncs)
@@ -47,23 +54,55 @@ func GetHelpers(modules ...string) template.FuncMap {
 		case "all":
 			getFuncs(tf, formTagFuncs)
 			getFuncs(tf, selectTagFuncs)
+			getContextFuncs(tf, csrfFuncs)
 			getFuncs(tf, generalFuncs)
 			getFuncs(tf, linkFuncs)
 			getFuncs(tf, assetFuncs)
+			getContextFuncs(tf, formatFuncs)
 		case "forms":
 			getFuncs(tf, formTagFuncs)
 			getFuncs(tf, selectTagFuncs)
+			getContextFuncs(tf, csrfFuncs)
 		case "general":
 			getFuncs(tf, generalFuncs)
 		case "link":
 			getFuncs(tf, linkFuncs)
 		case "asset":
 			getFuncs(tf, assetFuncs)
+		case "format":
+			getContextFuncs(tf, formatFuncs)
 		}
 	}
 	return tf
 }
 
+// GetContextHelpers returns the helpers of the modules that use the
+// Context of the render, for Template.ContextFuncs, so they can be added
+// to one template set without changing the others. They replace the
+// helpers from GetHelpers with the same names, like form_tag, which then
+// add the CSRF token of the Context.
+func GetContextHelpers(modules ...string) map[string]multitemplate.ContextFunc {
+	cf := map[string]multitemplate.ContextFunc{}
+	for _, module := range modules {
+		switch module {
+		case "all":
+			copyContextFuncs(cf, csrfFuncs)
+			copyContextFuncs(cf, formatFuncs)
+		case "form", "forms":
+			copyContextFuncs(cf, csrfFuncs)
+		case "format":
+			copyContextFuncs(cf, formatFuncs)
+		}
+	}
+	return cf
+}
+
+func copyContextFuncs(host, fs map[string]multitemplate.ContextFunc) {
+	for k, f := range fs {
+		host[k] = f
+	}
+}
+
 func loadFuncs(tf template.FuncMap) {
 	for k, f := range tf {
 		multitemplate.LoadedFuncs[k] = f
@@ -75,3 +114,16 @@ func getFuncs(host, source template.FuncMap) {
 		host[k] = f
 	}
 }
+
+func loadContextFuncs(fs map[string]multitemplate.ContextFunc) {
+	for k, f := range fs {
+		multitemplate.ContextFuncs[k] = f
+	}
+}
+
+func getContextFuncs(host template.FuncMap, fs map[string]multitemplate.ContextFunc) {
+	noContext := func() *multitemplate.Context { return nil }
+	for k, f := range fs {
+		host[k] = f(noContext)
+	}
+}
@@ -0,0 +1,357 @@
+package multitemplate
+
+import (
+	"fmt"
+	"html/template"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// A Catalog holds the translated messages for each locale, for the t and
+// translate functions. Messages are looked up in the locale of the
+// Context, then the language without its region, like "fr" for "fr-CA",
+// then the Fallback locale.
+type Catalog struct {
+	// Fallback is the locale used for messages missing from a locale
+	Fallback string
+
+	mu       sync.RWMutex
+	messages map[string]map[string]message
+}
+
+// A message is the forms of a translation by plural category, a message
+// that isn't pluralized only has the other form.
+type message map[string]string
+
+// NewCatalog returns an empty Catalog, which uses the fallback locale
+// for messages missing from other locales.
+func NewCatalog(fallback string) *Catalog {
+	return &Catalog{Fallback: fallback, messages: map[string]map[string]message{}}
+}
+
+// Set adds a message to a locale.
+func (c *Catalog) Set(locale, key, text string) {
+	c.SetPlural(locale, key, map[string]string{"other": text})
+}
+
+// SetPlural adds a message with a form for each plural category used by
+// the locale, like "one" and "other" for English.
+func (c *Catalog) SetPlural(locale, key string, forms map[string]string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.messages == nil {
+		c.messages = map[string]map[string]message{}
+	}
+	if c.messages[locale] == nil {
+		c.messages[locale] = map[string]message{}
+	}
+	m := message{}
+	for k, v := range forms {
+		m[k] = v
+	}
+	c.messages[locale][key] = m
+}
+
+// Locales returns the locales that have messages, sorted.
+func (c *Catalog) Locales() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	locales := make([]string, 0, len(c.messages))
+	for l := range c.messages {
+		locales = append(locales, l)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// Translate returns the message for key in the locale with the args
+// interpolated into it. Args are pairs of names and values, each
+// replacing %{name} in the message, and a value named count picks the
+// plural form of the message. Values in messages with keys ending in
+// _html or .html are HTML escaped, unless they are template.HTML.
+func (c *Catalog) Translate(locale, key string, args ...interface{}) (string, error) {
+	vars, e := newLocals(args...)
+	if e != nil {
+		return "", e
+	}
+	m, found := c.lookup(locale, key)
+	if m == nil {
+		return "", fmt.Errorf("translation missing: %s.%s", locale, key)
+	}
+
+	text, ok := m["other"]
+	if count, hasCount := vars["count"]; hasCount {
+		if form, ok2 := m[pluralRule(found).category(count)]; ok2 {
+			text, ok = form, true
+		}
+	}
+	if !ok {
+		return "", fmt.Errorf("translation %s.%s has no form for %v", found, key, vars["count"])
+	}
+	return interpolate(text, vars, htmlKey(key)), nil
+}
+
+// lookup finds the message for key, returning the locale it was found in.
+func (c *Catalog) lookup(locale, key string) (message, string) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, l := range localeChain(locale, c.Fallback) {
+		if m, ok := c.messages[l][key]; ok {
+			return m, l
+		}
+	}
+	return nil, ""
+}
+
+// localeChain lists the locales to try for a locale, from the most to the
+// least specific.
+func localeChain(locale, fallback string) []string {
+	chain := []string{}
+	add := func(l string) {
+		if l == "" {
+			return
+		}
+		for _, c := range chain {
+			if c == l {
+				return
+			}
+		}
+		chain = append(chain, l)
+	}
+	for _, l := range []string{locale, fallback} {
+		add(l)
+		if i := strings.IndexAny(l, "-_"); i > 0 {
+			add(l[:i])
+		}
+	}
+	return chain
+}
+
+func htmlKey(key string) bool {
+	return strings.HasSuffix(key, "_html") || strings.HasSuffix(key, ".html")
+}
+
+// interpolate replaces each %{name} in text with the value of name,
+// names without a value are left alone.
+func interpolate(text string, vars locals, escape bool) string {
+	if len(vars) == 0 || !strings.Contains(text, "%{") {
+		return text
+	}
+	var b strings.Builder
+	for {
+		start := strings.Index(text, "%{")
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(text[start:], '}')
+		if end < 0 {
+			break
+		}
+		end += start
+		v, ok := vars[text[start+2:end]]
+		if !ok {
+			b.WriteString(text[:end+1])
+			text = text[end+1:]
+			continue
+		}
+		b.WriteString(text[:start])
+		if h, isHTML := v.(template.HTML); isHTML || !escape {
+			if isHTML {
+				b.WriteString(string(h))
+			} else {
+				b.WriteString(fmt.Sprint(v))
+			}
+		} else {
+			b.WriteString(template.HTMLEscapeString(fmt.Sprint(v)))
+		}
+		text = text[end+1:]
+	}
+	b.WriteString(text)
+	return b.String()
+}
+
+// A PluralRule picks the plural category of a count for a locale.
+type PluralRule struct {
+	// Forms are the categories the locale uses, in the order of the
+	// plural forms of gettext catalogs
+	Forms []string
+	// Form returns the category for a count
+	Form func(n int64) string
+}
+
+// category returns the category for a count, counts that aren't whole
+// numbers use the other category.
+func (pr PluralRule) category(count interface{}) string {
+	v := reflect.ValueOf(count)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return pr.Form(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return pr.Form(int64(v.Uint()))
+	case reflect.Float32, reflect.Float64:
+		if f := v.Float(); f == float64(int64(f)) {
+			return pr.Form(int64(f))
+		}
+	}
+	return "other"
+}
+
+var (
+	oneOther = PluralRule{
+		Forms: []string{"one", "other"},
+		Form: func(n int64) string {
+			if n == 1 {
+				return "one"
+			}
+			return "other"
+		},
+	}
+	zeroOneOther = PluralRule{
+		Forms: []string{"one", "other"},
+		Form: func(n int64) string {
+			if n == 0 || n == 1 {
+				return "one"
+			}
+			return "other"
+		},
+	}
+	otherOnly = PluralRule{
+		Forms: []string{"other"},
+		Form:  func(n int64) string { return "other" },
+	}
+	eastSlavic = PluralRule{
+		Forms: []string{"one", "few", "many"},
+		Form: func(n int64) string {
+			switch {
+			case n%10 == 1 && n%100 != 11:
+				return "one"
+			case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+				return "few"
+			}
+			return "many"
+		},
+	}
+	westSlavic = PluralRule{
+		Forms: []string{"one", "few", "other"},
+		Form: func(n int64) string {
+			switch {
+			case n == 1:
+				return "one"
+			case n >= 2 && n <= 4:
+				return "few"
+			}
+			return "other"
+		},
+	}
+)
+
+// PluralRules are the plural rules for each language, languages without
+// a rule use the English rule of one and other. Rules can be added for
+// other languages or regions.
+var PluralRules = map[string]PluralRule{
+	"en": oneOther,
+	"de": oneOther,
+	"nl": oneOther,
+	"sv": oneOther,
+	"da": oneOther,
+	"no": oneOther,
+	"es": oneOther,
+	"it": oneOther,
+	"pt": zeroOneOther,
+	"fr": zeroOneOther,
+	"ru": eastSlavic,
+	"uk": eastSlavic,
+	"cs": westSlavic,
+	"sk": westSlavic,
+	"pl": {
+		Forms: []string{"one", "few", "many"},
+		Form: func(n int64) string {
+			switch {
+			case n == 1:
+				return "one"
+			case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+				return "few"
+			}
+			return "many"
+		},
+	},
+	"ar": {
+		Forms: []string{"zero", "one", "two", "few", "many", "other"},
+		Form: func(n int64) string {
+			switch {
+			case n == 0:
+				return "zero"
+			case n == 1:
+				return "one"
+			case n == 2:
+				return "two"
+			case n%100 >= 3 && n%100 <= 10:
+				return "few"
+			case n%100 >= 11:
+				return "many"
+			}
+			return "other"
+		},
+	},
+	"ja": otherOnly,
+	"ko": otherOnly,
+	"zh": otherOnly,
+	"vi": otherOnly,
+	"th": otherOnly,
+	"id": otherOnly,
+	"tr": otherOnly,
+}
+
+// pluralRule returns the rule for a locale, trying the locale before its
+// language.
+func pluralRule(locale string) PluralRule {
+	for _, l := range localeChain(locale, "") {
+		if pr, ok := PluralRules[l]; ok {
+			return pr
+		}
+	}
+	return oneOther
+}
+
+// translate is the t function, it returns template.HTML for keys of HTML
+// messages so they aren't escaped again.
+func (c *Context) translate(key string, args []interface{}) (interface{}, error) {
+	if c.Catalog == nil {
+		return "", fmt.Errorf("translation missing: %s.%s, the Context has no Catalog", c.Locale, key)
+	}
+	text, e := c.Catalog.Translate(c.Locale, key, args...)
+	if e != nil || !htmlKey(key) {
+		return text, e
+	}
+	return template.HTML(text), nil
+}
+
+// localized returns the name of the template for the locale of the
+// Context, "users/show.fr.html" for "users/show.html" in French, or name
+// if there isn't one.
+func (c *Context) localized(name string) string {
+	if c.Locale == "" || c.tmpl == nil {
+		return name
+	}
+	for _, l := range localeChain(c.Locale, "") {
+		if ln := localizedName(name, l); c.tmpl.defined(ln) {
+			return ln
+		}
+	}
+	return name
+}
+
+// localizedName puts the locale before the last extension of the name.
+func localizedName(name, locale string) string {
+	base, exts := extensions(name)
+	if len(exts) == 0 {
+		return name + "." + locale
+	}
+	// extensions are listed from the last one back
+	for i := len(exts) - 1; i > 0; i-- {
+		base = base + "." + exts[i]
+	}
+	return base + "." + locale + "." + exts[0]
+}
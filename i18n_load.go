@@ -0,0 +1,407 @@
+package multitemplate
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// LoadFile adds the messages in a JSON, YAML or gettext .po file to the
+// catalog, going by the extension of the file. JSON and YAML files have
+// a locale at the top level, with messages nested under it, and the .po
+// file's locale comes from its Language header or the name of the file.
+func (c *Catalog) LoadFile(filename string) error {
+	f, e := os.Open(filename)
+	if e != nil {
+		return e
+	}
+	defer f.Close()
+
+	switch ext := filepath.Ext(filename); ext {
+	case ".json":
+		e = c.LoadJSON(f)
+	case ".yml", ".yaml":
+		e = c.LoadYAML(f)
+	case ".po":
+		e = c.LoadPO(strings.TrimSuffix(filepath.Base(filename), ext), f)
+	default:
+		return fmt.Errorf("multitemplate: can't load translations from %s", filename)
+	}
+	if e != nil {
+		return fmt.Errorf("multitemplate: %s: %v", filename, e)
+	}
+	return nil
+}
+
+// LoadGlob loads each file matching the pattern with LoadFile.
+func (c *Catalog) LoadGlob(pattern string) error {
+	filenames, e := filepath.Glob(pattern)
+	if e != nil {
+		return e
+	}
+	for _, f := range filenames {
+		if e = c.LoadFile(f); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+// LoadJSON adds the messages from a JSON object of locales. Keys of
+// nested objects are joined with dots, and an object whose keys are all
+// plural categories is the plural forms of one message.
+//
+//	{"fr": {"users": {"count": {"one": "%{count} utilisateur", "other": "%{count} utilisateurs"}}}}
+func (c *Catalog) LoadJSON(r io.Reader) error {
+	var locales map[string]interface{}
+	if e := json.NewDecoder(r).Decode(&locales); e != nil {
+		return e
+	}
+	return c.addTree(locales)
+}
+
+// LoadYAML adds messages from YAML laid out the same as for LoadJSON. Only
+// nested mappings of plain, single or double quoted strings are
+// understood, along with comments.
+func (c *Catalog) LoadYAML(r io.Reader) error {
+	locales, e := parseYAML(r)
+	if e != nil {
+		return e
+	}
+	return c.addTree(locales)
+}
+
+func (c *Catalog) addTree(locales map[string]interface{}) error {
+	for locale, tree := range locales {
+		messages, ok := tree.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("locale %s must contain messages, not %T", locale, tree)
+		}
+		if e := c.addMessages(locale, "", messages); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+func (c *Catalog) addMessages(locale, prefix string, tree map[string]interface{}) error {
+	if forms, ok := pluralForms(tree); ok {
+		c.SetPlural(locale, strings.TrimSuffix(prefix, "."), forms)
+		return nil
+	}
+	for k, v := range tree {
+		switch v := v.(type) {
+		case string:
+			c.Set(locale, prefix+k, v)
+		case map[string]interface{}:
+			if e := c.addMessages(locale, prefix+k+".", v); e != nil {
+				return e
+			}
+		default:
+			return fmt.Errorf("message %s.%s%s must be a string, not %T", locale, prefix, k, v)
+		}
+	}
+	return nil
+}
+
+var pluralCategories = map[string]bool{
+	"zero": true, "one": true, "two": true, "few": true, "many": true, "other": true,
+}
+
+// pluralForms returns the tree as plural forms, if its keys are all
+// plural categories with strings.
+func pluralForms(tree map[string]interface{}) (map[string]string, bool) {
+	if len(tree) == 0 {
+		return nil, false
+	}
+	forms := map[string]string{}
+	for k, v := range tree {
+		s, ok := v.(string)
+		if !ok || !pluralCategories[k] {
+			return nil, false
+		}
+		forms[k] = s
+	}
+	return forms, true
+}
+
+// parseYAML reads the subset of YAML used for translations.
+func parseYAML(r io.Reader) (map[string]interface{}, error) {
+	type level struct {
+		indent int
+		tree   map[string]interface{}
+	}
+	root := map[string]interface{}{}
+	stack := []level{{0, root}}
+	// the mapping a key without a value opened, waiting for its first key
+	var opened map[string]interface{}
+
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		trimmed := strings.TrimLeft(line, " ")
+		if trimmed == "" || trimmed[0] == '#' || trimmed == "---" {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, fmt.Errorf("line %d: tabs can't be used to indent", lineNo)
+		}
+		indent := len(line) - len(trimmed)
+
+		if opened != nil {
+			if indent <= stack[len(stack)-1].indent {
+				return nil, fmt.Errorf("line %d: expected an indented mapping", lineNo)
+			}
+			stack = append(stack, level{indent, opened})
+			opened = nil
+		}
+		for indent < stack[len(stack)-1].indent {
+			stack = stack[:len(stack)-1]
+		}
+		if indent != stack[len(stack)-1].indent {
+			return nil, fmt.Errorf("line %d: indentation doesn't match an earlier line", lineNo)
+		}
+
+		key, value, e := yamlPair(trimmed)
+		if e != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNo, e)
+		}
+		tree := stack[len(stack)-1].tree
+		if value == nil {
+			opened = map[string]interface{}{}
+			tree[key] = opened
+		} else {
+			tree[key] = *value
+		}
+	}
+	if e := scanner.Err(); e != nil {
+		return nil, e
+	}
+	if opened != nil {
+		return nil, fmt.Errorf("expected a mapping at the end of the file")
+	}
+	return root, nil
+}
+
+// yamlPair splits a "key: value" line, value is nil for a key that starts
+// a nested mapping.
+func yamlPair(line string) (string, *string, error) {
+	var key string
+	var e error
+	rest := line
+	if line[0] == '"' || line[0] == '\'' {
+		key, rest, e = yamlQuoted(line)
+		if e != nil {
+			return "", nil, e
+		}
+		if !strings.HasPrefix(rest, ":") {
+			return "", nil, fmt.Errorf("expected a colon after the key")
+		}
+		rest = rest[1:]
+	} else {
+		i := strings.Index(line, ":")
+		if i < 0 {
+			return "", nil, fmt.Errorf("expected a key and a colon")
+		}
+		key, rest = strings.TrimSpace(line[:i]), line[i+1:]
+	}
+
+	if rest != "" && rest[0] != ' ' {
+		return "", nil, fmt.Errorf("expected a space after the colon")
+	}
+	rest = strings.TrimSpace(rest)
+	if rest == "" || rest[0] == '#' {
+		return key, nil, nil
+	}
+	var value string
+	switch rest[0] {
+	case '"', '\'':
+		var after string
+		value, after, e = yamlQuoted(rest)
+		if e != nil {
+			return "", nil, e
+		}
+		if after = strings.TrimSpace(after); after != "" && after[0] != '#' {
+			return "", nil, fmt.Errorf("unexpected text after the value")
+		}
+	case '|', '>', '[', '{', '&', '*', '!':
+		return "", nil, fmt.Errorf("only plain and quoted strings can be used as values")
+	default:
+		value = rest
+		if i := strings.Index(value, " #"); i >= 0 {
+			value = strings.TrimSpace(value[:i])
+		}
+	}
+	return key, &value, nil
+}
+
+// yamlQuoted reads a quoted string from the start of s, returning the
+// rest of s after it.
+func yamlQuoted(s string) (string, string, error) {
+	if s[0] == '\'' {
+		var b strings.Builder
+		for i := 1; i < len(s); i++ {
+			if s[i] == '\'' {
+				if i+1 < len(s) && s[i+1] == '\'' {
+					b.WriteByte('\'')
+					i++
+					continue
+				}
+				return b.String(), s[i+1:], nil
+			}
+			b.WriteByte(s[i])
+		}
+		return "", "", fmt.Errorf("unterminated string")
+	}
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			value, e := strconv.Unquote(s[:i+1])
+			return value, s[i+1:], e
+		}
+	}
+	return "", "", fmt.Errorf("unterminated string")
+}
+
+// LoadPO adds the messages from a gettext .po file, with the msgid as the
+// key, or the msgctxt and msgid joined by a dot. Plural forms are matched
+// to the categories of the locale's PluralRule in order. The locale is
+// taken from the Language header when there is one. Fuzzy and untranslated
+// messages are skipped.
+func (c *Catalog) LoadPO(locale string, r io.Reader) error {
+	type entry struct {
+		ctxt, id, plural string
+		strs             map[int]*string
+		fuzzy            bool
+	}
+	var entries []entry
+	var current entry
+	// the string that continuation lines are appended to
+	var target *string
+	started := false
+
+	flush := func() {
+		if started {
+			entries = append(entries, current)
+		}
+		current, target, started = entry{strs: map[int]*string{}}, nil, false
+	}
+	flush()
+
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+			flush()
+			continue
+		case strings.HasPrefix(line, "#"):
+			if started && target != nil {
+				flush()
+			}
+			if strings.HasPrefix(line, "#,") && strings.Contains(line, "fuzzy") {
+				current.fuzzy = true
+			}
+			continue
+		case line[0] == '"':
+			if target == nil {
+				return fmt.Errorf("line %d: string without a keyword", lineNo)
+			}
+			s, e := strconv.Unquote(line)
+			if e != nil {
+				return fmt.Errorf("line %d: %v", lineNo, e)
+			}
+			*target += s
+			continue
+		}
+
+		keyword, quoted, _ := strings.Cut(line, " ")
+		s, e := strconv.Unquote(strings.TrimSpace(quoted))
+		if e != nil {
+			return fmt.Errorf("line %d: %v", lineNo, e)
+		}
+		if keyword == "msgctxt" || (keyword == "msgid" && started && target != &current.ctxt) {
+			flush()
+		}
+		started = true
+		switch {
+		case keyword == "msgctxt":
+			current.ctxt, target = s, &current.ctxt
+		case keyword == "msgid":
+			current.id, target = s, &current.id
+		case keyword == "msgid_plural":
+			current.plural, target = s, &current.plural
+		case keyword == "msgstr":
+			current.strs[0] = &s
+			target = &s
+		case strings.HasPrefix(keyword, "msgstr[") && strings.HasSuffix(keyword, "]"):
+			n, e := strconv.Atoi(keyword[len("msgstr[") : len(keyword)-1])
+			if e != nil {
+				return fmt.Errorf("line %d: bad plural form %s", lineNo, keyword)
+			}
+			current.strs[n] = &s
+			target = &s
+		default:
+			return fmt.Errorf("line %d: unknown keyword %s", lineNo, keyword)
+		}
+	}
+	if e := scanner.Err(); e != nil {
+		return e
+	}
+	flush()
+
+	str := func(en entry, n int) string {
+		if s, ok := en.strs[n]; ok {
+			return *s
+		}
+		return ""
+	}
+	for _, en := range entries {
+		if en.id == "" && en.ctxt == "" {
+			for _, header := range strings.Split(str(en, 0), "\n") {
+				if name, value, ok := strings.Cut(header, ":"); ok && strings.TrimSpace(name) == "Language" {
+					if value = strings.TrimSpace(value); value != "" {
+						locale = value
+					}
+				}
+			}
+		}
+	}
+	if locale == "" {
+		return fmt.Errorf("the locale of the catalog isn't known")
+	}
+
+	forms := pluralRule(locale).Forms
+	for _, en := range entries {
+		if en.fuzzy || en.id == "" {
+			continue
+		}
+		key := en.id
+		if en.ctxt != "" {
+			key = en.ctxt + "." + en.id
+		}
+		if en.plural == "" {
+			if s := str(en, 0); s != "" {
+				c.Set(locale, key, s)
+			}
+			continue
+		}
+		translated := map[string]string{}
+		for i, form := range forms {
+			if s := str(en, i); s != "" {
+				translated[form] = s
+			}
+		}
+		if len(translated) > 0 {
+			c.SetPlural(locale, key, translated)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+package multitemplate
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/acsellers/assert"
+)
+
+const catalogJSON = `{
+  "en": {
+    "users": {
+      "title": "Users",
+      "greeting_html": "Hello <b>%{name}</b>",
+      "count": {"one": "%{count} user", "other": "%{count} users"}
+    }
+  },
+  "fr": {
+    "users": {
+      "title": "Utilisateurs",
+      "count": {"one": "%{count} utilisateur", "other": "%{count} utilisateurs"}
+    }
+  }
+}`
+
+const catalogYAML = `# Russian messages
+ru:
+  users:
+    title: Пользователи
+    'count':
+      one: "%{count} пользователь"
+      few: "%{count} пользователя"
+      many: '%{count} пользователей'
+`
+
+const catalogPO = `# German messages
+msgid ""
+msgstr ""
+"Language: de\n"
+"Plural-Forms: nplurals=2; plural=(n != 1);\n"
+
+msgid "Users"
+msgstr "Benutzer"
+
+#, fuzzy
+msgid "Settings"
+msgstr "Einstellungen"
+
+msgctxt "menu"
+msgid "Open"
+msgstr "Öffnen"
+
+msgid "%{count} user"
+msgid_plural "%{count} users"
+msgstr[0] "%{count} Benutzer"
+msgstr[1] ""
+"%{count} Benutzer "
+"insgesamt"
+`
+
+func testCatalog(test *Test) *Catalog {
+	c := NewCatalog("en")
+	test.NoError(c.LoadJSON(strings.NewReader(catalogJSON)))
+	test.NoError(c.LoadYAML(strings.NewReader(catalogYAML)))
+	test.NoError(c.LoadPO("", strings.NewReader(catalogPO)))
+	return c
+}
+
+func TestCatalogTranslate(t *testing.T) {
+	Within(t, func(test *Test) {
+		c := testCatalog(test)
+		test.AreEqual([]string{"de", "en", "fr", "ru"}, c.Locales())
+
+		translations := []struct {
+			Locale, Key string
+			Args        []interface{}
+			Expected    string
+		}{
+			{"en", "users.title", nil, "Users"},
+			{"fr", "users.title", nil, "Utilisateurs"},
+			{"fr-CA", "users.title", nil, "Utilisateurs"},
+			{"es", "users.title", nil, "Users"},
+			{"en", "users.count", []interface{}{"count", 1}, "1 user"},
+			{"en", "users.count", []interface{}{"count", 0}, "0 users"},
+			{"fr", "users.count", []interface{}{"count", 0}, "0 utilisateur"},
+			{"fr", "users.count", []interface{}{"count", 2}, "2 utilisateurs"},
+			{"ru", "users.title", nil, "Пользователи"},
+			{"ru", "users.count", []interface{}{"count", 1}, "1 пользователь"},
+			{"ru", "users.count", []interface{}{"count", 3}, "3 пользователя"},
+			{"ru", "users.count", []interface{}{"count", 11}, "11 пользователей"},
+			{"ru", "users.count", []interface{}{"count", 22}, "22 пользователя"},
+			{"de", "Users", nil, "Benutzer"},
+			{"de", "menu.Open", nil, "Öffnen"},
+			{"de", "%{count} user", []interface{}{"count", 1}, "1 Benutzer"},
+			{"de", "%{count} user", []interface{}{"count", 5}, "5 Benutzer insgesamt"},
+			{"en", "users.greeting_html", []interface{}{"name", "<Ann>"}, "Hello <b>&lt;Ann&gt;</b>"},
+		}
+		for _, tr := range translations {
+			s, e := c.Translate(tr.Locale, tr.Key, tr.Args...)
+			test.NoError(e)
+			test.AreEqual(tr.Expected, s)
+		}
+
+		_, e := c.Translate("de", "Settings")
+		test.IsError(e)
+		_, e = c.Translate("en", "users.missing")
+		test.IsError(e)
+		_, e = c.Translate("en", "users.count", "count")
+		test.IsError(e)
+	})
+}
+
+func TestCatalogLoadFile(t *testing.T) {
+	Within(t, func(test *Test) {
+		dir := t.TempDir()
+		test.NoError(os.WriteFile(filepath.Join(dir, "en.json"), []byte(catalogJSON), 0644))
+		test.NoError(os.WriteFile(filepath.Join(dir, "ru.yml"), []byte(catalogYAML), 0644))
+		test.NoError(os.WriteFile(filepath.Join(dir, "pt.po"), []byte("msgid \"Users\"\nmsgstr \"Usuários\"\n"), 0644))
+
+		c := NewCatalog("en")
+		test.NoError(c.LoadGlob(filepath.Join(dir, "*")))
+		test.AreEqual([]string{"en", "fr", "pt", "ru"}, c.Locales())
+		s, e := c.Translate("pt-BR", "Users")
+		test.NoError(e)
+		test.AreEqual("Usuários", s)
+
+		test.NoError(os.WriteFile(filepath.Join(dir, "bad.yml"), []byte("en:\n  list: [1, 2]\n"), 0644))
+		test.IsError(c.LoadFile(filepath.Join(dir, "bad.yml")))
+	})
+}
+
+func TestTranslateFunc(t *testing.T) {
+	Within(t, func(test *Test) {
+		tmpl, e := New("i18n").Parse("page", `<h1>{{ t "users.title" }}</h1><p>{{ translate "users.count" "count" (len .) }}</p>{{ t "users.greeting_html" "name" "<Ann>" }}`, "tmpl")
+		test.NoError(e)
+
+		c := NewContext([]string{"ann", "bob"})
+		c.Main = "page"
+		c.Catalog = testCatalog(test)
+		b := bytes.Buffer{}
+		test.NoError(tmpl.ExecuteContext(&b, c))
+		test.AreEqual(`<h1>Users</h1><p>2 users</p>Hello <b>&lt;Ann&gt;</b>`, b.String())
+
+		c = NewContext([]string{"ann"})
+		c.Main = "page"
+		c.Locale = "fr"
+		c.Catalog = testCatalog(test)
+		b.Reset()
+		test.NoError(tmpl.ExecuteContext(&b, c))
+		test.AreEqual(`<h1>Utilisateurs</h1><p>1 utilisateur</p>Hello <b>&lt;Ann&gt;</b>`, b.String())
+
+		c = NewContext(nil)
+		c.Main = "page"
+		b.Reset()
+		test.IsError(tmpl.ExecuteContext(&b, c))
+	})
+}
+
+func TestLocalizedTemplates(t *testing.T) {
+	Within(t, func(test *Test) {
+		tmpl := New("i18n")
+		for name, src := range map[string]string{
+			"users/show.html":    `<p>{{ exec "users/name.html" . }}</p>`,
+			"users/show.fr.html": `<p lang="fr">{{ exec "users/name.html" . }}</p>`,
+			"users/name.html":    `name`,
+			"users/name.fr.html": `nom`,
+			"layout.html":        `<main>{{ yield }}</main>`,
+		} {
+			var e error
+			tmpl, e = tmpl.Parse(name, src, "tmpl")
+			test.NoError(e)
+		}
+
+		for locale, expected := range map[string]string{
+			"":      `<main><p>name</p></main>`,
+			"en":    `<main><p>name</p></main>`,
+			"fr":    `<main><p lang="fr">nom</p></main>`,
+			"fr-CA": `<main><p lang="fr">nom</p></main>`,
+		} {
+			c := NewContext(nil)
+			c.Main = "users/show.html"
+			c.Layout = "layout.html"
+			c.Locale = locale
+			b := bytes.Buffer{}
+			test.NoError(tmpl.ExecuteContext(&b, c))
+			test.AreEqual(expected, b.String())
+		}
+
+		// files are named with the locale before the format
+		dir := t.TempDir()
+		test.NoError(os.WriteFile(filepath.Join(dir, "show.html.tmpl"), []byte("show"), 0644))
+		test.NoError(os.WriteFile(filepath.Join(dir, "show.fr.html.tmpl"), []byte("montrer"), 0644))
+		files := New("files")
+		files.Base = dir
+		files, e := files.ParseGlob(filepath.Join(dir, "*.tmpl"))
+		test.NoError(e)
+		c := NewContext(nil)
+		c.Main = "show.html"
+		c.Locale = "fr"
+		b := bytes.Buffer{}
+		test.NoError(files.ExecuteContext(&b, c))
+		test.AreEqual("montrer", b.String())
+
+		test.AreEqual("users/show.fr.html", localizedName("users/show.html", "fr"))
+		test.AreEqual("app.min.fr.js", localizedName("app.min.js", "fr"))
+		test.AreEqual("users/show.fr", localizedName("users/show", "fr"))
+	})
+}
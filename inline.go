@@ -0,0 +1,708 @@
+package multitemplate
+
+import (
+	"html"
+	"sort"
+	"strings"
+)
+
+// InlineCSS moves the rules of the style elements in an HTML document
+// into the style attributes of the elements they match, since many mail
+// clients ignore style elements. Selectors may use tags, ids, classes,
+// attributes and the descendant and child combinators. Rules that can't
+// be inlined, like media queries and :hover, are left in their style
+// element, and style elements left empty are removed. Style elements with
+// a media attribute other than all or screen are left alone.
+func InlineCSS(doc string) string {
+	elements, styles := scanHTML(doc)
+	if len(styles) == 0 {
+		return doc
+	}
+
+	var rules []cssRule
+	var edits []htmlEdit
+	for _, s := range styles {
+		if media, ok := s.el.lookup("media"); ok && !screenMedia(media) {
+			continue
+		}
+		r, rest := parseCSS(doc[s.content:s.close], len(rules))
+		rules = append(rules, r...)
+		if rest == "" {
+			edits = append(edits, htmlEdit{s.el.start, s.end, ""})
+		} else {
+			edits = append(edits, htmlEdit{s.content, s.close, "\n" + rest})
+		}
+	}
+
+	for _, el := range elements {
+		if unstyled(el) {
+			continue
+		}
+		var matches []cssMatch
+		for _, r := range rules {
+			if r.selector.matches(el) {
+				for _, d := range r.decls {
+					matches = append(matches, cssMatch{d, r.selector.specificity, r.order})
+				}
+			}
+		}
+		if len(matches) == 0 {
+			continue
+		}
+		sort.SliceStable(matches, func(i, j int) bool {
+			if matches[i].specificity != matches[j].specificity {
+				return matches[i].specificity < matches[j].specificity
+			}
+			return matches[i].order < matches[j].order
+		})
+		style, _ := el.lookup("style")
+		edits = append(edits, el.styleEdit(cascade(matches, parseDecls(style))))
+	}
+
+	sort.Slice(edits, func(i, j int) bool { return edits[i].start < edits[j].start })
+	b := strings.Builder{}
+	last := 0
+	for _, e := range edits {
+		b.WriteString(doc[last:e.start])
+		b.WriteString(e.text)
+		last = e.end
+	}
+	b.WriteString(doc[last:])
+	return b.String()
+}
+
+// htmlEdit replaces the document between start and end with text.
+type htmlEdit struct {
+	start, end int
+	text       string
+}
+
+type htmlAttr struct {
+	name, value string
+	// the value in the document, including quotes, or where it would go
+	start, end int
+	hasValue   bool
+}
+
+type htmlElement struct {
+	name   string
+	attrs  []htmlAttr
+	parent *htmlElement
+	// start is the offset of the <, close of the > or /> of the start tag
+	start, close int
+}
+
+// lookup returns the value of an attribute of the element.
+func (el *htmlElement) lookup(name string) (string, bool) {
+	for _, a := range el.attrs {
+		if a.name == name {
+			return a.value, true
+		}
+	}
+	return "", false
+}
+
+// styleEdit sets the style attribute of the element to decls.
+func (el *htmlElement) styleEdit(decls []cssDecl) htmlEdit {
+	value := `"` + html.EscapeString(formatDecls(decls)) + `"`
+	for _, a := range el.attrs {
+		if a.name == "style" {
+			if a.hasValue {
+				return htmlEdit{a.start, a.end, value}
+			}
+			return htmlEdit{a.start, a.start, "=" + value}
+		}
+	}
+	return htmlEdit{el.close, el.close, " style=" + value}
+}
+
+// styleSpan is a style element, from its start tag to the end of its end
+// tag, with its content between content and close.
+type styleSpan struct {
+	el                  *htmlElement
+	content, close, end int
+}
+
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true,
+	"hr": true, "img": true, "input": true, "link": true, "meta": true,
+	"source": true, "track": true, "wbr": true,
+}
+
+var rawTextElements = map[string]bool{
+	"script": true, "style": true, "textarea": true, "title": true,
+}
+
+// unstyled reports whether an element isn't displayed, so styles aren't
+// inlined into it.
+func unstyled(el *htmlElement) bool {
+	if el.name == "html" {
+		return true
+	}
+	for ; el != nil; el = el.parent {
+		switch el.name {
+		case "head", "title", "meta", "link", "style", "script", "base":
+			return true
+		}
+	}
+	return false
+}
+
+func screenMedia(media string) bool {
+	media = strings.ToLower(strings.TrimSpace(media))
+	return media == "" || media == "all" || media == "screen"
+}
+
+// scanHTML finds the elements of a document, with the elements they are
+// nested in, and its style elements. It is lenient rather than correct,
+// end tags close the nearest open element with their name.
+func scanHTML(doc string) ([]*htmlElement, []styleSpan) {
+	var elements, open []*htmlElement
+	var styles []styleSpan
+	for i := 0; i < len(doc); {
+		lt := strings.IndexByte(doc[i:], '<')
+		if lt < 0 {
+			break
+		}
+		i += lt
+		switch {
+		case strings.HasPrefix(doc[i:], "<!--"):
+			end := strings.Index(doc[i+4:], "-->")
+			if end < 0 {
+				return elements, styles
+			}
+			i += 4 + end + 3
+		case strings.HasPrefix(doc[i:], "</"):
+			name := strings.ToLower(doc[i+2 : i+2+tagNameLen(doc[i+2:])])
+			gt := strings.IndexByte(doc[i:], '>')
+			if gt < 0 {
+				return elements, styles
+			}
+			i += gt + 1
+			for j := len(open) - 1; j >= 0; j-- {
+				if open[j].name == name {
+					open = open[:j]
+					break
+				}
+			}
+		case i+1 < len(doc) && isLetter(doc[i+1]):
+			el, end := scanTag(doc, i)
+			if el == nil {
+				return elements, styles
+			}
+			if len(open) > 0 {
+				el.parent = open[len(open)-1]
+			}
+			elements = append(elements, el)
+			i = end
+			if voidElements[el.name] || doc[el.close] == '/' {
+				continue
+			}
+			if rawTextElements[el.name] {
+				close := indexEndTag(doc[i:], el.name)
+				if close < 0 {
+					return elements, styles
+				}
+				if el.name == "style" {
+					end := len(doc)
+					if gt := strings.IndexByte(doc[i+close:], '>'); gt >= 0 {
+						end = i + close + gt + 1
+					}
+					styles = append(styles, styleSpan{el, i, i + close, end})
+				}
+				i += close
+				continue
+			}
+			open = append(open, el)
+		default:
+			// doctypes, processing instructions and stray <
+			i++
+		}
+	}
+	return elements, styles
+}
+
+// scanTag reads the start tag at start, returning the element and the
+// offset after the tag, or nil if the tag isn't closed.
+func scanTag(doc string, start int) (*htmlElement, int) {
+	i := start + 1 + tagNameLen(doc[start+1:])
+	el := &htmlElement{name: strings.ToLower(doc[start+1 : i]), start: start}
+	for i < len(doc) {
+		if isSpace(doc[i]) {
+			i++
+			continue
+		}
+		switch doc[i] {
+		case '>':
+			el.close = i
+			return el, i + 1
+		case '/':
+			if strings.HasPrefix(doc[i:], "/>") {
+				el.close = i
+				return el, i + 2
+			}
+			i++
+			continue
+		}
+
+		ns := i
+		for i < len(doc) && !isSpace(doc[i]) && !strings.ContainsRune("/>=", rune(doc[i])) {
+			i++
+		}
+		if ns == i {
+			i++
+			continue
+		}
+		a := htmlAttr{name: strings.ToLower(doc[ns:i]), start: i, end: i}
+		j := i
+		for j < len(doc) && isSpace(doc[j]) {
+			j++
+		}
+		if j < len(doc) && doc[j] == '=' {
+			j++
+			for j < len(doc) && isSpace(doc[j]) {
+				j++
+			}
+			a.start, a.hasValue = j, true
+			if j < len(doc) && (doc[j] == '"' || doc[j] == '\'') {
+				q := strings.IndexByte(doc[j+1:], doc[j])
+				if q < 0 {
+					return nil, 0
+				}
+				a.value = doc[j+1 : j+1+q]
+				j += q + 2
+			} else {
+				for j < len(doc) && !isSpace(doc[j]) && doc[j] != '>' {
+					j++
+				}
+				a.value = doc[a.start:j]
+			}
+			a.value = html.UnescapeString(a.value)
+			a.end, i = j, j
+		}
+		el.attrs = append(el.attrs, a)
+	}
+	return nil, 0
+}
+
+// indexEndTag finds the end tag for a raw text element, ignoring case.
+func indexEndTag(s, name string) int {
+	for i := strings.Index(s, "</"); i >= 0; {
+		tag := s[i+2:]
+		if len(tag) >= len(name) && strings.EqualFold(tag[:len(name)], name) {
+			return i
+		}
+		next := strings.Index(s[i+2:], "</")
+		if next < 0 {
+			break
+		}
+		i += 2 + next
+	}
+	return -1
+}
+
+func tagNameLen(s string) int {
+	i := 0
+	for i < len(s) && !isSpace(s[i]) && s[i] != '>' && s[i] != '/' {
+		i++
+	}
+	return i
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+type cssDecl struct {
+	property, value string
+	important       bool
+}
+
+type cssRule struct {
+	selector cssSelector
+	decls    []cssDecl
+	order    int
+}
+
+type cssMatch struct {
+	decl               cssDecl
+	specificity, order int
+}
+
+// cssSelector is a selector split into its compound selectors, starting
+// with the one for the element it styles.
+type cssSelector struct {
+	parts       []cssCompound
+	specificity int
+}
+
+type cssCompound struct {
+	tag     string
+	id      string
+	classes []string
+	attrs   []cssAttr
+	// child is whether the next compound must match the parent of the
+	// element, instead of any ancestor
+	child bool
+}
+
+type cssAttr struct {
+	name, op, value string
+}
+
+func (s cssSelector) matches(el *htmlElement) bool {
+	return matchParts(s.parts, el)
+}
+
+func matchParts(parts []cssCompound, el *htmlElement) bool {
+	if !parts[0].matches(el) {
+		return false
+	}
+	if len(parts) == 1 {
+		return true
+	}
+	if parts[0].child {
+		return el.parent != nil && matchParts(parts[1:], el.parent)
+	}
+	for p := el.parent; p != nil; p = p.parent {
+		if matchParts(parts[1:], p) {
+			return true
+		}
+	}
+	return false
+}
+
+func (cp cssCompound) matches(el *htmlElement) bool {
+	if cp.tag != "" && cp.tag != el.name {
+		return false
+	}
+	if id, _ := el.lookup("id"); cp.id != "" && cp.id != id {
+		return false
+	}
+	class, _ := el.lookup("class")
+	for _, c := range cp.classes {
+		if !hasWord(class, c) {
+			return false
+		}
+	}
+	for _, a := range cp.attrs {
+		v, ok := el.lookup(a.name)
+		switch {
+		case !ok:
+			return false
+		case a.op == "=" && v != a.value:
+			return false
+		case a.op == "~=" && !hasWord(v, a.value):
+			return false
+		}
+	}
+	return true
+}
+
+func hasWord(list, word string) bool {
+	for _, w := range strings.Fields(list) {
+		if w == word {
+			return true
+		}
+	}
+	return false
+}
+
+// parseCSS splits a style sheet into the rules that can be inlined and the
+// CSS that has to stay in a style element. order numbers the rules, so
+// rules from later style elements win.
+func parseCSS(css string, order int) (rules []cssRule, rest string) {
+	css = stripComments(css)
+	kept := []string{}
+	for i := 0; i < len(css); {
+		if isSpace(css[i]) {
+			i++
+			continue
+		}
+		if css[i] == '@' {
+			end := atRuleEnd(css, i)
+			kept = append(kept, strings.TrimSpace(css[i:end]))
+			i = end
+			continue
+		}
+
+		open := strings.IndexByte(css[i:], '{')
+		if open < 0 {
+			break
+		}
+		open += i
+		end := len(css)
+		if close := strings.IndexByte(css[open:], '}'); close >= 0 {
+			end = open + close
+		}
+		body := strings.TrimSpace(css[open+1 : end])
+		decls := parseDecls(body)
+		unsupported := []string{}
+		for _, s := range strings.Split(css[i:open], ",") {
+			if sel, ok := parseSelector(s); ok {
+				rules = append(rules, cssRule{sel, decls, order + len(rules)})
+			} else if s = strings.TrimSpace(s); s != "" {
+				unsupported = append(unsupported, s)
+			}
+		}
+		if len(unsupported) > 0 {
+			kept = append(kept, strings.Join(unsupported, ", ")+" { "+body+" }")
+		}
+		i = end + 1
+	}
+	if len(kept) == 0 {
+		return rules, ""
+	}
+	return rules, strings.Join(kept, "\n") + "\n"
+}
+
+func stripComments(css string) string {
+	for {
+		start := strings.Index(css, "/*")
+		if start < 0 {
+			return css
+		}
+		end := strings.Index(css[start+2:], "*/")
+		if end < 0 {
+			return css[:start]
+		}
+		css = css[:start] + css[start+2+end+2:]
+	}
+}
+
+// atRuleEnd returns the offset after the at-rule starting at i, either
+// after its semicolon or the end of its block.
+func atRuleEnd(css string, i int) int {
+	depth := 0
+	var quote byte
+	for ; i < len(css); i++ {
+		c := css[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ';' && depth == 0:
+			return i + 1
+		case c == '{':
+			depth++
+		case c == '}':
+			depth--
+			if depth <= 0 {
+				return i + 1
+			}
+		}
+	}
+	return len(css)
+}
+
+// parseSelector parses a selector made of tags, ids, classes and
+// attributes joined by the descendant and child combinators.
+func parseSelector(s string) (cssSelector, bool) {
+	sel := cssSelector{}
+	child := false
+	for i := 0; i < len(s); {
+		switch {
+		case isSpace(s[i]):
+			i++
+			continue
+		case s[i] == '>':
+			if child || len(sel.parts) == 0 {
+				return sel, false
+			}
+			child = true
+			i++
+			continue
+		}
+		cp, n, ok := parseCompound(s[i:])
+		if !ok {
+			return sel, false
+		}
+		cp.child, child = child, false
+		sel.parts = append(sel.parts, cp)
+		sel.specificity += cp.specificity()
+		i += n
+	}
+	if child || len(sel.parts) == 0 {
+		return sel, false
+	}
+	// the compounds are matched from the element out to its ancestors
+	n := len(sel.parts)
+	for i := 0; i < n/2; i++ {
+		sel.parts[i], sel.parts[n-1-i] = sel.parts[n-1-i], sel.parts[i]
+	}
+	return sel, true
+}
+
+func parseCompound(s string) (cp cssCompound, n int, ok bool) {
+	i := 0
+	if s[0] == '*' {
+		i = 1
+	} else {
+		i = cssNameLen(s)
+		cp.tag = strings.ToLower(s[:i])
+	}
+	for i < len(s) {
+		switch s[i] {
+		case '#', '.':
+			j := cssNameLen(s[i+1:])
+			if j == 0 {
+				return cp, 0, false
+			}
+			if s[i] == '#' {
+				cp.id = s[i+1 : i+1+j]
+			} else {
+				cp.classes = append(cp.classes, s[i+1:i+1+j])
+			}
+			i += 1 + j
+		case '[':
+			end := strings.IndexByte(s[i:], ']')
+			if end < 0 {
+				return cp, 0, false
+			}
+			a, ok := parseAttrSelector(s[i+1 : i+end])
+			if !ok {
+				return cp, 0, false
+			}
+			cp.attrs = append(cp.attrs, a)
+			i += end + 1
+		case ' ', '\t', '\n', '\r', '\f', '>':
+			return cp, i, i > 0
+		default:
+			return cp, 0, false
+		}
+	}
+	return cp, i, i > 0
+}
+
+func (cp cssCompound) specificity() int {
+	s := 0
+	if cp.id != "" {
+		s += 10000
+	}
+	s += 100 * (len(cp.classes) + len(cp.attrs))
+	if cp.tag != "" {
+		s++
+	}
+	return s
+}
+
+func parseAttrSelector(s string) (cssAttr, bool) {
+	s = strings.TrimSpace(s)
+	for _, op := range []string{"~=", "="} {
+		if i := strings.Index(s, op); i > 0 {
+			name := strings.TrimSpace(s[:i])
+			value := strings.Trim(strings.TrimSpace(s[i+len(op):]), `"'`)
+			return cssAttr{strings.ToLower(name), op, value}, cssNameLen(name) == len(name)
+		}
+	}
+	return cssAttr{name: strings.ToLower(s)}, s != "" && cssNameLen(s) == len(s)
+}
+
+func cssNameLen(s string) int {
+	i := 0
+	for i < len(s) {
+		c := s[i]
+		if !(isLetter(c) || c >= '0' && c <= '9' || c == '-' || c == '_' || c >= 0x80) {
+			break
+		}
+		i++
+	}
+	return i
+}
+
+// parseDecls parses the declarations of a rule or style attribute.
+func parseDecls(s string) []cssDecl {
+	var decls []cssDecl
+	for _, d := range splitDecls(s) {
+		i := strings.IndexByte(d, ':')
+		if i < 0 {
+			continue
+		}
+		decl := cssDecl{
+			property: strings.ToLower(strings.TrimSpace(d[:i])),
+			value:    strings.TrimSpace(d[i+1:]),
+		}
+		if j := strings.LastIndexByte(decl.value, '!'); j >= 0 && strings.EqualFold(strings.TrimSpace(decl.value[j+1:]), "important") {
+			decl.value, decl.important = strings.TrimSpace(decl.value[:j]), true
+		}
+		if decl.property != "" && decl.value != "" {
+			decls = append(decls, decl)
+		}
+	}
+	return decls
+}
+
+// splitDecls splits declarations on the semicolons that aren't in quotes
+// or parentheses, like those in a data URL.
+func splitDecls(s string) []string {
+	var parts []string
+	depth, last := 0, 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ';' && depth <= 0:
+			parts = append(parts, s[last:i])
+			last = i + 1
+		}
+	}
+	return append(parts, s[last:])
+}
+
+// cascade merges the declarations matched from style elements with those
+// of the style attribute. Important declarations from style elements win
+// over the attribute, but they aren't marked important when inlined so
+// that media queries left in a style element can still override them.
+func cascade(matches []cssMatch, inline []cssDecl) []cssDecl {
+	var decls []cssDecl
+	index := map[string]int{}
+	set := func(d cssDecl) {
+		if i, ok := index[d.property]; ok {
+			decls[i] = d
+			return
+		}
+		index[d.property] = len(decls)
+		decls = append(decls, d)
+	}
+	for _, important := range []bool{false, true} {
+		for _, m := range matches {
+			if m.decl.important == important {
+				set(cssDecl{m.decl.property, m.decl.value, false})
+			}
+		}
+		for _, d := range inline {
+			if d.important == important {
+				set(d)
+			}
+		}
+	}
+	return decls
+}
+
+func formatDecls(decls []cssDecl) string {
+	parts := make([]string, len(decls))
+	for i, d := range decls {
+		parts[i] = d.property + ": " + d.value
+		if d.important {
+			parts[i] += " !important"
+		}
+	}
+	return strings.Join(parts, "; ")
+}
@@ -0,0 +1,103 @@
+package multitemplate
+
+import (
+	"bytes"
+	"testing"
+
+	. "github.com/acsellers/assert"
+)
+
+func TestAppendPrependBlocks(tst *testing.T) {
+	Within(tst, func(test *Test) {
+		t := parseSet(test, map[string]string{
+			"site":    `<head>{{ exec_block "scripts" }}<script src="site.js"></script>{{ end_block }}</head><title>{{ exec_block "title" }}Site{{ end_block }}</title>{{ yield "extra" . }}{{ yield }}`,
+			"admin":   `{{ append_block "scripts" }}<script src="admin.js"></script>{{ end_block }}{{ define_block "title" }}Admin | {{ super_block }}{{ end_block }}{{ yield }}`,
+			"page":    `{{ append_block "scripts" }}<script src="page.js"></script>{{ end_block }}{{ prepend_block "scripts" }}<meta>{{ end_block }}{{ define_block "title" }}Users | {{ super_block }}{{ end_block }}page`,
+			"extra":   `{{ append_block "extra" }}<p>extra</p>{{ end_block }}page`,
+			"claimed": `{{ define_block "scripts" }}<script src="claimed.js"></script>{{ end_block }}page`,
+		})
+
+		for _, stream := range []bool{false, true} {
+			c := NewContext(nil)
+			c.Main = "page"
+			c.Layout = "site"
+			c.Stream = stream
+			b := &bytes.Buffer{}
+			test.NoError(t.ExecuteContext(b, c))
+			test.AreEqual(`<head><meta><script src="site.js"></script><script src="page.js"></script></head><title>Users | Site</title>page`, b.String())
+		}
+
+		// appended content is added to a claimed block too
+		c := NewContext(nil)
+		c.Main = "claimed"
+		c.Layouts = []string{"admin"}
+		c.Layout = "site"
+		b := &bytes.Buffer{}
+		test.NoError(t.ExecuteContext(b, c))
+		test.AreEqual(`<head><script src="claimed.js"></script><script src="admin.js"></script></head><title>Admin | Site</title>page`, b.String())
+
+		// a yield with nothing but appended content outputs it
+		c = NewContext(nil)
+		c.Main = "extra"
+		c.Layout = "site"
+		b.Reset()
+		test.NoError(t.ExecuteContext(b, c))
+		test.AreEqual(`<head><script src="site.js"></script></head><title>Site</title><p>extra</p>page`, b.String())
+	})
+}
+
+func TestSuperBlock(tst *testing.T) {
+	Within(tst, func(test *Test) {
+		t := parseSet(test, map[string]string{
+			"site":     `<head>{{ exec_block "scripts" }}<script src="site.js"></script>{{ end_block }}</head><title>{{ exec_block "title" }}Site{{ end_block }}</title>{{ yield }}`,
+			"admin":    `{{ append_block "scripts" }}<script src="admin.js"></script>{{ end_block }}{{ define_block "title" }}Admin | {{ super_block }}{{ end_block }}{{ yield }}`,
+			"override": `{{ define_block "title" }}Override{{ end_block }}{{ yield }}`,
+			"page":     `{{ append_block "scripts" }}<script src="page.js"></script>{{ end_block }}{{ prepend_block "scripts" }}<meta>{{ end_block }}{{ define_block "title" }}Users | {{ super_block }}{{ end_block }}page`,
+			"base":     `<title>{{ exec_block "title" }}Base{{ end_block }}</title>`,
+			"child":    `{{ extend "base" }}{{ define_block "title" }}Child | {{ super_block }}{{ end_block }}`,
+		})
+
+		// layouts further out are closer to the default content
+		c := NewContext(nil)
+		c.Main = "page"
+		c.Layouts = []string{"admin"}
+		c.Layout = "site"
+		b := &bytes.Buffer{}
+		test.NoError(t.ExecuteContext(b, c))
+		test.AreEqual(`<head><meta><script src="site.js"></script><script src="admin.js"></script><script src="page.js"></script></head><title>Users | Admin | Site</title>page`, b.String())
+
+		// an override without super_block replaces the default content
+		c = NewContext(nil)
+		c.Main = "page"
+		c.Layouts = []string{"override"}
+		c.Layout = "site"
+		b.Reset()
+		test.NoError(t.ExecuteContext(b, c))
+		test.AreEqual(`<head><meta><script src="site.js"></script><script src="page.js"></script></head><title>Users | Override</title>page`, b.String())
+
+		// extended templates are further out than the templates extending them
+		c = NewContext(nil)
+		c.Main = "child"
+		b.Reset()
+		test.NoError(t.ExecuteContext(b, c))
+		test.AreEqual(`<title>Child | Base</title>`, b.String())
+	})
+}
+
+func TestContextAppendBlock(tst *testing.T) {
+	Within(tst, func(test *Test) {
+		t := parseSet(test, map[string]string{
+			"site": `<head>{{ exec_block "scripts" }}<script src="site.js"></script>{{ end_block }}</head><title>{{ exec_block "title" }}Site{{ end_block }}</title>{{ yield }}`,
+			"page": `{{ append_block "scripts" }}<script src="page.js"></script>{{ end_block }}{{ prepend_block "scripts" }}<meta>{{ end_block }}{{ define_block "title" }}Users | {{ super_block }}{{ end_block }}page`,
+		})
+
+		c := NewContext(nil)
+		c.Main = "page"
+		c.Layout = "site"
+		c.AppendBlock("scripts", RenderedBlock{Content: `<script src="app.js"></script>`})
+		c.PrependBlock("title", RenderedBlock{Content: "App: "})
+		b := &bytes.Buffer{}
+		test.NoError(t.ExecuteContext(b, c))
+		test.AreEqual(`<head><meta><script src="site.js"></script><script src="page.js"></script><script src="app.js"></script></head><title>App: Users | Site</title>page`, b.String())
+	})
+}
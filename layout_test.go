@@ -0,0 +1,40 @@
+package multitemplate
+
+import (
+	"bytes"
+	"testing"
+
+	. "github.com/acsellers/assert"
+)
+
+func TestLayoutChain(tst *testing.T) {
+	Within(tst, func(test *Test) {
+		tmpl := parseSet(test, map[string]string{
+			"main":  `{{ define_block "title" }}Users{{ end_block }}{{ content_for "side" "side" }}<p>users</p>`,
+			"admin": `{{ define_block "title" }}Admin{{ end_block }}{{ define_block "nav" }}<nav>admin</nav>{{ end_block }}<div class="admin">{{ yield }}</div>`,
+			"site":  `<body>{{ yield "nav" }}{{ yield "side" }}{{ yield }}</body>`,
+			"shell": `<html><title>{{ yield "title" }}</title>{{ yield }}</html>`,
+			"side":  `<aside>side</aside>`,
+		})
+
+		expected := `<html><title>Users</title><body><nav>admin</nav><aside>side</aside><div class="admin"><p>users</p></div></body></html>`
+		for _, stream := range []bool{false, true} {
+			c := NewContext(nil)
+			c.Main = "main"
+			c.Layouts = []string{"admin", "site"}
+			c.Layout = "shell"
+			c.Stream = stream
+			b := bytes.Buffer{}
+			test.NoError(tmpl.ExecuteContext(&b, c))
+			test.AreEqual(expected, b.String())
+		}
+
+		// Layouts works without Layout
+		c := NewContext(nil)
+		c.Main = "side"
+		c.Layouts = []string{"admin", "shell"}
+		b := bytes.Buffer{}
+		test.NoError(tmpl.ExecuteContext(&b, c))
+		test.AreEqual(`<html><title>Admin</title><div class="admin"><aside>side</aside></div></html>`, b.String())
+	})
+}
@@ -0,0 +1,113 @@
+package multitemplate
+
+import (
+	"fmt"
+	"io/fs"
+	"strings"
+)
+
+// A Loader parses the templates in a file system into a Template, so the
+// templates for an application can come from an embed.FS, a zip archive or
+// a map in memory as easily as from a directory. Templates are named by
+// their path in the file system without the extension of their parser,
+// so "app/index.html.bham" is named "app/index.html" and parsed by bham.
+// Files and directories starting with a dot are skipped.
+type Loader struct {
+	// FS holds the templates, use fs.Sub to load from a directory in it
+	FS fs.FS
+	// Filter decides which files are loaded by their path, every file is
+	// loaded when it is nil
+	Filter func(path string) bool
+	// OnError is called with the error of each template that fails to
+	// parse, if it returns nil Load carries on with the other templates
+	OnError func(path string, err error) error
+	// Strict makes Load run Check once the templates are parsed, and
+	// return a *CheckError if references in them are broken
+	Strict bool
+}
+
+// NewLoader returns a Loader for the templates in fsys.
+func NewLoader(fsys fs.FS) *Loader {
+	return &Loader{FS: fsys}
+}
+
+// Load parses every template in the Loader's file system into t. It stops
+// at the first template that fails to parse, unless OnError lets it
+// carry on. If the Loader is Strict, a *CheckError is returned along with
+// the loaded set when references in it are broken.
+func (l *Loader) Load(t *Template) (*Template, error) {
+	err := walkTemplates(l.FS, l.Filter, func(path string, d fs.DirEntry) error {
+		tt, err := parseFS(t, l.FS, path)
+		if err != nil {
+			if l.OnError != nil {
+				return l.OnError(path, err)
+			}
+			return err
+		}
+		t = tt
+		return nil
+	})
+	if err == nil && l.Strict {
+		err = t.Check()
+	}
+	return t, err
+}
+
+// walkTemplates calls fn for every file in fsys that a Loader with filter
+// would load.
+func walkTemplates(fsys fs.FS, filter func(string) bool, fn func(path string, d fs.DirEntry) error) error {
+	return fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != "." && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || (filter != nil && !filter(path)) {
+			return nil
+		}
+		return fn(path, d)
+	})
+}
+
+// ParseFS is like ParseFiles or ParseGlob, but reads from fsys. The files
+// matching the patterns are named the same way as by a Loader.
+func ParseFS(fsys fs.FS, patterns ...string) (*Template, error) {
+	return New("root").ParseFS(fsys, patterns...)
+}
+
+// ParseFS parses the files in fsys matching the patterns into t, the files
+// are named the same way as by a Loader.
+func (t *Template) ParseFS(fsys fs.FS, patterns ...string) (*Template, error) {
+	var filenames []string
+	for _, pattern := range patterns {
+		list, err := fs.Glob(fsys, pattern)
+		if err != nil {
+			return nil, err
+		}
+		if len(list) == 0 {
+			return nil, fmt.Errorf("multitemplate: no files match pattern: %#q", pattern)
+		}
+		filenames = append(filenames, list...)
+	}
+	for _, f := range filenames {
+		tt, err := parseFS(t, fsys, f)
+		if err != nil {
+			return t, err
+		}
+		t = tt
+	}
+	return t, nil
+}
+
+func parseFS(t *Template, fsys fs.FS, path string) (*Template, error) {
+	b, err := fs.ReadFile(fsys, path)
+	if err != nil {
+		return nil, err
+	}
+	name, parser := templateName(path)
+	return t.parse(name, source{file: path, src: string(b), parser: parser})
+}
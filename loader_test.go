@@ -0,0 +1,121 @@
+package multitemplate
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	. "github.com/acsellers/assert"
+)
+
+var loaderFiles = map[string]string{
+	"layouts/main.html.tmpl": `<html>{{ yield }}</html>`,
+	"app/index.html.tmpl":    `<p>{{ . }}</p>`,
+	"app/plain.html":         `<b>plain</b>`,
+	".hidden/skip.html.tmpl": `{{ broken`,
+	"app/.swap.html.tmpl":    `{{ broken`,
+}
+
+func loaderMapFS() fstest.MapFS {
+	fsys := fstest.MapFS{}
+	for name, src := range loaderFiles {
+		fsys[name] = &fstest.MapFile{Data: []byte(src)}
+	}
+	return fsys
+}
+
+func renderLoaded(test *Test, tmpl *Template) {
+	c := NewContext("loaded")
+	c.Main = "app/index.html"
+	c.Layout = "layouts/main.html"
+	b := bytes.Buffer{}
+	test.NoError(tmpl.ExecuteContext(&b, c))
+	test.AreEqual("<html><p>loaded</p></html>", b.String())
+
+	b.Reset()
+	test.NoError(tmpl.ExecuteTemplate(&b, "app/plain.html", nil))
+	test.AreEqual("<b>plain</b>", b.String())
+}
+
+func TestLoaderMapFS(t *testing.T) {
+	Within(t, func(test *Test) {
+		tmpl, e := NewLoader(loaderMapFS()).Load(New("loader"))
+		test.NoError(e)
+		renderLoaded(test, tmpl)
+	})
+}
+
+func TestLoaderZip(t *testing.T) {
+	Within(t, func(test *Test) {
+		b := bytes.Buffer{}
+		zw := zip.NewWriter(&b)
+		for name, src := range loaderFiles {
+			w, e := zw.Create(name)
+			test.NoError(e)
+			w.Write([]byte(src))
+		}
+		test.NoError(zw.Close())
+
+		zr, e := zip.NewReader(bytes.NewReader(b.Bytes()), int64(b.Len()))
+		test.NoError(e)
+		tmpl, e := NewLoader(zr).Load(New("loader"))
+		test.NoError(e)
+		renderLoaded(test, tmpl)
+	})
+}
+
+func TestLoaderErrors(t *testing.T) {
+	Within(t, func(test *Test) {
+		fsys := loaderMapFS()
+		fsys["app/broken.html.tmpl"] = &fstest.MapFile{Data: []byte("<p>\n{{ end }}")}
+
+		l := NewLoader(fsys)
+		_, e := l.Load(New("loader"))
+		var me *Error
+		test.AreEqual(true, errors.As(e, &me))
+		test.AreEqual("app/broken.html.tmpl", me.File)
+		test.AreEqual("app/broken.html", me.Name)
+		test.AreEqual(2, me.Line)
+
+		l.Filter = func(path string) bool {
+			return path != "app/broken.html.tmpl"
+		}
+		tmpl, e := l.Load(New("loader"))
+		test.NoError(e)
+		renderLoaded(test, tmpl)
+	})
+}
+
+func TestParseFS(t *testing.T) {
+	Within(t, func(test *Test) {
+		tmpl, e := New("loader").ParseFS(loaderMapFS(), "app/i*", "app/p*", "layouts/*")
+		test.NoError(e)
+		renderLoaded(test, tmpl)
+
+		_, e = ParseFS(loaderMapFS(), "missing/*")
+		test.IsError(e)
+	})
+}
+
+func TestTemplateNames(t *testing.T) {
+	Within(t, func(test *Test) {
+		for path, expected := range map[string]string{
+			"app/index.html.tmpl": "app/index.html",
+			"app/index.html":      "app/index.html",
+			"a.min.js.tmpl":       "a.min.js",
+			"a.min.js":            "a.min.js",
+			"app/list.csv.tmpl":   "app/list.csv",
+		} {
+			name, _ := templateName(path)
+			test.AreEqual(expected, name)
+		}
+
+		fsys := fstest.MapFS{"assets/a.min.js.tmpl": {Data: []byte(`var a = 1;`)}}
+		tmpl, e := NewLoader(fsys).Load(New("loader"))
+		test.NoError(e)
+		test.IsNotNil(tmpl.Lookup("assets/a.min.js"))
+		test.IsNil(tmpl.Lookup("assets/a.js.min"))
+	})
+}
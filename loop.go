@@ -0,0 +1,101 @@
+package multitemplate
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MaxDepth is how deeply templates may be nested by exec, yield, block,
+// partials, components and extend before the render fails with a
+// LoopError, instead of running out of stack. A Sandbox can set a
+// smaller limit.
+var MaxDepth = 250
+
+// A LoopError is returned when templates yield to, extend or exec each
+// other in a loop, or are nested more than MaxDepth deep.
+type LoopError struct {
+	// Chain is the templates, yields and blocks that were being rendered,
+	// from the outermost, ending with the one that looped
+	Chain []string
+	// TooDeep is set when the templates were nested more than MaxDepth
+	// deep, instead of looping back to one of the Chain
+	TooDeep bool
+}
+
+func (e *LoopError) Error() string {
+	if e.TooDeep {
+		return fmt.Sprintf("Templates nested more than %d deep: %s", MaxDepth, strings.Join(e.Chain, " -> "))
+	}
+	return "Templates rendered in a loop: " + strings.Join(e.Chain, " -> ")
+}
+
+// A link is a template, yield or block in the chain of those being
+// rendered by a Context.
+type link struct {
+	step Step
+	name string
+}
+
+// template reports whether the link is a template, rather than a yield
+// or block.
+func (l link) template() bool {
+	return l.step != YieldStep && l.step != BlockStep
+}
+
+// called reports whether the link at i is a template called with exec, a
+// partial or a component, which may be passed different data each time
+// it is rendered, so it can be in the chain more than once.
+func called(chain []link, i int) bool {
+	return chain[i].step == ExecStep && (i == 0 || chain[i-1].template())
+}
+
+// enter adds a template, yield or block to the chain, the returned
+// function takes it off again. Templates reached through yields, blocks
+// and extends are always rendered with the same data, so reaching one of
+// them again since the last template that was called is a loop.
+func (c *Context) enter(step Step, name string) (func(), error) {
+	n, nested := len(c.chain), c.nested
+	leave := func() { c.chain, c.nested = c.chain[:n], nested }
+	next := link{step, name}
+	c.chain = append(c.chain, next)
+	if next.template() {
+		c.nested++
+	}
+
+	if !called(c.chain, n) {
+		for i := n - 1; i >= 0; i-- {
+			if c.chain[i].name == name && c.chain[i].template() == next.template() {
+				return leave, &LoopError{Chain: c.chainNames()}
+			}
+			if called(c.chain, i) {
+				break
+			}
+		}
+	}
+	if s := c.sandbox(); s != nil && s.MaxDepth > 0 && c.nested > s.MaxDepth {
+		return leave, &SandboxError{Limit: "MaxDepth", Detail: fmt.Sprintf("templates are nested more than %d deep", s.MaxDepth)}
+	}
+	if c.nested > MaxDepth {
+		return leave, &LoopError{Chain: c.chainNames(), TooDeep: true}
+	}
+	return leave, nil
+}
+
+// chainNames describes each link of the chain, templates rendered for a
+// yield or block follow it, others say how they were reached.
+func (c *Context) chainNames() []string {
+	names := make([]string, len(c.chain))
+	for i, l := range c.chain {
+		switch {
+		case l.step == YieldStep || l.step == BlockStep:
+			names[i] = fmt.Sprintf("%s %q", l.step, l.name)
+		case l.step == ExtendStep:
+			names[i] = "extend " + l.name
+		case called(c.chain, i) && i > 0:
+			names[i] = "exec " + l.name
+		default:
+			names[i] = l.name
+		}
+	}
+	return names
+}
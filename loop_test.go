@@ -0,0 +1,110 @@
+package multitemplate
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	. "github.com/acsellers/assert"
+)
+
+func TestLoops(t *testing.T) {
+	Within(t, func(test *Test) {
+		tmpl := New("loops")
+		for name, src := range map[string]string{
+			"layouts/main": `<main>{{ yield "content" }}</main>`,
+			"app/index":    `{{ extend "layouts/main" }}<p>index</p>`,
+			"page":         `{{ yield "sidebar" }}`,
+			"side":         `<aside>{{ yield "sidebar" }}</aside>`,
+			"blocks":       `{{ exec_block "nav" }}{{ end_block }}`,
+			"nav":          `<nav>{{ exec_block "nav" }}{{ end_block }}</nav>`,
+			"a":            `{{ extend "b" }}`,
+			"b":            `{{ extend "a" }}`,
+		} {
+			var e error
+			tmpl, e = tmpl.Parse(name, src, "tmpl")
+			test.NoError(e)
+		}
+
+		loopTests := []struct {
+			Main   string
+			Yields map[string]string
+			Chain  string
+		}{
+			{"layouts/main", map[string]string{"content": "app/index"}, `layouts/main -> yield "content" -> app/index -> extend layouts/main`},
+			{"page", map[string]string{"sidebar": "side"}, `page -> yield "sidebar" -> side -> yield "sidebar"`},
+			{"blocks", map[string]string{"nav": "nav"}, `blocks -> block "nav" -> nav -> block "nav"`},
+			{"a", nil, `a -> extend b -> extend a`},
+		}
+		for _, lt := range loopTests {
+			c := NewContext(nil)
+			c.Main = lt.Main
+			for k, v := range lt.Yields {
+				c.Yields[k] = v
+			}
+			b := bytes.Buffer{}
+			e := tmpl.ExecuteContext(&b, c)
+			var le *LoopError
+			test.AreEqual(true, errors.As(e, &le))
+			if le != nil {
+				test.AreEqual(lt.Chain, strings.Join(le.Chain, " -> "))
+				test.AreEqual(false, le.TooDeep)
+			}
+		}
+	})
+}
+
+func TestLoopDepth(t *testing.T) {
+	Within(t, func(test *Test) {
+		defer func(depth int) { MaxDepth = depth }(MaxDepth)
+		MaxDepth = 20
+
+		tmpl := New("loops")
+		for name, src := range map[string]string{
+			"tree":    `<li>{{ range . }}{{ exec "tree" . }}{{ end }}</li>`,
+			"forever": `{{ exec "forever" . }}`,
+		} {
+			var e error
+			tmpl, e = tmpl.Parse(name, src, "tmpl")
+			test.NoError(e)
+		}
+
+		// a template calling itself is fine, as long as it stops
+		b := bytes.Buffer{}
+		test.NoError(tmpl.ExecuteTemplate(&b, "tree", [][][]int{{{}, {}}, {}}))
+		test.AreEqual(`<li><li><li></li><li></li></li><li></li></li>`, b.String())
+
+		e := tmpl.ExecuteTemplate(&b, "forever", nil)
+		var le *LoopError
+		test.AreEqual(true, errors.As(e, &le))
+		if le != nil {
+			test.AreEqual(true, le.TooDeep)
+			test.AreEqual(22, len(le.Chain))
+			test.AreEqual("forever", le.Chain[0])
+			test.AreEqual("exec forever", le.Chain[21])
+		}
+	})
+}
+
+func TestExtendChain(t *testing.T) {
+	Within(t, func(test *Test) {
+		tmpl := New("extends")
+		for name, src := range map[string]string{
+			"child": `{{ extend "mid" }}{{ define_block "title" }}Child{{ end_block }}`,
+			"mid":   `{{ extend "top" }}{{ define_block "body" }}<p>{{ yield "title" }}</p>{{ end_block }}`,
+			"top":   `<h1>{{ yield "title" }}</h1>{{ yield "body" }}`,
+		} {
+			var e error
+			tmpl, e = tmpl.Parse(name, src, "tmpl")
+			test.NoError(e)
+		}
+
+		// rendering the chain twice checks it is left clean
+		for i := 0; i < 2; i++ {
+			b := bytes.Buffer{}
+			test.NoError(tmpl.ExecuteTemplate(&b, "child", nil))
+			test.AreEqual(`<h1>Child</h1><p>Child</p>`, b.String())
+		}
+	})
+}
@@ -42,9 +42,9 @@ import (
 	"fmt"
 	"html/template"
 	"io"
+	"io/fs"
 	"net/http"
 	"os"
-	"path/filepath"
 	"strings"
 
 	"github.com/acsellers/multitemplate"
@@ -77,6 +77,13 @@ type Render interface {
 	SetContentType(string)
 }
 
+// CSRF is available to handlers when CSRF is set in Options.
+type CSRF interface {
+	// ValidCSRF reports whether the request has a CSRF token from one of
+	// the forms rendered for this client
+	ValidCSRF() bool
+}
+
 func (r *renderer) NewContext() *Context {
 	return &Context{
 		Layout:     r.opt.DefaultLayout,
@@ -115,17 +122,21 @@ func Renderer(opt Options) martini.Handler {
 	if opt.Charset == "" {
 		opt.Charset = "utf-8"
 	}
-	mt := multitemplate.New("martini").Funcs(opt.Funcs)
-	var err error
-	mt = mt.Funcs(helpers.GetHelpers(opt.Helpers...))
-	mt, _ = compile(opt, mt)
+	if opt.CSRF && opt.CSRFCookie == "" {
+		opt.CSRFCookie = "_csrf"
+	}
+	reg := registry(opt)
+	if martini.Env == martini.Dev {
+		reg.Watch()
+	} else {
+		reg.Reload()
+	}
 	return func(w http.ResponseWriter, r *http.Request, c martini.Context) {
-		if martini.Env == martini.Dev {
-			mt = multitemplate.New("martini").Funcs(opt.Funcs)
-			mt = mt.Funcs(helpers.GetHelpers(opt.Helpers...))
-			mt, err = compile(opt, mt)
+		rend := &renderer{w, r, reg.Template(), opt, reg.Err()}
+		c.MapTo(rend, (*Render)(nil))
+		if opt.CSRF {
+			c.MapTo(rend, (*CSRF)(nil))
 		}
-		c.MapTo(&renderer{w, r, mt, opt, err}, (*Render)(nil))
 	}
 }
 
@@ -142,34 +153,43 @@ type Options struct {
 	IndentEncoding string
 	// Default is set to utf-8
 	Charset string
+	// CSRF adds a token to the forms rendered with form_tag, which can
+	// be checked with ValidCSRF from the CSRF interface. The secret for
+	// the tokens is kept in a cookie. Only the templates of this Renderer
+	// get the form helpers that add the token.
+	CSRF bool
+	// Name of the cookie for the CSRF secret, default is _csrf
+	CSRFCookie string
 	// Note that you will need to set the delims for each multitemplate
 	// language you are using, you cannot set it in this Options struct.
 }
 
-func compile(opt Options, mt *multitemplate.Template) (*multitemplate.Template, error) {
-	var err error
-	fmt.Println("[multitemplate] Start Template Compile")
-	for _, dir := range opt.Directories {
-		mt.Base = dir
-		e := filepath.Walk(dir, func(path string, i os.FileInfo, e error) error {
-			if !i.IsDir() && strings.Contains(path, "html") {
-				fmt.Println("[multitemplate] Compiling file:", path)
-				_, err := mt.ParseFiles(path)
-				if err == nil {
-					fmt.Println("[multitemplate] Successfully compiled file")
-				} else {
-					fmt.Printf("[multitemplate] Could not compile file: %s\n", err.Error())
-				}
-				return err
-			}
-			return nil
-		})
-		if e != nil && err == nil {
-			err = e
+// registry creates the Registry for the template directories, in
+// development it is watched so changed templates are reloaded.
+func registry(opt Options) *multitemplate.Registry {
+	mt := multitemplate.New("martini").Funcs(opt.Funcs)
+	mt = mt.Funcs(helpers.GetHelpers(opt.Helpers...))
+	if opt.CSRF {
+		// form_tag and csrf_meta_tags need the Context for the token
+		mt = mt.ContextFuncs(helpers.GetContextHelpers("form"))
+	}
+
+	dirs := make([]fs.FS, len(opt.Directories))
+	for i, dir := range opt.Directories {
+		dirs[i] = os.DirFS(dir)
+	}
+	reg := multitemplate.NewRegistry(mt, dirs...)
+	reg.Filter = func(path string) bool {
+		return strings.Contains(path, "html")
+	}
+	reg.OnReload = func(e error) {
+		if e == nil {
+			fmt.Println("[multitemplate] Templates compiled")
+		} else {
+			fmt.Printf("[multitemplate] Could not compile templates: %s\n", e.Error())
 		}
 	}
-	fmt.Println("[multitemplate] End Template Compile")
-	return mt, err
+	return reg
 }
 
 type renderer struct {
@@ -233,17 +253,63 @@ func (r *renderer) HTML(status int, name string, htmlOpt *Context) {
 		ctx.Layout = r.opt.DefaultLayout
 	}
 	ctx.Main = name
+	if r.opt.CSRF {
+		if e := r.setCSRFToken(ctx); e != nil {
+			http.Error(r, e.Error(), 500)
+			return
+		}
+	}
 	b := &bytes.Buffer{}
-	if r.mt == nil || r.mt.Tmpl == nil {
-		panic("here")
+	if r.mt == nil {
+		http.Error(r, r.err.Error(), 500)
+		return
 	}
-	e := r.mt.ExecuteContext(b, ctx)
+	e := r.mt.ExecuteContextWith(r.r.Context(), b, ctx)
 	if e != nil {
 		http.Error(r, e.Error(), 500)
 	}
 	io.Copy(r, b)
 }
 
+// setCSRFToken adds a token for the client's secret to the Context,
+// giving the client a new secret if it doesn't have a usable one.
+func (r *renderer) setCSRFToken(ctx *multitemplate.Context) error {
+	token, e := helpers.MaskCSRFToken(r.csrfSecret())
+	if e != nil {
+		secret, e := helpers.NewCSRFSecret()
+		if e != nil {
+			return e
+		}
+		http.SetCookie(r, &http.Cookie{
+			Name:     r.opt.CSRFCookie,
+			Value:    secret,
+			Path:     "/",
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+		if token, e = helpers.MaskCSRFToken(secret); e != nil {
+			return e
+		}
+	}
+	ctx.CSRFToken = token
+	return nil
+}
+
+func (r *renderer) csrfSecret() string {
+	if c, e := r.r.Cookie(r.opt.CSRFCookie); e == nil {
+		return c.Value
+	}
+	return ""
+}
+
+func (r *renderer) ValidCSRF() bool {
+	token := r.r.Header.Get(helpers.CSRFHeader)
+	if token == "" {
+		token = r.r.FormValue(helpers.CSRFFieldName)
+	}
+	return helpers.ValidCSRFToken(r.csrfSecret(), token)
+}
+
 func (r *renderer) Error(status int) {
 	r.WriteHeader(status)
 }
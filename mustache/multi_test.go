@@ -31,3 +31,35 @@ var simpleTest = templateTest{
 		"mustache": "<b>Test</b>",
 	},
 }
+
+func TestErrorPosition(tst *testing.T) {
+	Within(tst, func(test *Test) {
+		_, e := multitemplate.New("errors").Parse("errors", "<b>\n{{ name }}\n{{ unclosed </b>", "mustache")
+		me, ok := e.(*multitemplate.Error)
+		test.AreEqual(true, ok)
+		test.AreEqual("mustache", me.Parser)
+		test.AreEqual(3, me.Line)
+		test.AreEqual(1, me.Column)
+	})
+}
+
+func TestDecompile(tst *testing.T) {
+	Within(tst, func(test *Test) {
+		src := "<ul>{{#Items}}<li>{{Name}}</li>{{/Items}}{{^Items}}none{{/Items}}</ul>{{{Raw}}}"
+		t, e := multitemplate.New("mustache").Parse("page", src, "mustache")
+		test.IsNil(e)
+		out, e := t.Decompile("page")
+		test.IsNil(e)
+		d, e := multitemplate.New("tmpl").Parse("page", out, "tmpl")
+		test.IsNil(e)
+
+		data := map[string]interface{}{
+			"Items": []map[string]string{{"Name": "a"}, {"Name": "b"}},
+			"Raw":   "<br>",
+		}
+		expected, received := &bytes.Buffer{}, &bytes.Buffer{}
+		test.IsNil(t.ExecuteTemplate(expected, "page", data))
+		test.IsNil(d.ExecuteTemplate(received, "page", data))
+		test.AreEqual(expected.String(), received.String())
+	})
+}
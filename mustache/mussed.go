@@ -39,34 +39,30 @@ func Parse(templateName, templateContent string, funcs ht.FuncMap) (map[string]*
 		name = templateName[:i] + templateName[i+len(".mustache"):]
 	}
 
+	tree := multitemplate.NewTree(name, templateContent)
+	tree.ParseName = templateName
 	proto := &protoTree{
 		source:     templateContent,
 		localRight: RightDelim,
 		localLeft:  LeftDelim,
 		funcs:      funcs,
-		tree: &parse.Tree{
-			Name:      name,
-			ParseName: templateName,
-			Root: &parse.ListNode{
-				NodeType: parse.NodeList,
-				Nodes: []parse.Node{
-					&parse.ActionNode{
-						NodeType: parse.NodeAction,
-						Pipe: &parse.PipeNode{
-							NodeType: parse.NodePipe,
-							Decl: []*parse.VariableNode{
-								&parse.VariableNode{
-									NodeType: parse.NodeVariable,
-									Ident:    []string{"$mustacheCurrent"},
-								},
-							},
-							Cmds: []*parse.CommandNode{
-								&parse.CommandNode{
-									NodeType: parse.NodeCommand,
-									Args:     []parse.Node{&parse.DotNode{}},
-								},
-							},
-						},
+		tree:       tree,
+	}
+	tree.Root.Nodes = []parse.Node{
+		&parse.ActionNode{
+			NodeType: parse.NodeAction,
+			Pipe: &parse.PipeNode{
+				NodeType: parse.NodePipe,
+				Decl: []*parse.VariableNode{
+					&parse.VariableNode{
+						NodeType: parse.NodeVariable,
+						Ident:    []string{"$mustacheCurrent"},
+					},
+				},
+				Cmds: []*parse.CommandNode{
+					&parse.CommandNode{
+						NodeType: parse.NodeCommand,
+						Args:     []parse.Node{&parse.DotNode{}},
 					},
 				},
 			},
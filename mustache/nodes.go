@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"strings"
 	"text/template/parse"
+
+	"github.com/acsellers/multitemplate"
 )
 
 func newTextNode(s string) *parse.TextNode {
@@ -43,7 +45,7 @@ func (pt *protoTree) newFuncNode(w string) *parse.CommandNode {
 	}
 }
 
-func newBlockNode(a string) (*parse.Tree, *parse.IfNode, *parse.ListNode) {
+func (pt *protoTree) newBlockNode(a string) (*parse.Tree, *parse.IfNode, *parse.ListNode) {
 	tmplName := fmt.Sprintf("mustacheAnonymous%d", mangleNum)
 	mangleNum++
 	startList := []parse.Node{
@@ -67,14 +69,9 @@ func newBlockNode(a string) (*parse.Tree, *parse.IfNode, *parse.ListNode) {
 		},
 	}
 
-	tree := &parse.Tree{
-		Name:      tmplName,
-		ParseName: a,
-		Root: &parse.ListNode{
-			NodeType: parse.NodeList,
-			Nodes:    startList,
-		},
-	}
+	tree := multitemplate.NewTree(tmplName, pt.source)
+	tree.ParseName = pt.tree.ParseName
+	tree.Root.Nodes = startList
 	return tree, newBlockChooseNode(tmplName, a), tree.Root
 }
 
@@ -7,6 +7,8 @@ import (
 	"io"
 	"strings"
 	"text/template/parse"
+
+	"github.com/acsellers/multitemplate"
 )
 
 const (
@@ -54,6 +56,7 @@ func (pt *protoTree) parse() {
 		for currentWork.hasAction() && !currentWork.needsMoreText() {
 			precedingText, action := currentWork.pullToAction()
 			pt.list.Nodes = append(pt.list.Nodes, newTextNode(precedingText))
+			pt.locate(action)
 
 			switch pt.actionPurpose(action) {
 			case ident:
@@ -81,7 +84,11 @@ func (pt *protoTree) parse() {
 	}
 
 	if currentWork.hasAction() && currentWork.needsMoreText() {
-		pt.err = fmt.Errorf("unterminated delimeter")
+		pt.err = multitemplate.NewError(
+			pt.source,
+			strings.LastIndex(pt.source, pt.localLeft),
+			fmt.Errorf("unterminated delimeter"),
+		)
 	} else {
 		if len(currentWork.content) > 0 {
 			pt.list.Nodes = append(pt.list.Nodes, newTextNode(currentWork.content))
@@ -173,49 +180,49 @@ func (pt *protoTree) extract(s string) string {
 }
 
 func (pt *protoTree) insertFuncNode(a string) {
-	pt.list.Nodes = append(pt.list.Nodes, newActionNodeForCommands(pt.newFuncNode(a)))
+	pt.list.Nodes = append(pt.list.Nodes, pt.place(newActionNodeForCommands(pt.newFuncNode(a))))
 }
 
 func (pt *protoTree) insertIdentNode(a string) {
 	if pt.unescapedAction(a) {
 		un := newUnescapedIdentNode(pt.extract(a))
-		pt.list.Nodes = append(pt.list.Nodes, un)
+		pt.list.Nodes = append(pt.list.Nodes, pt.place(un))
 	} else {
 		ax := pt.extract(a)
 		if ax == "." {
 			ax = "mustacheItem"
 		}
 		an := newIdentNode(ax)
-		pt.list.Nodes = append(pt.list.Nodes, an)
+		pt.list.Nodes = append(pt.list.Nodes, pt.place(an))
 	}
 }
 
 func (pt *protoTree) insertTemplateNode(a string) {
 	tn := newTemplateNode(pt.extract(a))
-	pt.list.Nodes = append(pt.list.Nodes, tn)
+	pt.list.Nodes = append(pt.list.Nodes, pt.place(tn))
 }
 
 func (pt *protoTree) insertYieldNode(a string) {
 	yn := newYieldNode(pt.extract(a))
-	pt.list.Nodes = append(pt.list.Nodes, yn)
+	pt.list.Nodes = append(pt.list.Nodes, pt.place(yn))
 }
 
 func (pt *protoTree) startBlock(a string) {
-	tmpl, call, list := newBlockNode(pt.extract(a))
+	tmpl, call, list := pt.newBlockNode(pt.extract(a))
 	pt.childTrees = append(pt.childTrees, tmpl)
-	pt.list.Nodes = append(pt.list.Nodes, call)
+	pt.list.Nodes = append(pt.list.Nodes, pt.place(call))
 	pt.push(pt.list)
 	pt.list = list
 }
 func (pt *protoTree) startFuncBlock(a string) {
-	tmpl, call, list := newBlockNode(pt.extract(a))
+	tmpl, call, list := pt.newBlockNode(pt.extract(a))
 	call.Pipe = &parse.PipeNode{
 		NodeType: parse.NodePipe,
 		Cmds:     []*parse.CommandNode{pt.newFuncNode(a)},
 	}
 	call2 := &parse.WithNode{BranchNode: call.BranchNode}
 	pt.childTrees = append(pt.childTrees, tmpl)
-	pt.list.Nodes = append(pt.list.Nodes, call2)
+	pt.list.Nodes = append(pt.list.Nodes, pt.place(call2))
 	pt.push(pt.list)
 	pt.list = list
 }
@@ -226,6 +233,9 @@ func (pt *protoTree) endBlock(a string) {
 
 func (pt *protoTree) startElseBlock(a string) {
 	ifNode, list := newElseBlock(pt.extract(a))
+	// the else list is filled in later, so only move the condition
+	ifNode.Pos = parse.Pos(pt.pos)
+	ifNode.Pipe = pt.place(ifNode.Pipe).(*parse.PipeNode)
 	pt.list.Nodes = append(pt.list.Nodes, ifNode)
 	pt.push(pt.list)
 	pt.list = list
@@ -2,7 +2,10 @@ package mustache
 
 import (
 	ht "html/template"
+	"strings"
 	"text/template/parse"
+
+	"github.com/acsellers/multitemplate"
 )
 
 var mangleNum int
@@ -17,6 +20,24 @@ type protoTree struct {
 	localLeft  string
 	localRight string
 	funcs      ht.FuncMap
+	// pos is where the current action starts in the source, and cursor
+	// is where the search for the next action starts
+	pos    int
+	cursor int
+}
+
+// locate finds action in the source, searching on from the last action.
+func (pt *protoTree) locate(action string) {
+	if i := strings.Index(pt.source[pt.cursor:], action); i >= 0 {
+		pt.pos = pt.cursor + i
+		pt.cursor = pt.pos + len(action)
+	}
+}
+
+// place moves a node built for the current action to where the action
+// is in the source.
+func (pt *protoTree) place(n parse.Node) parse.Node {
+	return multitemplate.Relocate(n, pt.pos)
 }
 
 func (pt *protoTree) templates() map[string]*parse.Tree {
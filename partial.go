@@ -0,0 +1,146 @@
+package multitemplate
+
+import (
+	"fmt"
+	"html/template"
+	"reflect"
+	"strings"
+)
+
+// locals are named values merged over the data for a partial.
+type locals map[string]interface{}
+
+// spacer is a template rendered between the elements of a collection.
+type spacer string
+
+// emptyTemplate is rendered instead of a collection with no elements.
+type emptyTemplate string
+
+func newLocals(pairs ...interface{}) (locals, error) {
+	if len(pairs)%2 != 0 {
+		return nil, fmt.Errorf("locals needs a value for each name, got %d arguments", len(pairs))
+	}
+	l := locals{}
+	for i := 0; i < len(pairs); i += 2 {
+		name, ok := pairs[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("locals names must be strings, got %T", pairs[i])
+		}
+		l[name] = pairs[i+1]
+	}
+	return l, nil
+}
+
+// mergeLocals combines several sets of locals, later ones winning.
+func mergeLocals(ls []locals) locals {
+	merged := locals{}
+	for _, l := range ls {
+		for k, v := range l {
+			merged[k] = v
+		}
+	}
+	return merged
+}
+
+// merge returns dot with the locals merged over it. Maps with string keys
+// have their entries copied, and structs have their exported fields
+// copied, any other value is kept under the name Dot.
+func (l locals) merge(dot interface{}) interface{} {
+	if len(l) == 0 {
+		return dot
+	}
+
+	m := map[string]interface{}{}
+	v := reflect.ValueOf(dot)
+	for (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && !v.IsNil() {
+		v = v.Elem()
+	}
+	switch {
+	case v.Kind() == reflect.Map && v.Type().Key().Kind() == reflect.String:
+		iter := v.MapRange()
+		for iter.Next() {
+			m[iter.Key().String()] = iter.Value().Interface()
+		}
+	case v.Kind() == reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if f := v.Type().Field(i); f.PkgPath == "" {
+				m[f.Name] = v.Field(i).Interface()
+			}
+		}
+	case dot != nil:
+		m["Dot"] = dot
+	}
+	for k, val := range l {
+		m[k] = val
+	}
+	return m
+}
+
+// renderPartial renders a template with the locals merged over dot.
+func (c *Context) renderPartial(name string, dot interface{}, l locals) (RenderedBlock, error) {
+	return c.exec(name, l.merge(dot))
+}
+
+// renderCollection renders a template once for each element of a slice
+// or array, with the locals merged over the element. The spacer is
+// rendered between elements, and the empty template in place of a
+// collection without any elements, both with the locals merged over the
+// collection.
+func (c *Context) renderCollection(name string, collection interface{}, opts ...interface{}) (RenderedBlock, error) {
+	l := locals{}
+	var sp spacer
+	var empty emptyTemplate
+	for _, opt := range opts {
+		switch opt := opt.(type) {
+		case locals:
+			l = mergeLocals([]locals{l, opt})
+		case spacer:
+			sp = opt
+		case emptyTemplate:
+			empty = opt
+		default:
+			return RenderedBlock{}, fmt.Errorf("render_collection can't use %T as an option", opt)
+		}
+	}
+
+	v := reflect.ValueOf(collection)
+	for (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && !v.IsNil() {
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+	case reflect.Invalid, reflect.Ptr, reflect.Interface:
+		// a nil collection has no elements
+		v = reflect.ValueOf([]interface{}{})
+	default:
+		return RenderedBlock{}, fmt.Errorf("render_collection needs a slice or array, got %T", collection)
+	}
+
+	if v.Len() == 0 {
+		if empty == "" {
+			return RenderedBlock{}, nil
+		}
+		return c.renderPartial(string(empty), collection, l)
+	}
+
+	var content strings.Builder
+	var spacerContent RenderedBlock
+	if sp != "" {
+		var e error
+		spacerContent, e = c.renderPartial(string(sp), collection, l)
+		if e != nil {
+			return RenderedBlock{}, e
+		}
+	}
+	for i := 0; i < v.Len(); i++ {
+		if i > 0 {
+			content.WriteString(string(spacerContent.Content))
+		}
+		rb, e := c.renderPartial(name, v.Index(i).Interface(), l)
+		if e != nil {
+			return RenderedBlock{}, e
+		}
+		content.WriteString(string(rb.Content))
+	}
+	return RenderedBlock{Content: template.HTML(content.String()), Type: c.rendered()}, nil
+}
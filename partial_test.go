@@ -0,0 +1,96 @@
+package multitemplate
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	. "github.com/acsellers/assert"
+)
+
+type partialUser struct {
+	Name  string
+	Admin bool
+}
+
+func TestRenderPartial(tst *testing.T) {
+	Within(tst, func(test *Test) {
+		t := parseSet(test, map[string]string{
+			"row":    `<li class="{{ .Class }}">{{ .Name }}{{ if .Admin }}*{{ end }}</li>`,
+			"name":   `<b>{{ .Name }}</b>`,
+			"locals": `<ul>{{ render_partial "row" . (locals "Class" "first") }}</ul>`,
+			"dot":    `{{ render_partial "name" . }}`,
+			"merged": `{{ render_partial "row" . (locals "Class" "x" "Admin" false) }}`,
+			"odd":    `{{ render_partial "row" . (locals "Class") }}`,
+			"script": `<script>var x = {{ render_partial "name" . }};</script>`,
+		})
+		user := partialUser{Name: "<Ann>", Admin: true}
+
+		b := &bytes.Buffer{}
+		test.NoError(t.ExecuteTemplate(b, "locals", user))
+		test.AreEqual(`<ul><li class="first">&lt;Ann&gt;*</li></ul>`, b.String())
+
+		// without locals the partial gets dot itself
+		b.Reset()
+		test.NoError(t.ExecuteTemplate(b, "dot", &user))
+		test.AreEqual(`<b>&lt;Ann&gt;</b>`, b.String())
+
+		// locals are merged over maps too
+		b.Reset()
+		test.NoError(t.ExecuteTemplate(b, "merged", map[string]interface{}{"Name": "Bo", "Admin": true}))
+		test.AreEqual(`<li class="x">Bo</li>`, b.String())
+
+		test.IsError(t.ExecuteTemplate(&bytes.Buffer{}, "odd", user))
+		// partials render HTML, which can't be put in a script
+		test.IsError(t.ExecuteTemplate(&bytes.Buffer{}, "script", user))
+	})
+}
+
+func TestRenderCollection(tst *testing.T) {
+	Within(tst, func(test *Test) {
+		t := parseSet(test, map[string]string{
+			"row":     `<li class="{{ .Class }}">{{ .Name }}{{ if .Admin }}*{{ end }}</li>`,
+			"name":    `<b>{{ .Name }}</b>`,
+			"item":    `<i>{{ .Dot }}{{ .Suffix }}</i>`,
+			"spacer":  `, `,
+			"none":    `<p>No users</p>`,
+			"spaced":  `{{ render_collection "name" . (spacer_template "spacer") }}`,
+			"locals":  `{{ render_collection "row" . (locals "Class" "u") }}`,
+			"values":  `{{ render_collection "item" . (locals "Suffix" "!") }}`,
+			"empty":   `{{ render_collection "name" . (empty_template "none") }}`,
+			"missing": `<ul>{{ render_collection "name" . }}</ul>`,
+		})
+		users := []partialUser{{Name: "Ann"}, {Name: "Bo", Admin: true}}
+
+		for _, ct := range []struct {
+			Name     string
+			Data     interface{}
+			Expected string
+		}{
+			{"spaced", users, `<b>Ann</b>, <b>Bo</b>`},
+			{"locals", users, `<li class="u">Ann</li><li class="u">Bo*</li>`},
+			// values that aren't maps or structs are kept as Dot
+			{"values", []string{"a", "b"}, `<i>a!</i><i>b!</i>`},
+			{"empty", []partialUser{}, `<p>No users</p>`},
+			{"missing", nil, `<ul></ul>`},
+		} {
+			b := &bytes.Buffer{}
+			test.NoError(t.ExecuteTemplate(b, ct.Name, ct.Data))
+			test.AreEqual(ct.Expected, b.String())
+		}
+
+		test.IsError(t.ExecuteTemplate(&bytes.Buffer{}, "missing", 3))
+	})
+}
+
+func TestRenderPartialTypeCheck(tst *testing.T) {
+	Within(tst, func(test *Test) {
+		t := parseSet(test, map[string]string{
+			"user": `{{ .Nmae }}`,
+			"main": `{{ render_collection "user" . }}`,
+		})
+		test.IsError(t.TypeCheck("main", reflect.TypeOf([]partialUser{})))
+		test.IsNotNil(t.Dependencies()["main"])
+		test.AreEqual([]string{"user"}, t.Dependencies()["main"].Execs)
+	})
+}
@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"fmt"
 	"html/template"
+	"io"
+	"net/http"
 )
 
 // A specialized Writer struct I'm using to make blocks work.
@@ -18,11 +20,73 @@ type pouchWriter struct {
 	root      bytes.Buffer
 	buffers   []bytes.Buffer
 	rulesets  []Ruleset
+	kinds     []blockKind
 	discard   bool
 	next      RenderedBlock
 	check     bool
 	immediate bool
 	err       error
+	// limit is the most bytes that may be written to the root, or to one
+	// block, zero is no limit
+	limit   int
+	written int
+	// text output isn't escaped, so the sentinel comes through as it is
+	// and blocks can be output anywhere
+	text bool
+
+	// stream receives root output as soon as it is written, unless
+	// something earlier in the output is being held.
+	stream  io.Writer
+	held    []*heldBlock
+	holding *heldBlock
+	// closeAt is given the block opened by OpenUnchecked when it is
+	// closed at the next sentinel
+	closeAt func(RenderedBlock) error
+	// ends are called when their block is closed, like the end of the
+	// trace step of a block
+	ends []func()
+	// inline are the blocks being output where they are, not captured
+	inline []inlineBlock
+}
+
+// An inlineBlock is a block output where it is, opened when depth blocks
+// were being captured.
+type inlineBlock struct {
+	depth int
+	end   func()
+}
+
+// A blockKind is what happens to the content captured for a block when
+// it is closed.
+type blockKind int
+
+const (
+	// capturing blocks are saved under their name, if it isn't claimed
+	capturing blockKind = iota
+	// holding blocks are the fallback for a block held in a stream
+	holding
+	// layering blocks are default content, output with the content
+	// appended and prepended to the block around it
+	layering
+	// appending and prepending blocks are added to the named block
+	appending
+	prepending
+	// componentContent is the content of a component call, and
+	// slotContent the content of one of its slots
+	componentContent
+	slotContent
+	// caching blocks are stored in the cache
+	caching
+)
+
+// A heldBlock marks a place in streamed output that is waiting on a block
+// or yield that has not been rendered yet, along with all of the output
+// that came after it.
+type heldBlock struct {
+	name     string
+	rules    Ruleset
+	fallback RenderedBlock
+	after    bytes.Buffer
 }
 
 func (pw *pouchWriter) nesting() bool {
@@ -32,46 +96,51 @@ func (pw *pouchWriter) nesting() bool {
 func (pw *pouchWriter) Write(p []byte) (n int, err error) {
 	if pw.check {
 		pw.check = false
-		var remainder []byte
-		var rl Ruleset
-
-		switch {
-		case len(p) < 8:
-			return 0, fmt.Errorf("Sentinel not received")
-		case string(p[0:8]) == string(CSS):
-			remainder = p[8:]
-			rl = CSS
-		case len(p) < 12:
-			return 0, fmt.Errorf("Sentinel not received")
-		case string(p[0:12]) == string(JS):
-			remainder = p[12:]
-			rl = JS
-		case len(p) < 15:
-			return 0, fmt.Errorf("Sentinel not received")
-		case string(p[0:15]) == string(HTML):
-			remainder = p[15:]
-			rl = HTML
-		default:
+		rl, length, ok := pw.sniff(p)
+		if !ok {
 			return 0, fmt.Errorf("Sentinel not received")
 		}
-		pw.rulesets = append(pw.rulesets, rl)
-		if rl == pw.next.Type || pw.next.Type == User {
-			if pw.immediate {
-				if len(pw.buffers) > 0 {
-					return pw.buffers[len(pw.buffers)-1].Write([]byte(pw.next.Content))
+		remainder := p[length:]
+		next, immediate := pw.next, pw.immediate
+		pw.next, pw.immediate = RenderedBlock{}, false
+		if done := pw.closeAt; done != nil {
+			pw.closeAt = nil
+			pw.rulesets[len(pw.rulesets)-1] = rl
+			_, next = pw.Close()
+			immediate = true
+			if err := done(next); err != nil {
+				pw.err = err
+				return 0, err
+			}
+		}
+
+		if pw.holding != nil {
+			hb := pw.holding
+			pw.holding = nil
+			hb.rules = rl
+			pw.hold(hb)
+		} else {
+			if !immediate {
+				pw.rulesets = append(pw.rulesets, rl)
+			}
+			if compatible(next.Type, rl) {
+				if immediate {
+					if len(pw.buffers) > 0 {
+						pw.writeBlock(len(pw.buffers)-1, []byte(next.Content))
+					} else {
+						pw.writeRoot([]byte(next.Content))
+					}
 				} else {
-					pw.root.Write([]byte(pw.next.Content))
+					if len(pw.buffers) > 1 {
+						pw.writeBlock(len(pw.buffers)-2, []byte(next.Content))
+					} else {
+						pw.writeRoot([]byte(next.Content))
+					}
 				}
 			} else {
-				if len(pw.buffers) > 1 {
-					return pw.buffers[len(pw.buffers)-2].Write([]byte(pw.next.Content))
-				} else {
-					pw.root.Write([]byte(pw.next.Content))
-				}
+				pw.err = &ContextError{Content: next.Content, Rendered: next.Type, Output: rl}
+				return 0, pw.err
 			}
-		} else {
-			pw.err = fmt.Errorf("Mismatched block contexts for block content: %s", pw.next.Content)
-			return 0, pw.err
 		}
 
 		if len(remainder) != 0 {
@@ -82,19 +151,80 @@ func (pw *pouchWriter) Write(p []byte) (n int, err error) {
 	}
 
 	if len(pw.buffers) > 0 {
-		return pw.buffers[len(pw.buffers)-1].Write(p)
+		return pw.writeBlock(len(pw.buffers)-1, p)
 	}
 	if !pw.discard {
-		return pw.root.Write(p)
+		return pw.writeRoot(p)
 	}
 
 	return len(p), nil
 }
 
+// sniff finds the sentinel at the start of p, like sniffSentinel.
+func (pw *pouchWriter) sniff(p []byte) (Ruleset, int, bool) {
+	if pw.text {
+		return User, len(sentinel), bytes.HasPrefix(p, []byte(sentinel))
+	}
+	return sniffSentinel(p)
+}
+
+// fresh returns an empty pouchWriter with the same settings, for output
+// rendered separately.
+func (pw *pouchWriter) fresh() *pouchWriter {
+	return &pouchWriter{limit: pw.limit, text: pw.text}
+}
+
+// writeRoot writes to the top level of the output, which is either the
+// root buffer, the stream, or the output trailing the last held block.
+func (pw *pouchWriter) writeRoot(p []byte) (int, error) {
+	if pw.limit > 0 {
+		pw.written += len(p)
+		if pw.written > pw.limit {
+			return 0, pw.overLimit()
+		}
+	}
+	return pw.emit(p)
+}
+
+// emit writes to the top level of the output without counting it against
+// the limit, for output that was counted when it was held.
+func (pw *pouchWriter) emit(p []byte) (int, error) {
+	if len(pw.held) > 0 {
+		return pw.held[len(pw.held)-1].after.Write(p)
+	}
+	if pw.stream != nil {
+		n, err := pw.stream.Write(p)
+		if err != nil && pw.err == nil {
+			pw.err = err
+		}
+		return n, err
+	}
+	return pw.root.Write(p)
+}
+
+// writeBlock writes to the block at index i of the open blocks.
+func (pw *pouchWriter) writeBlock(i int, p []byte) (int, error) {
+	if pw.limit > 0 && pw.buffers[i].Len()+len(p) > pw.limit {
+		return 0, pw.overLimit()
+	}
+	return pw.buffers[i].Write(p)
+}
+
+// overLimit records and returns the error for output over the limit.
+func (pw *pouchWriter) overLimit() error {
+	if pw.err == nil {
+		pw.err = &SandboxError{Limit: "MaxOutput", Detail: fmt.Sprintf("more than %d bytes were written", pw.limit)}
+	}
+	return pw.err
+}
+
 func (pw *pouchWriter) Nop(rb RenderedBlock) {
 	pw.names = append(pw.names, "")
 	pw.buffers = append(pw.buffers, bytes.Buffer{})
+	pw.kinds = append(pw.kinds, capturing)
+	pw.ends = append(pw.ends, nil)
 	pw.check = true
+	pw.immediate = false
 	pw.next = rb
 }
 
@@ -113,21 +243,161 @@ func (pw *pouchWriter) Reset() {
 	pw.names = []string{}
 	pw.buffers = []bytes.Buffer{}
 	pw.rulesets = []Ruleset{}
+	pw.kinds = []blockKind{}
+	pw.ends = []func(){}
+	pw.inline = nil
 }
 
 func (pw *pouchWriter) Open(name string) {
+	pw.OpenAs(name, capturing)
+}
+
+// OpenHeld starts capturing a block whose content is only a fallback,
+// the captured content should be passed to Hold once it is closed.
+func (pw *pouchWriter) OpenHeld(name string) {
+	pw.OpenAs(name, holding)
+}
+
+// OpenAs starts capturing a block, kind says what should be done with
+// the captured content once it is closed.
+func (pw *pouchWriter) OpenAs(name string, kind blockKind) {
 	pw.names = append(pw.names, name)
 	pw.buffers = append(pw.buffers, bytes.Buffer{})
+	pw.kinds = append(pw.kinds, kind)
+	pw.ends = append(pw.ends, nil)
 	pw.check = true
+	pw.immediate = false
+	pw.next = RenderedBlock{}
+}
+
+// OpenUnchecked starts capturing a block where nothing is output, so
+// there is no sentinel to take its escaping context from. The block is
+// closed with CloseAt, which takes the context from its sentinel instead.
+func (pw *pouchWriter) OpenUnchecked(name string, kind blockKind) {
+	pw.names = append(pw.names, name)
+	pw.buffers = append(pw.buffers, bytes.Buffer{})
+	pw.rulesets = append(pw.rulesets, User)
+	pw.kinds = append(pw.kinds, kind)
+	pw.ends = append(pw.ends, nil)
+}
+
+// CloseAt closes the block opened by OpenUnchecked at the next sentinel,
+// outputting it there, and passes the closed block to done.
+func (pw *pouchWriter) CloseAt(done func(RenderedBlock) error) {
+	pw.check = true
+	pw.closeAt = done
+}
+
+// EndWith sets a function to call when the innermost block is closed.
+func (pw *pouchWriter) EndWith(end func()) {
+	pw.ends[len(pw.ends)-1] = end
+}
+
+// Inline starts a block that is output where it is instead of being
+// captured, end is called when it is closed by CloseInline.
+func (pw *pouchWriter) Inline(end func()) {
+	pw.inline = append(pw.inline, inlineBlock{depth: len(pw.names), end: end})
+}
+
+// CloseInline closes the innermost inline block, if no captured block
+// was opened since it started, and reports whether it did.
+func (pw *pouchWriter) CloseInline() bool {
+	if len(pw.inline) == 0 {
+		return false
+	}
+	ib := pw.inline[len(pw.inline)-1]
+	if ib.depth != len(pw.names) {
+		return false
+	}
+	pw.inline = pw.inline[:len(pw.inline)-1]
+	ib.end()
+	return true
+}
+
+// closing returns the kind of block the next Close will close, and the
+// name it was opened with.
+func (pw *pouchWriter) closing() (string, blockKind) {
+	if len(pw.kinds) == 0 {
+		return "", capturing
+	}
+	return pw.names[len(pw.names)-1], pw.kinds[len(pw.kinds)-1]
 }
 
 func (pw *pouchWriter) Close() (name string, rb RenderedBlock) {
 	if len(pw.names) > 0 {
 		name = pw.names[len(pw.names)-1]
 		content := pw.buffers[len(pw.buffers)-1].String()
-		rb = RenderedBlock{Content: template.HTML(content), Type: pw.rulesets[len(pw.rulesets)-1]}
+		var rl Ruleset
+		if len(pw.rulesets) > 0 {
+			rl = pw.rulesets[len(pw.rulesets)-1]
+			pw.rulesets = pw.rulesets[:len(pw.rulesets)-1]
+		}
+		rb = RenderedBlock{Content: template.HTML(content), Type: rl}
 		pw.names = pw.names[:len(pw.names)-1]
 		pw.buffers = pw.buffers[:len(pw.buffers)-1]
+		pw.kinds = pw.kinds[:len(pw.kinds)-1]
+		end := pw.ends[len(pw.ends)-1]
+		pw.ends = pw.ends[:len(pw.ends)-1]
+		if end != nil {
+			end()
+		}
 	}
 	return
 }
+
+// Stream makes root output go straight to w instead of being buffered
+// until the template is closed.
+func (pw *pouchWriter) Stream(w io.Writer) {
+	pw.stream = w
+}
+
+// Defer holds the output at the position of the next sentinel for the
+// named block, so the rest of the output is held back until Release.
+// The fallback is used if the block is still missing at that point.
+func (pw *pouchWriter) Defer(name string, fallback RenderedBlock) {
+	pw.check = true
+	pw.immediate = true
+	pw.holding = &heldBlock{name: name, fallback: fallback}
+}
+
+// Hold holds the output at the current position for the named block,
+// using fallback if the block is still missing when it is released. The
+// fallback must have been rendered at this position.
+func (pw *pouchWriter) Hold(name string, fallback RenderedBlock) {
+	pw.hold(&heldBlock{name: name, rules: fallback.Type, fallback: fallback})
+}
+
+func (pw *pouchWriter) hold(hb *heldBlock) {
+	if len(pw.held) == 0 {
+		pw.Flush()
+	}
+	pw.held = append(pw.held, hb)
+}
+
+// Release fills in each held block using resolve, then writes the held
+// blocks and everything after them to the stream.
+func (pw *pouchWriter) Release(resolve func(name string, fallback RenderedBlock) (RenderedBlock, error)) error {
+	held := pw.held
+	pw.held = nil
+	for _, hb := range held {
+		rb, err := resolve(hb.name, hb.fallback)
+		if err != nil {
+			return err
+		}
+		if !compatible(rb.Type, hb.rules) {
+			pw.err = &ContextError{Content: rb.Content, Rendered: rb.Type, Output: hb.rules}
+			return pw.err
+		}
+		pw.writeRoot([]byte(rb.Content))
+		pw.emit(hb.after.Bytes())
+	}
+	pw.Flush()
+	return pw.err
+}
+
+// Flush sends streamed output on to the client if the stream can flush.
+func (pw *pouchWriter) Flush() {
+	if f, ok := pw.stream.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,312 @@
+package multitemplate
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"sort"
+	"sync"
+	"text/template/parse"
+	"time"
+)
+
+// A Registry keeps a Template loaded from one or more file systems up to
+// date as the template files change. Each reload only parses the files
+// that were added or changed since the last one, along with the files
+// whose templates refer to templates in them, then swaps in the new
+// Template at once, so renders never see a half loaded set. If a reload
+// fails, the last Template that loaded cleanly is kept and the error is
+// available from Err until a later reload succeeds.
+type Registry struct {
+	// Filter decides which files are loaded, as with a Loader
+	Filter func(path string) bool
+	// Interval is how often Watch checks for changes, a second if zero
+	Interval time.Duration
+	// OnReload is called with the result of each reload that changed
+	// the templates or failed, if it is set
+	OnReload func(error)
+	// Strict makes each reload run Check, so a reload that leaves broken
+	// references fails like one with a template that doesn't parse
+	Strict bool
+
+	base  *Template
+	fss   []fs.FS
+	files map[fileKey]*registryFile
+
+	// mu serializes reloads, while tmpl and err are guarded by rw
+	mu   sync.Mutex
+	rw   sync.RWMutex
+	tmpl *Template
+	err  error
+	stop chan struct{}
+}
+
+type fileKey struct {
+	fs   int
+	path string
+}
+
+// registryFile is what a Registry remembers about a file between reloads.
+type registryFile struct {
+	mod   time.Time
+	size  int64
+	name  string
+	src   source
+	trees map[string]*parse.Tree
+	refs  map[string]bool
+	err   error
+}
+
+// NewRegistry returns a Registry for the templates in the file systems.
+// Every reload parses into a clone of base, so base should have any
+// functions the templates need added to it before the first Reload.
+func NewRegistry(base *Template, fsys ...fs.FS) *Registry {
+	return &Registry{
+		base:  base,
+		fss:   fsys,
+		files: map[fileKey]*registryFile{},
+	}
+}
+
+// Template returns the last Template that loaded cleanly, it is nil until
+// the first reload succeeds.
+func (r *Registry) Template() *Template {
+	r.rw.RLock()
+	defer r.rw.RUnlock()
+	return r.tmpl
+}
+
+// Err returns the error from the last reload, or nil if it succeeded.
+func (r *Registry) Err() error {
+	r.rw.RLock()
+	defer r.rw.RUnlock()
+	return r.err
+}
+
+// ExecuteContext executes the current Template with ctx.
+func (r *Registry) ExecuteContext(w io.Writer, ctx *Context) error {
+	t := r.Template()
+	if t == nil {
+		return r.notLoaded()
+	}
+	return t.ExecuteContext(w, ctx)
+}
+
+// ExecuteTemplate executes the named template from the current Template.
+func (r *Registry) ExecuteTemplate(w io.Writer, name string, data interface{}) error {
+	t := r.Template()
+	if t == nil {
+		return r.notLoaded()
+	}
+	return t.ExecuteTemplate(w, name, data)
+}
+
+func (r *Registry) notLoaded() error {
+	if err := r.Err(); err != nil {
+		return err
+	}
+	return errors.New("multitemplate: registry has not been loaded")
+}
+
+// Reload checks the file systems for changed templates, and swaps in a
+// new Template if there were any. It returns the same error as Err.
+func (r *Registry) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	found := map[fileKey]fs.FileInfo{}
+	for i, fsys := range r.fss {
+		err := walkTemplates(fsys, r.Filter, func(path string, d fs.DirEntry) error {
+			info, err := d.Info()
+			if err == nil {
+				found[fileKey{i, path}] = info
+			}
+			return err
+		})
+		if err != nil {
+			return r.finish(nil, err)
+		}
+	}
+
+	// the names defined by changed and removed files decide which of the
+	// other files depend on them
+	names := map[string]bool{}
+	changed := map[fileKey]bool{}
+	for key, f := range r.files {
+		if found[key] == nil {
+			f.defines(names)
+			delete(r.files, key)
+			changed[key] = true
+		}
+	}
+	for key, info := range found {
+		f := r.files[key]
+		if f != nil && f.mod.Equal(info.ModTime()) && f.size == info.Size() {
+			continue
+		}
+		if f != nil {
+			f.defines(names)
+		}
+		f = &registryFile{mod: info.ModTime(), size: info.Size()}
+		r.files[key] = f
+		changed[key] = true
+		r.parse(key, f)
+		f.defines(names)
+	}
+	if len(changed) == 0 && r.tmpl != nil {
+		return r.Err()
+	}
+	for dependents := true; dependents; {
+		dependents = false
+		for key, f := range r.files {
+			if !changed[key] && f.refers(names) {
+				changed[key] = true
+				r.parse(key, f)
+				f.defines(names)
+				dependents = true
+			}
+		}
+	}
+
+	return r.finish(r.assemble())
+}
+
+// parse reads and parses a file, recording the error in the file if it
+// fails so it isn't parsed again until it changes.
+func (r *Registry) parse(key fileKey, f *registryFile) {
+	f.trees, f.refs, f.err = nil, nil, nil
+	b, err := fs.ReadFile(r.fss[key.fs], key.path)
+	if err != nil {
+		f.err = err
+		return
+	}
+	name, parser := templateName(key.path)
+	f.name = name
+	f.trees, f.src, f.err = r.base.parseTrees(name, source{file: key.path, src: string(b), parser: parser})
+	f.refs = map[string]bool{}
+	for n, tree := range f.trees {
+		for _, ref := range dependencies(n, tree).Templates() {
+			f.refs[ref] = true
+		}
+	}
+}
+
+// assemble builds a new Template from the trees of every file, in the
+// order of the file systems and then the paths, so later files override
+// earlier ones the same way a Loader would.
+func (r *Registry) assemble() (*Template, error) {
+	keys := make([]fileKey, 0, len(r.files))
+	for key, f := range r.files {
+		if f.err != nil {
+			return nil, f.err
+		}
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].fs != keys[j].fs {
+			return keys[i].fs < keys[j].fs
+		}
+		return keys[i].path < keys[j].path
+	})
+
+	t, err := r.base.Clone()
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		f := r.files[key]
+		// executing a template escapes its trees in place, so each
+		// Template gets its own copies
+		trees := make(map[string]*parse.Tree, len(f.trees))
+		for n, tree := range f.trees {
+			trees[n] = tree.Copy()
+		}
+		t, err = t.addTrees(f.name, f.src, trees)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if r.Strict {
+		if err = t.Check(); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+func (r *Registry) finish(t *Template, err error) error {
+	r.rw.Lock()
+	if t != nil {
+		r.tmpl = t
+	}
+	r.err = err
+	r.rw.Unlock()
+	if r.OnReload != nil {
+		r.OnReload(err)
+	}
+	return err
+}
+
+// Watch reloads the templates every Interval until Close is called. It
+// loads the templates first if they haven't been loaded, and returns the
+// error from that.
+func (r *Registry) Watch() error {
+	var err error
+	if r.Template() == nil {
+		err = r.Reload()
+	}
+	interval := r.Interval
+	if interval == 0 {
+		interval = time.Second
+	}
+
+	r.mu.Lock()
+	if r.stop == nil {
+		r.stop = make(chan struct{})
+		go r.watch(interval, r.stop)
+	}
+	r.mu.Unlock()
+	return err
+}
+
+func (r *Registry) watch(interval time.Duration, stop chan struct{}) {
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+			r.Reload()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Close stops watching for changes.
+func (r *Registry) Close() error {
+	r.mu.Lock()
+	if r.stop != nil {
+		close(r.stop)
+		r.stop = nil
+	}
+	r.mu.Unlock()
+	return nil
+}
+
+func (f *registryFile) defines(names map[string]bool) {
+	if f.name != "" {
+		names[f.name] = true
+	}
+	for n := range f.trees {
+		names[n] = true
+	}
+}
+
+func (f *registryFile) refers(names map[string]bool) bool {
+	for n := range f.refs {
+		if names[n] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,165 @@
+package multitemplate
+
+import (
+	"bytes"
+	"errors"
+	"html/template"
+	"testing"
+	"testing/fstest"
+	"text/template/parse"
+	"time"
+
+	. "github.com/acsellers/assert"
+)
+
+// countingParser counts how many times each template is parsed.
+type countingParser struct {
+	defaultParser
+	count map[string]int
+}
+
+func (cp *countingParser) ParseTemplate(name, src string, funcs template.FuncMap) (map[string]*parse.Tree, error) {
+	cp.count[name]++
+	return cp.defaultParser.ParseTemplate(name, src, funcs)
+}
+
+func useCounting() (*countingParser, func()) {
+	cp := &countingParser{count: map[string]int{}}
+	Parsers["cnt"] = cp
+	return cp, func() { delete(Parsers, "cnt") }
+}
+
+func registryFS() fstest.MapFS {
+	return fstest.MapFS{
+		"layouts/main.html.cnt": {Data: []byte(`<html>{{ yield }}</html>`)},
+		"app/index.html.cnt":    {Data: []byte(`{{ exec "app/item.html" . }}`)},
+		"app/item.html.cnt":     {Data: []byte(`<p>{{ . }}</p>`)},
+		"app/other.html.cnt":    {Data: []byte(`<b>other</b>`)},
+	}
+}
+
+func update(fsys fstest.MapFS, name, src string) {
+	fsys[name] = &fstest.MapFile{Data: []byte(src), ModTime: time.Now()}
+}
+
+func renderRegistry(test *Test, r *Registry, expected string) {
+	c := NewContext("item")
+	c.Main = "app/index.html"
+	c.Layout = "layouts/main.html"
+	b := bytes.Buffer{}
+	test.NoError(r.ExecuteContext(&b, c))
+	test.AreEqual(expected, b.String())
+}
+
+func TestRegistryReload(t *testing.T) {
+	cp, done := useCounting()
+	defer done()
+
+	Within(t, func(test *Test) {
+		fsys := registryFS()
+		r := NewRegistry(New("registry"), fsys)
+		test.NoError(r.Reload())
+		renderRegistry(test, r, "<html><p>item</p></html>")
+		first := r.Template()
+
+		// nothing changed, so the Template is kept
+		test.NoError(r.Reload())
+		test.AreEqual(true, first == r.Template())
+		test.AreEqual(1, cp.count["app/item.html"])
+
+		// the changed file and the file that execs it are parsed again
+		update(fsys, "app/item.html.cnt", `<i>{{ . }}</i>`)
+		test.NoError(r.Reload())
+		renderRegistry(test, r, "<html><i>item</i></html>")
+		test.AreEqual(2, cp.count["app/item.html"])
+		test.AreEqual(2, cp.count["app/index.html"])
+		test.AreEqual(1, cp.count["app/other.html"])
+		test.AreEqual(1, cp.count["layouts/main.html"])
+
+		delete(fsys, "app/other.html.cnt")
+		test.NoError(r.Reload())
+		test.IsNil(r.Template().Tmpl.Lookup("app/other.html"))
+	})
+}
+
+func TestRegistryKeepsLastGood(t *testing.T) {
+	_, done := useCounting()
+	defer done()
+	Within(t, func(test *Test) {
+		fsys := registryFS()
+		r := NewRegistry(New("registry"), fsys)
+		test.NoError(r.Reload())
+		good := r.Template()
+
+		update(fsys, "app/item.html.tmpl", "<p>\n{{ if }}</p>")
+		e := r.Reload()
+		test.IsError(e)
+		test.AreEqual(e, r.Err())
+		test.AreEqual(true, good == r.Template())
+		var me *Error
+		test.AreEqual(true, errors.As(e, &me))
+		test.AreEqual("app/item.html.tmpl", me.File)
+		test.AreEqual(2, me.Line)
+
+		// the broken file isn't parsed again until it changes
+		test.AreEqual(e, r.Reload())
+
+		delete(fsys, "app/item.html.tmpl")
+		test.NoError(r.Reload())
+		test.NoError(r.Err())
+		test.AreEqual(false, good == r.Template())
+	})
+}
+
+func TestRegistryStrict(t *testing.T) {
+	_, done := useCounting()
+	defer done()
+	Within(t, func(test *Test) {
+		fsys := registryFS()
+		r := NewRegistry(New("registry"), fsys)
+		update(fsys, "app/dangling.html.cnt", `{{ exec "app/missing.html" }}`)
+		test.NoError(r.Reload())
+
+		r = NewRegistry(New("registry"), fsys)
+		r.Strict = true
+		e := r.Reload()
+		var ce *CheckError
+		test.AreEqual(true, errors.As(e, &ce))
+		test.IsNil(r.Template())
+
+		delete(fsys, "app/dangling.html.cnt")
+		test.NoError(r.Reload())
+		renderRegistry(test, r, "<html><p>item</p></html>")
+	})
+}
+
+func TestRegistryWatch(t *testing.T) {
+	_, done := useCounting()
+	defer done()
+	Within(t, func(test *Test) {
+		fsys := registryFS()
+		r := NewRegistry(New("registry"), fsys)
+		r.Interval = 5 * time.Millisecond
+		reloads := make(chan error, 10)
+		r.OnReload = func(e error) {
+			select {
+			case reloads <- e:
+			default:
+			}
+		}
+		test.NoError(r.Watch())
+		defer r.Close()
+		<-reloads
+
+		r.mu.Lock()
+		update(fsys, "app/item.html.cnt", `<i>{{ . }}</i>`)
+		r.mu.Unlock()
+		select {
+		case e := <-reloads:
+			test.NoError(e)
+		case <-time.After(time.Second):
+			t.Fatal("templates were not reloaded")
+		}
+		renderRegistry(test, r, "<html><i>item</i></html>")
+	})
+}
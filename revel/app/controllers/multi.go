@@ -11,10 +11,10 @@ import (
 	"fmt"
 	"html/template"
 	"io"
+	"io/fs"
 	"io/ioutil"
 	"net/http"
 	"os"
-	"path/filepath"
 	"runtime"
 	"strconv"
 	"strings"
@@ -29,7 +29,7 @@ var (
 	// per content type.
 	DefaultLayout = make(map[RequestFormat]string)
 	// Template is the template loader used by multitemplate. It will be replaced each
-	// time the templates a refreshed if you are using auto-refresh.
+	// time the templates are reloaded without errors if you are using auto-refresh.
 	Template *mt.Template
 	// In DevMode, multitemplate will automatically
 	// refresh templates using revel's Watcher struct,
@@ -44,6 +44,7 @@ var (
 	CurrentError error
 	extraPaths   []string
 	refresh      *templateRefresher
+	registry     *mt.Registry
 	watch        *revel.Watcher
 )
 
@@ -91,44 +92,30 @@ MoreLoop:
 	CurrentError = RefreshTemplates()
 }
 
-// RefreshTemplates is automatically called by the auto-refresh system
-// or when you call RefreshPaths.
+// RefreshTemplates is called when you call RefreshPaths, it loads the
+// templates from all of the template paths into a new Registry.
 func RefreshTemplates() error {
 	revel.INFO.Println("Start multitemplate refresh")
-	Template = mt.New("revel_root")
-	Template.Funcs(revel.TemplateFuncs)
-
-	var err error
-	for _, rp := range revel.TemplatePaths {
-		Template.Base = rp
-		filepath.Walk(rp, func(path string, i os.FileInfo, e error) error {
-			if !i.IsDir() {
-				_, err = Template.ParseFiles(path)
-				if err != nil {
-					revel.ERROR.Printf("Parse Error in %s: %v", path, err)
-					CurrentError = err
-					return err
-				}
-			}
-			return nil
-		})
-	}
-	for _, ep := range extraPaths {
-		Template.Base = ep
-		filepath.Walk(ep, func(path string, i os.FileInfo, e error) error {
-			if !i.IsDir() {
-				_, err = Template.ParseFiles(path)
-				if err != nil {
-					revel.ERROR.Printf("Parse Error in %s: %v", path, err)
-					CurrentError = err
-					return err
-				}
-			}
-			return nil
-		})
+	base := mt.New("revel_root")
+	base.Funcs(revel.TemplateFuncs)
+
+	paths := append(append([]string{}, revel.TemplatePaths...), extraPaths...)
+	dirs := make([]fs.FS, len(paths))
+	for i, p := range paths {
+		dirs[i] = os.DirFS(p)
 	}
-	if CurrentError != nil {
-		return CurrentError
+	registry = mt.NewRegistry(base, dirs...)
+	return reload()
+}
+
+// reload reloads the changed templates in the registry, if the reload
+// fails the last templates that loaded are kept.
+func reload() error {
+	err := registry.Reload()
+	Template = registry.Template()
+	if err != nil {
+		revel.ERROR.Printf("Parse Error: %v", err)
+		return err
 	}
 	revel.INFO.Println("Multitemplate refresh completed successfully")
 	return nil
@@ -138,7 +125,7 @@ type templateRefresher struct{}
 
 func (tr *templateRefresher) Refresh() *revel.Error {
 	revel.INFO.Println("multitemplate: refreshing templates")
-	CurrentError = RefreshTemplates()
+	CurrentError = reload()
 	return nil
 }
 
@@ -230,6 +217,7 @@ func (c *Controller) Render(extraRenderArgs ...interface{}) revel.Result {
 	}
 
 	ctx.Main = c.Name + "/" + c.MethodType.Name + "." + c.Request.Format
+	c.setCSRFToken(ctx)
 
 	if CurrentError != nil {
 		return c.RenderError(CurrentError)
@@ -255,6 +243,7 @@ func (c *Controller) RenderTemplate(templateName string) revel.Result {
 	}
 
 	ctx.Main = templateName
+	c.setCSRFToken(ctx)
 
 	if CurrentError != nil {
 		return c.RenderError(CurrentError)
@@ -263,6 +252,40 @@ func (c *Controller) RenderTemplate(templateName string) revel.Result {
 	return &templateResult{ctx}
 }
 
+// CSRFSession is the session key the secret for CSRF tokens is kept in.
+var CSRFSession = "csrf_secret"
+
+// setCSRFToken adds a token for form_tag and csrf_meta_tags to the
+// Context when multitemplate.csrf is set in app.conf, a new secret is put
+// in the session if it doesn't have one.
+func (c *Controller) setCSRFToken(ctx *mt.Context) {
+	if !revel.Config.BoolDefault("multitemplate.csrf", false) {
+		return
+	}
+	token, e := helpers.MaskCSRFToken(c.Session[CSRFSession])
+	if e != nil {
+		secret, e := helpers.NewCSRFSecret()
+		if e != nil {
+			revel.ERROR.Println("multitemplate: could not create a CSRF secret:", e)
+			return
+		}
+		c.Session[CSRFSession] = secret
+		token, _ = helpers.MaskCSRFToken(secret)
+	}
+	ctx.CSRFToken = token
+}
+
+// ValidCSRF reports whether the request has a CSRF token from a form or
+// page rendered for this session, in the authenticity_token param or the
+// X-CSRF-Token header.
+func (c *Controller) ValidCSRF() bool {
+	token := c.Request.Header.Get(helpers.CSRFHeader)
+	if token == "" {
+		token = c.Params.Get(helpers.CSRFFieldName)
+	}
+	return helpers.ValidCSRFToken(c.Session[CSRFSession], token)
+}
+
 type templateResult struct {
 	ctx *mt.Context
 }
@@ -291,7 +314,7 @@ func (mtr *templateResult) Apply(req *revel.Request, resp *revel.Response) {
 	if chunked && !revel.DevMode {
 		resp.WriteHeader(http.StatusOK, "text/html")
 
-		Template.ExecuteContext(resp.Out, mtr.ctx)
+		Template.ExecuteContextWith(req.Context(), resp.Out, mtr.ctx)
 		return
 	}
 
@@ -307,7 +330,7 @@ func (mtr *templateResult) Apply(req *revel.Request, resp *revel.Response) {
 	if Template.Lookup(mtr.ctx.Main) == nil {
 		mtr.ctx.Main = strings.ToLower(mtr.ctx.Main)
 	}
-	e := Template.ExecuteContext(&b, mtr.ctx)
+	e := Template.ExecuteContextWith(req.Context(), &b, mtr.ctx)
 	if e != nil {
 		er := &revel.ErrorResult{mtr.ctx.Dot.(map[string]interface{}), e}
 		er.Apply(req, resp)
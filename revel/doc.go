@@ -7,6 +7,8 @@ app.conf
   // multitemplate must be added to your module list in your app.conf
   module.template=github.com/acsellers/multitemplate/revel
   module.jobs=github.com/revel/revel/modules/jobs
+  // add a CSRF token to forms from form_tag, checked with ValidCSRF
+  multitemplate.csrf=true
 
 app/controllers/init.go
 
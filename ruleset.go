@@ -0,0 +1,163 @@
+package multitemplate
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"sort"
+	"strings"
+)
+
+// A Ruleset is the html/template escaping context that a block was
+// rendered in, a block can only be output in the same context, or in a
+// context its content is also safe for.
+type Ruleset string
+
+const (
+	// User blocks are trusted to be safe wherever they are output
+	User Ruleset = ""
+	// HTML is text between tags
+	HTML Ruleset = "html"
+	// RCDATA is the text of a textarea or title element
+	RCDATA Ruleset = "rcdata"
+	// Attr is a quoted attribute value
+	Attr Ruleset = "attr"
+	// UnquotedAttr is an attribute value without quotes
+	UnquotedAttr Ruleset = "unquoted attr"
+	// URL is any part of a URL in an attribute like href or src
+	URL Ruleset = "url"
+	// Srcset is the value of a srcset attribute
+	Srcset Ruleset = "srcset"
+	// CSS is a value in a style element or attribute
+	CSS Ruleset = "css"
+	// CSSStr is a quoted string in CSS
+	CSSStr Ruleset = "css string"
+	// JS is a value in a script element
+	JS Ruleset = "js"
+	// JSAttr is a value in an event handler attribute
+	JSAttr Ruleset = "js attr"
+	// JSStr is a quoted string in JavaScript
+	JSStr Ruleset = "js string"
+	// JSTemplate is a template literal in JavaScript
+	JSTemplate Ruleset = "js template"
+	// JSRegexp is a regular expression literal in JavaScript
+	JSRegexp Ruleset = "js regexp"
+)
+
+// sentinel is returned by the functions that output blocks, the pouch
+// writer works out the escaping context of the function from how
+// html/template escaped it. It's typed as HTML, so it comes through
+// differently in text, RCDATA and attributes, which escape strings the
+// same way.
+const sentinel template.HTML = "$ =`\"'.<b>"
+
+// rulesetContexts has an example of each context, with the text around
+// the place a block would be output.
+var rulesetContexts = []struct {
+	rules         Ruleset
+	before, after string
+}{
+	{HTML, `<p>`, `</p>`},
+	{RCDATA, `<textarea>`, `</textarea>`},
+	{Attr, `<p title="`, `">`},
+	{UnquotedAttr, `<p title=`, `>`},
+	{URL, `<a href="`, `">`},
+	{URL, `<a href="/?q=`, `">`},
+	{URL, `<a href=`, `>`},
+	{Srcset, `<img srcset="`, `">`},
+	{CSS, `<style>`, `</style>`},
+	{CSSStr, `<style>p { content: "`, `" }</style>`},
+	{JS, `<script>var x = `, `;</script>`},
+	{JSAttr, `<p onclick="f(`, `)">`},
+	{JSStr, `<script>var x = "`, `";</script>`},
+	{JSTemplate, "<script>var x = `", "`;</script>"},
+	{JSRegexp, `<script>var x = /`, `/;</script>`},
+}
+
+// escapedSentinel is the sentinel as it is escaped in a context.
+type escapedSentinel struct {
+	escaped string
+	rules   Ruleset
+}
+
+// sentinels are sorted longest first, as some are prefixes of others.
+var sentinels []escapedSentinel
+
+// init works out how the sentinel is escaped in each context, so it
+// doesn't depend on the exact escaping of this version of html/template.
+func init() {
+	funcs := template.FuncMap{"sentinel": func() template.HTML { return sentinel }}
+	seen := map[string]bool{}
+	for _, rc := range rulesetContexts {
+		tmpl := template.Must(template.New("sentinel").Funcs(funcs).Parse(rc.before + "{{ sentinel }}" + rc.after))
+		b := bytes.Buffer{}
+		if err := tmpl.Execute(&b, nil); err != nil {
+			panic(err)
+		}
+		escaped := strings.TrimSuffix(strings.TrimPrefix(b.String(), rc.before), rc.after)
+		if !seen[escaped] {
+			seen[escaped] = true
+			sentinels = append(sentinels, escapedSentinel{escaped, rc.rules})
+		}
+	}
+	sort.SliceStable(sentinels, func(i, j int) bool {
+		return len(sentinels[i].escaped) > len(sentinels[j].escaped)
+	})
+}
+
+// sniffSentinel returns the context of the sentinel at the start of p,
+// and how long the sentinel is.
+func sniffSentinel(p []byte) (Ruleset, int, bool) {
+	for _, s := range sentinels {
+		if string(p) == s.escaped {
+			return s.rules, len(p), true
+		}
+	}
+	for _, s := range sentinels {
+		if bytes.HasPrefix(p, []byte(s.escaped)) {
+			return s.rules, len(s.escaped), true
+		}
+	}
+	return User, 0, false
+}
+
+// safeIn lists the contexts whose content is also safe in another
+// context, apart from the context itself. Escaped text from RCDATA and
+// attributes has no markup or unescaped quotes, and template literals
+// escape everything strings do. HTML is allowed in RCDATA, as the title
+// of a page is usually a block rendered as text, it can't end the
+// element without a closing tag of its own.
+var safeIn = map[Ruleset][]Ruleset{
+	HTML:   {RCDATA, Attr, UnquotedAttr},
+	RCDATA: {HTML, Attr, UnquotedAttr},
+	Attr:   {RCDATA, UnquotedAttr},
+	JSStr:  {JSTemplate},
+}
+
+// compatible reports whether content rendered in the content context
+// can be output in the output context.
+func compatible(content, output Ruleset) bool {
+	if content == User || content == output {
+		return true
+	}
+	for _, r := range safeIn[output] {
+		if r == content {
+			return true
+		}
+	}
+	return false
+}
+
+// A ContextError is returned when a block is output in an escaping
+// context that its content isn't safe for.
+type ContextError struct {
+	Content template.HTML
+	// Rendered is the context the content was rendered in
+	Rendered Ruleset
+	// Output is the context it was being output in
+	Output Ruleset
+}
+
+func (ce *ContextError) Error() string {
+	return fmt.Sprintf("Mismatched block contexts for block content, rendered in %s context but output in %s context: %s", ce.Rendered, ce.Output, ce.Content)
+}
@@ -0,0 +1,124 @@
+package multitemplate
+
+import (
+	"fmt"
+	"html/template"
+	"text/template/parse"
+	"time"
+)
+
+// A Sandbox limits what the templates of a Template set can do, for
+// templates written by the users of a site instead of its developers.
+// Limits that are zero aren't enforced.
+type Sandbox struct {
+	// Funcs are the functions templates may call, besides the builtin
+	// functions of text/template like eq and printf. Templates calling
+	// any other function fail to parse, or to execute if they were parsed
+	// before the Sandbox was set. Functions like yield, block and
+	// end_block must be listed for templates to use them.
+	Funcs []string
+	// MaxDepth is how deeply templates may be nested by exec, yield,
+	// block, partials, components and extend
+	MaxDepth int
+	// MaxOutput is the most bytes a render may write, or capture for a
+	// block
+	MaxOutput int
+	// MaxSteps is how many templates, yields, blocks, extended templates
+	// and range iterations a render may run
+	MaxSteps int
+	// Timeout is how long a render may take
+	Timeout time.Duration
+}
+
+// A SandboxError is returned when a template breaks one of the limits of
+// its Sandbox.
+type SandboxError struct {
+	// Limit is the field of the Sandbox that was broken, like MaxDepth
+	Limit string
+	// Detail is what broke it
+	Detail string
+}
+
+func (e *SandboxError) Error() string {
+	return fmt.Sprintf("Sandbox %s: %s", e.Limit, e.Detail)
+}
+
+// allowed reports whether templates in the sandbox may call a function,
+// checkpoint is always allowed since it is added to range bodies.
+func (s *Sandbox) allowed(name string) bool {
+	if builtinFuncs[name] || name == "checkpoint" {
+		return true
+	}
+	for _, f := range s.Funcs {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
+
+// check returns an error for the first call to a function that isn't
+// allowed in the trees parsed from src.
+func (s *Sandbox) check(src string, trees map[string]*parse.Tree) error {
+	if s == nil {
+		return nil
+	}
+	for _, tree := range trees {
+		var denied *parse.IdentifierNode
+		eachIdentifier(tree.Root, func(id *parse.IdentifierNode) {
+			if denied == nil && !s.allowed(id.Ident) {
+				denied = id
+			}
+		})
+		if denied != nil {
+			return NewError(src, int(denied.Pos), &SandboxError{
+				Limit:  "Funcs",
+				Detail: fmt.Sprintf("%s is not allowed", denied.Ident),
+			})
+		}
+	}
+	return nil
+}
+
+// deny returns functions that fail in place of each function in funcs
+// that isn't allowed, for templates parsed before the Sandbox was set.
+func (s *Sandbox) deny(funcs template.FuncMap) template.FuncMap {
+	denied := template.FuncMap{}
+	for name := range funcs {
+		if !s.allowed(name) {
+			e := &SandboxError{Limit: "Funcs", Detail: fmt.Sprintf("%s is not allowed", name)}
+			denied[name] = func(...interface{}) (string, error) {
+				return "", e
+			}
+		}
+	}
+	return denied
+}
+
+// sandbox returns the Sandbox of the template set being rendered.
+func (c *Context) sandbox() *Sandbox {
+	if c.tmpl == nil {
+		return nil
+	}
+	return c.tmpl.Sandbox
+}
+
+// step counts a step of the render, returning an error if the render has
+// been cancelled or has run out of the steps or time its Sandbox gives it.
+func (c *Context) step() error {
+	if e := c.cancelled(); e != nil {
+		return e
+	}
+	s := c.sandbox()
+	if s == nil {
+		return nil
+	}
+	c.steps++
+	if s.MaxSteps > 0 && c.steps > s.MaxSteps {
+		return &SandboxError{Limit: "MaxSteps", Detail: fmt.Sprintf("the render took more than %d steps", s.MaxSteps)}
+	}
+	if s.Timeout > 0 && time.Since(c.started) > s.Timeout {
+		return &SandboxError{Limit: "Timeout", Detail: fmt.Sprintf("the render took longer than %v", s.Timeout)}
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package multitemplate
+
+import (
+	"bytes"
+	"errors"
+	"html/template"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/acsellers/assert"
+)
+
+// sandboxLimit returns the limit broken by e, if it is a SandboxError.
+func sandboxLimit(e error) string {
+	var se *SandboxError
+	if errors.As(e, &se) {
+		return se.Limit
+	}
+	return ""
+}
+
+func TestSandboxFuncs(t *testing.T) {
+	Within(t, func(test *Test) {
+		tmpl := New("sandbox")
+		tmpl.Sandbox = &Sandbox{Funcs: []string{"yield"}}
+		_, e := tmpl.Parse("page", `<p>{{ exec "other" . }}</p>`, "tmpl")
+		test.AreEqual("Funcs", sandboxLimit(e))
+		var te *Error
+		test.AreEqual(true, errors.As(e, &te))
+		test.AreEqual(1, te.Line)
+		test.AreEqual(7, te.Column)
+
+		tmpl, e = tmpl.Parse("page", `<p>{{ if eq . 1 }}{{ printf "%d" . }}{{ end }}</p>`, "tmpl")
+		test.NoError(e)
+		b := bytes.Buffer{}
+		test.NoError(tmpl.ExecuteTemplate(&b, "page", 1))
+		test.AreEqual(`<p>1</p>`, b.String())
+
+		// templates parsed before the sandbox was set fail when they run
+		tmpl, e = New("sandbox").Parse("page", `<p>{{ exec "other" . }}</p>`, "tmpl")
+		test.NoError(e)
+		tmpl, e = tmpl.Parse("other", `other`, "tmpl")
+		test.NoError(e)
+		tmpl.Sandbox = &Sandbox{}
+		b.Reset()
+		e = tmpl.ExecuteTemplate(&b, "page", nil)
+		test.AreEqual("Funcs", sandboxLimit(e))
+		test.AreEqual(true, strings.Contains(e.Error(), "exec is not allowed"))
+	})
+}
+
+func TestSandboxLimits(t *testing.T) {
+	Within(t, func(test *Test) {
+		tmpl := New("sandbox").Funcs(template.FuncMap{
+			"nap": func() string {
+				time.Sleep(5 * time.Millisecond)
+				return ""
+			},
+		})
+		tmpl.Sandbox = &Sandbox{Funcs: []string{"exec", "define_block", "end_block", "nap"}}
+		for name, src := range map[string]string{
+			"recurse": `{{ if . }}<p>{{ exec "recurse" (slice . 1) }}</p>{{ end }}`,
+			"repeat":  `{{ range . }}0123456789{{ end }}`,
+			"block":   `{{ define_block "big" }}{{ range . }}0123456789{{ end }}{{ end_block }}`,
+			"slow":    `{{ range . }}{{ nap }}{{ end }}`,
+		} {
+			var e error
+			tmpl, e = tmpl.Parse(name, src, "tmpl")
+			test.NoError(e)
+		}
+
+		limitTests := []struct {
+			Sandbox Sandbox
+			Name    string
+			Dot     interface{}
+			Limit   string
+		}{
+			{Sandbox{MaxDepth: 5}, "recurse", make([]int, 3), ""},
+			{Sandbox{MaxDepth: 5}, "recurse", make([]int, 10), "MaxDepth"},
+			{Sandbox{MaxOutput: 100}, "repeat", make([]int, 10), ""},
+			{Sandbox{MaxOutput: 100}, "repeat", make([]int, 11), "MaxOutput"},
+			{Sandbox{MaxOutput: 100}, "block", make([]int, 11), "MaxOutput"},
+			{Sandbox{MaxSteps: 20}, "repeat", make([]int, 20), ""},
+			{Sandbox{MaxSteps: 20}, "repeat", make([]int, 1000), "MaxSteps"},
+			{Sandbox{Timeout: 20 * time.Millisecond}, "slow", make([]int, 1), ""},
+			{Sandbox{Timeout: 20 * time.Millisecond}, "slow", make([]int, 20), "Timeout"},
+		}
+		for _, lt := range limitTests {
+			sb := lt.Sandbox
+			sb.Funcs = tmpl.Sandbox.Funcs
+			clone, e := tmpl.Clone()
+			test.NoError(e)
+			clone.Sandbox = &sb
+			b := bytes.Buffer{}
+			e = clone.ExecuteTemplate(&b, lt.Name, lt.Dot)
+			if lt.Limit == "" {
+				test.NoError(e)
+			} else {
+				test.AreEqual(lt.Limit, sandboxLimit(e))
+			}
+		}
+	})
+}
+
+func TestSandboxStream(t *testing.T) {
+	Within(t, func(test *Test) {
+		tmpl := New("stream")
+		tmpl.Sandbox = &Sandbox{Funcs: []string{"yield", "define_block", "end_block"}}
+		for name, src := range map[string]string{
+			"layout": `<head>{{ yield "title" }}</head><body>{{ yield }}</body>` + strings.Repeat("-", 40),
+			"main":   `{{ define_block "title" }}<title>T</title>{{ end_block }}<h1>M</h1>`,
+		} {
+			var e error
+			tmpl, e = tmpl.Parse(name, src, "tmpl")
+			test.NoError(e)
+		}
+
+		// the output held back for the title is only counted once
+		expected := "<head><title>T</title></head><body><h1>M</h1></body>" + strings.Repeat("-", 40)
+		for _, limit := range []int{len(expected), len(expected) - 1} {
+			tmpl.Sandbox.MaxOutput = limit
+			c := NewContext(nil)
+			c.Main = "main"
+			c.Layout = "layout"
+			c.Stream = true
+			b := bytes.Buffer{}
+			e := tmpl.ExecuteContext(&b, c)
+			if limit == len(expected) {
+				test.NoError(e)
+				test.AreEqual(expected, b.String())
+			} else {
+				test.AreEqual("MaxOutput", sandboxLimit(e))
+			}
+		}
+	})
+}
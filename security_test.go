@@ -85,3 +85,106 @@ func TestSentinelCSS(t *testing.T) {
 		test.IsError(t.ExecuteContext(&b, c))
 	})
 }
+
+func TestSentinelContexts(t *testing.T) {
+	Within(t, func(test *Test) {
+		contexts := []struct {
+			Source string
+			Rules  Ruleset
+		}{
+			{`<p>{{ yield "break" }}</p>`, HTML},
+			{`<textarea>{{ yield "break" }}</textarea>`, RCDATA},
+			{`<p title="{{ yield "break" }}">`, Attr},
+			{`<p title='{{ yield "break" }}'>`, Attr},
+			{`<p title={{ yield "break" }}>`, UnquotedAttr},
+			{`<a href="{{ yield "break" }}">`, URL},
+			{`<a href="/users?q={{ yield "break" }}">`, URL},
+			{`<img srcset="{{ yield "break" }}">`, Srcset},
+			{`<style>p { content: "{{ yield "break" }}" }</style>`, CSSStr},
+			{`<script>var x = "{{ yield "break" }}";</script>`, JSStr},
+			{`<script>var x = '{{ yield "break" }}';</script>`, JSStr},
+			{"<script>var x = `{{ yield \"break\" }}`;</script>", JSTemplate},
+			{`<script>var x = /{{ yield "break" }}/;</script>`, JSRegexp},
+			{`<p onclick="f({{ yield "break" }})">`, JSAttr},
+		}
+		for _, ctx := range contexts {
+			t, e := New("test_templates").Parse("default", ctx.Source, "default")
+			test.NoError(e)
+
+			c := NewContext(nil)
+			c.Main = "default"
+			c.Blocks["break"] = RenderedBlock{template.HTML(`YES`), ctx.Rules}
+			b := bytes.Buffer{}
+			test.NoError(t.ExecuteContext(&b, c))
+
+			c = NewContext(nil)
+			c.Main = "default"
+			c.Blocks["break"] = RenderedBlock{template.HTML(`NO`), JS}
+			if ctx.Rules != JS {
+				e = t.ExecuteContext(&b, c)
+				test.IsError(e)
+				ce, ok := e.(*ContextError)
+				test.AreEqual(true, ok)
+				if ok {
+					test.AreEqual(JS, ce.Rendered)
+					test.AreEqual(ctx.Rules, ce.Output)
+				}
+			}
+		}
+	})
+}
+
+func TestCompatibleContexts(t *testing.T) {
+	Within(t, func(test *Test) {
+		t, e := New("test_templates").Parse(
+			"page",
+			`{{ define_block "title" }}Users{{ end_block }}`+
+				`<p title="{{ define_block "tip" }}{{ .Tip }}{{ end_block }}">`,
+			"default",
+		)
+		test.NoError(e)
+		_, e = t.Parse("layout", `<title>{{ yield "title" }}</title><textarea>{{ yield "tip" }}</textarea><b title='{{ yield "tip" }}'>`, "default")
+		test.NoError(e)
+
+		c := NewContext(map[string]string{"Tip": `"quoted"`})
+		c.Main = "page"
+		c.Layout = "layout"
+		b := bytes.Buffer{}
+		test.NoError(t.ExecuteContext(&b, c))
+		test.AreEqual(`<title>Users</title><textarea>&#34;quoted&#34;</textarea><b title='&#34;quoted&#34;'>`, b.String())
+
+		// text can have quotes, so it isn't safe in an attribute
+		_, e = t.Parse("attr_layout", `<b title="{{ yield "title" }}">`, "default")
+		test.NoError(e)
+		c = NewContext(map[string]string{"Tip": "tip"})
+		c.Main = "page"
+		c.Layout = "attr_layout"
+		b.Reset()
+		e = t.ExecuteContext(&b, c)
+		test.IsError(e)
+		ce, ok := e.(*ContextError)
+		test.AreEqual(true, ok)
+		if ok {
+			test.AreEqual(HTML, ce.Rendered)
+			test.AreEqual(Attr, ce.Output)
+		}
+
+		// a block captured in a JS string is only safe in a JS string
+		_, e = t.Parse("script", `<script>var x = "{{ define_block "name" }}{{ .Name }}{{ end_block }}";</script>`, "default")
+		test.NoError(e)
+		_, e = t.Parse("script_layout", `<script>var y = '{{ yield "name" }}';</script><p>{{ yield "name" }}</p>`, "default")
+		test.NoError(e)
+		c = NewContext(map[string]string{"Name": `"Ann"`})
+		c.Main = "script"
+		c.Layout = "script_layout"
+		b.Reset()
+		e = t.ExecuteContext(&b, c)
+		test.IsError(e)
+		ce, ok = e.(*ContextError)
+		test.AreEqual(true, ok)
+		if ok {
+			test.AreEqual(JSStr, ce.Rendered)
+			test.AreEqual(HTML, ce.Output)
+		}
+	})
+}
@@ -1,7 +1,10 @@
 package multitemplate
 
 import (
+	"errors"
 	"html/template"
+	"regexp"
+	"strconv"
 	textTmpl "text/template"
 	"text/template/parse"
 )
@@ -23,7 +26,7 @@ func (ms *defaultParser) ParseTemplate(name, src string, funcs template.FuncMap)
 		t, e = textTmpl.New(name).Funcs(tf).Parse(src)
 	}
 	if e != nil {
-		return nil, e
+		return nil, stdlibError(src, e)
 	}
 
 	ret := make(map[string]*parse.Tree)
@@ -40,3 +43,16 @@ func (ms *defaultParser) String() string {
 func init() {
 	Parsers["tmpl"] = &defaultParser{}
 }
+
+var stdlibLocation = regexp.MustCompile(`^template: [^:]*:(\d+): (.*)$`)
+
+// stdlibError pulls the line out of a text/template parse error, those
+// don't come with a column.
+func stdlibError(src string, err error) *Error {
+	m := stdlibLocation.FindStringSubmatch(err.Error())
+	if m == nil {
+		return &Error{Err: err}
+	}
+	line, _ := strconv.Atoi(m[1])
+	return &Error{Line: line, Excerpt: excerpt(src, line), Err: errors.New(m[2])}
+}
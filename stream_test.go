@@ -0,0 +1,78 @@
+package multitemplate
+
+import (
+	"bytes"
+	"testing"
+
+	. "github.com/acsellers/assert"
+)
+
+// flushRecorder records what had been written each time it was flushed.
+type flushRecorder struct {
+	bytes.Buffer
+	flushes []string
+}
+
+func (fr *flushRecorder) Flush() {
+	fr.flushes = append(fr.flushes, fr.String())
+}
+
+func TestStreamLayout(tst *testing.T) {
+	Within(tst, func(test *Test) {
+		tmpl := parseSet(test, map[string]string{
+			"layout": `<head>{{ yield "title" }}</head><body>{{ yield }}</body>{{ exec_block "footer" }}<p>default</p>{{ end_block }}`,
+			"main":   `{{ define_block "title" }}<title>T</title>{{ end_block }}<h1>{{ . }}</h1>`,
+		})
+
+		c := NewContext("hi")
+		c.Main = "main"
+		c.Layout = "layout"
+		b := bytes.Buffer{}
+		test.NoError(tmpl.ExecuteContext(&b, c))
+
+		c = NewContext("hi")
+		c.Main = "main"
+		c.Layout = "layout"
+		c.Stream = true
+		fr := &flushRecorder{}
+		test.NoError(tmpl.ExecuteContext(fr, c))
+
+		test.AreEqual(b.String(), fr.String())
+		test.AreEqual(
+			"<head><title>T</title></head><body><h1>hi</h1></body><p>default</p>",
+			fr.String(),
+		)
+		test.IsNotNil(fr.flushes)
+		test.AreEqual("<head>", fr.flushes[0])
+	})
+}
+
+func TestStreamHeldBlock(tst *testing.T) {
+	Within(tst, func(test *Test) {
+		tmpl := parseSet(test, map[string]string{
+			"layout":   `<head>{{ yield "title" }}</head><body>{{ yield }}</body>{{ exec_block "footer" }}<p>default</p>{{ end_block }}`,
+			"override": `{{ define_block "footer" }}<p>custom</p>{{ end_block }}M`,
+		})
+
+		c := NewContext(nil)
+		c.Main = "override"
+		c.Layout = "layout"
+		c.Stream = true
+		fr := &flushRecorder{}
+		test.NoError(tmpl.ExecuteContext(fr, c))
+		test.AreEqual("<head></head><body>M</body><p>custom</p>", fr.String())
+	})
+}
+
+func TestExecSentinel(tst *testing.T) {
+	Within(tst, func(test *Test) {
+		tmpl := parseSet(test, map[string]string{
+			"partial":  `<i>{{ . }}</i>`,
+			"use_exec": `<b>{{ exec "partial" "x" }}</b>`,
+		})
+
+		b := bytes.Buffer{}
+		test.NoError(tmpl.ExecuteTemplate(&b, "use_exec", nil))
+		test.AreEqual("<b><i>x</i></b>", b.String())
+	})
+}
@@ -7,6 +7,8 @@ import (
 	"io/ioutil"
 	"path/filepath"
 	"strings"
+	"sync"
+	textTmpl "text/template"
 	"text/template/parse"
 )
 
@@ -14,17 +16,85 @@ import (
 // correspond to it.
 var Parsers = make(map[string]Parser)
 
-// The interface you must have to implement a Parser
+// The interface you must have to implement a Parser. Errors returned from
+// ParseTemplate should be an *Error made with NewError, and trees that
+// don't come straight from text/template should be made with NewTree.
 type Parser interface {
 	ParseTemplate(name, src string, funcs template.FuncMap) (map[string]*parse.Tree, error)
 	String() string
 }
 
+// A Template is a set of templates from any of the registered languages.
+// Once parsed, a Template may be executed from many goroutines at once;
+// parsing or adding functions must not happen while it is executing.
 type Template struct {
-	Tmpl  *template.Template
-	Base  string
-	ctx   *Context
-	funcs template.FuncMap
+	// Tmpl is the html/template set, unless the Template renders text
+	Tmpl *template.Template
+	// TextTmpl is the text/template set of a Template from NewText
+	TextTmpl *textTmpl.Template
+	Base     string
+	// Sandbox limits the templates of the set, it should be set before
+	// they are parsed
+	Sandbox *Sandbox
+	ctx     *Context
+	funcs   template.FuncMap
+	// context functions added to this set alone, see ContextFuncs
+	contextFuncs map[string]ContextFunc
+	pool         bindings
+	// gen is the generation of the pool a bound clone was made in
+	gen     int
+	sources map[string]source
+	// parsed has the sources in the order they were parsed, as the last
+	// definition of a template wins
+	parsed []source
+}
+
+// bindings holds clones of a template set whose context functions are
+// bound to one render at a time. Renders borrow a clone and return it
+// when they finish, so the set is only cloned when every existing clone
+// is busy, instead of once per request.
+type bindings struct {
+	mu   sync.Mutex
+	free []*Template
+	// gen counts the resets, clones bound before the last one aren't
+	// returned to the pool
+	gen int
+}
+
+func (b *bindings) get() *Template {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.free) == 0 {
+		return nil
+	}
+	tt := b.free[len(b.free)-1]
+	b.free = b.free[:len(b.free)-1]
+	return tt
+}
+
+func (b *bindings) put(tt *Template) {
+	b.mu.Lock()
+	if tt.gen == b.gen {
+		b.free = append(b.free, tt)
+	}
+	b.mu.Unlock()
+}
+
+// generation returns the generation of clones bound from now on.
+func (b *bindings) generation() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.gen
+}
+
+// reset drops the pooled clones, it must be called whenever the
+// underlying template set or its functions change. Clones that are
+// borrowed at the time are dropped when they are released.
+func (b *bindings) reset() {
+	b.mu.Lock()
+	b.free = nil
+	b.gen++
+	b.mu.Unlock()
 }
 
 func Must(t *Template, err error) *Template {
@@ -35,7 +105,7 @@ func Must(t *Template, err error) *Template {
 }
 
 func New(name string) *Template {
-	t := &Template{Tmpl: template.New(name).Funcs(template.FuncMap{}), Base: name}
+	t := &Template{Tmpl: template.New(name).Funcs(template.FuncMap{}), Base: name, sources: map[string]source{}}
 	t.Funcs(baseFuncMap())
 	return t
 }
@@ -60,127 +130,278 @@ func ParseGlob(pattern string) (*Template, error) {
 
 func (t *Template) AddParseTree(name string, tree *parse.Tree) (*Template, error) {
 	var e error
-	t.Tmpl, e = t.Tmpl.AddParseTree(name, tree)
+	if t.TextTmpl != nil {
+		t.TextTmpl, e = t.TextTmpl.AddParseTree(name, tree)
+	} else {
+		t.Tmpl, e = t.Tmpl.AddParseTree(name, tree)
+	}
+	t.pool.reset()
 	return t, e
 }
 
 func (t *Template) Clone() (*Template, error) {
-	tmpl, err := t.Tmpl.Clone()
-	return &Template{tmpl, t.Base, nil, t.funcs}, err
+	funcs := template.FuncMap{}
+	for k, v := range t.funcs {
+		funcs[k] = v
+	}
+	sources := make(map[string]source, len(t.sources))
+	for k, v := range t.sources {
+		sources[k] = v
+	}
+	clone := &Template{Base: t.Base, Sandbox: t.Sandbox, funcs: funcs, contextFuncs: t.contextFuncs, sources: sources, parsed: t.parsed[:len(t.parsed):len(t.parsed)]}
+	var err error
+	if t.TextTmpl != nil {
+		// text/template shares the trees of clones, unlike html/template
+		clone.TextTmpl, err = t.TextTmpl.Clone()
+		if err == nil {
+			for _, tmpl := range clone.TextTmpl.Templates() {
+				if tmpl.Tree != nil {
+					tmpl.Tree = tmpl.Tree.Copy()
+				}
+			}
+		}
+	} else {
+		clone.Tmpl, err = t.Tmpl.Clone()
+	}
+	return clone, err
 }
 
+// Context returns a clone of the template set that is bound to ctx. The
+// Execute functions borrow bound clones from a pool instead, so you only
+// need this if you want to hold on to a bound template yourself.
 func (t *Template) Context(ctx *Context) (*Template, error) {
-	tmpl, err := t.Clone()
+	tmpl, err := t.bind()
 	if err != nil {
 		return nil, err
 	}
-	tmpl.ctx = ctx
-	ctx.tmpl = tmpl
-	if ctx.Yields == nil {
-		ctx.Yields = make(map[string]string)
+	ctx.attach(tmpl)
+	return tmpl, nil
+}
+
+// bind clones the template set and binds the context functions of the
+// clone to the clone itself, so each clone can serve one render at a time.
+func (t *Template) bind() (*Template, error) {
+	tmpl, err := t.Clone()
+	if err != nil {
+		return nil, err
 	}
-	if ctx.Blocks == nil {
-		ctx.Blocks = make(map[string]RenderedBlock)
+	checkpoints(tmpl)
+	tmpl.Funcs(generateFuncs(tmpl))
+	if t.Sandbox != nil {
+		tmpl.Funcs(t.Sandbox.deny(tmpl.funcs))
 	}
-	if ctx.output == nil {
-		ctx.output = newPouchWriter()
+	return tmpl, nil
+}
+
+// acquire borrows a bound clone from the pool, binding a new one if all
+// of the existing clones are in use, then attaches ctx to it.
+func (t *Template) acquire(ctx *Context) (*Template, error) {
+	tt := t.pool.get()
+	if tt == nil {
+		gen := t.pool.generation()
+		var err error
+		tt, err = t.bind()
+		if err != nil {
+			return nil, err
+		}
+		tt.gen = gen
 	}
+	ctx.attach(tt)
+	return tt, nil
+}
 
-	return tmpl.Funcs(generateFuncs(tmpl)), nil
+// release detaches the context from a bound clone and returns the clone
+// to the pool.
+func (t *Template) release(tt *Template) {
+	tt.ctx.tmpl = nil
+	tt.ctx = nil
+	t.pool.put(tt)
 }
 
 func (t *Template) Execute(w io.Writer, data interface{}) error {
-	var tt *Template
-	if t.ctx == nil {
-		tt, _ = t.Context(NewContext(data))
+	if t.ctx != nil {
+		e := t.run(t.ctx.output, "", data)
+		if e == nil {
+			return t.ctx.Close(w)
+		}
+		return t.execError(e)
 	}
 
-	e := tt.Tmpl.Execute(tt.ctx.output, data)
-	if e == nil {
-		return tt.ctx.Close(w)
+	tt, e := t.acquire(NewContext(data))
+	if e != nil {
+		return e
 	}
-	return e
+	defer t.release(tt)
+	tt.ctx.chain = []link{{MainStep, t.Name()}}
+	return tt.Execute(w, data)
 }
 
 func (t *Template) ExecuteContext(w io.Writer, ctx *Context) error {
+	if e := ctx.cancelled(); e != nil {
+		return e
+	}
 	ctx.executingLayout = false
-	tt, e := t.Context(ctx)
+	tt, e := t.acquire(ctx)
 	if e != nil {
 		return e
 	}
+	defer t.release(tt)
 
-	main := ctx.Main
-	if ctx.Layout != "" {
-		ctx.mainContent, e = tt.ctx.exec(ctx.Main, ctx.Dot)
-		if e != nil {
+	main := ctx.localized(ctx.Main)
+	layouts := ctx.layouts()
+	ctx.depth = len(layouts) + 1
+	ctx.chain = []link{{MainStep, main}}
+	if len(layouts) > 0 {
+		main = ctx.localized(layouts[len(layouts)-1])
+		ctx.chain = []link{{LayoutStep, main}}
+		// the outermost layout is traced around the whole render
+		defer ctx.trace(LayoutStep, main)()
+		if ctx.Stream {
+			ctx.mainPending = true
+		} else if e = ctx.renderInner(); e != nil {
 			return e
 		}
-		main = ctx.Layout
 		tt.ctx.executingLayout = true
 	}
+	if ctx.Stream {
+		ctx.output.Stream(w)
+	}
+	if len(layouts) == 0 {
+		defer ctx.trace(MainStep, main)()
+	}
 	return tt.ExecuteTemplate(w, main, ctx.Dot)
 }
 
 func (t *Template) ExecuteTemplate(w io.Writer, name string, data interface{}) error {
-	tt := t
-	if t.ctx == nil {
-		tt, _ = t.Context(NewContext(data))
+	if t.ctx != nil {
+		if e := t.run(t.ctx.output, name, data); e != nil {
+			return t.execError(e)
+		}
+		return t.ctx.Close(w)
 	}
 
-	if e := tt.Tmpl.ExecuteTemplate(tt.ctx.output, name, data); e != nil {
+	return t.executeTemplate(NewContext(data), w, name, data)
+}
+
+// executeTemplate renders the named template with a Context for it.
+func (t *Template) executeTemplate(ctx *Context, w io.Writer, name string, data interface{}) error {
+	tt, e := t.acquire(ctx)
+	if e != nil {
 		return e
 	}
-	return tt.ctx.Close(w)
+	defer t.release(tt)
+	ctx.chain = []link{{MainStep, name}}
+	return tt.ExecuteTemplate(w, name, data)
 }
 
 func (t *Template) Funcs(fm template.FuncMap) *Template {
 	if t.funcs == nil {
-		t.funcs = fm
+		t.funcs = template.FuncMap{}
+	}
+	for k, v := range fm {
+		t.funcs[k] = v
+	}
+	if t.TextTmpl != nil {
+		t.TextTmpl.Funcs(textTmpl.FuncMap(fm))
 	} else {
-		for k, v := range fm {
-			t.funcs[k] = v
-		}
+		t.Tmpl.Funcs(fm)
 	}
-	t.Tmpl.Funcs(fm)
+	t.pool.reset()
+	return t
+}
+
+// ContextFuncs adds functions that need the Context of the render to this
+// template set alone, unlike the ContextFuncs variable which every set
+// uses.
+func (t *Template) ContextFuncs(fm map[string]ContextFunc) *Template {
+	cf := map[string]ContextFunc{}
+	for k, v := range t.contextFuncs {
+		cf[k] = v
+	}
+	for k, v := range fm {
+		cf[k] = v
+	}
+	t.contextFuncs = cf
+	t.pool.reset()
 	return t
 }
 
 func (t *Template) Lookup(name string) *Template {
-	tmpl := t.Tmpl.Lookup(name)
-	if tmpl != nil {
-		return &Template{tmpl, t.Base, nil, t.funcs}
+	if !t.defined(name) {
+		return nil
 	}
-	return nil
+	lt := &Template{Base: t.Base, Sandbox: t.Sandbox, funcs: t.funcs, contextFuncs: t.contextFuncs, sources: t.sources, parsed: t.parsed}
+	if t.TextTmpl != nil {
+		lt.TextTmpl = t.TextTmpl.Lookup(name)
+	} else {
+		lt.Tmpl = t.Tmpl.Lookup(name)
+	}
+	return lt
 }
 
 func (t *Template) Name() string {
+	if t.TextTmpl != nil {
+		return t.TextTmpl.Name()
+	}
 	return t.Tmpl.Name()
 }
 
+// Parse parses src with the parser registered for the extension parser,
+// or the standard library parser if there isn't one. Errors from parsing
+// are returned as an *Error.
 func (t *Template) Parse(name, src, parser string) (*Template, error) {
-	p, ok := Parsers[parser]
+	return t.parse(name, source{src: src, parser: parser})
+}
+
+func (t *Template) parse(name string, s source) (*Template, error) {
+	trees, s, err := t.parseTrees(name, s)
+	if err != nil {
+		return nil, err
+	}
+	return t.addTrees(name, s, trees)
+}
+
+// parseTrees parses a source with the functions of t, without adding
+// the trees to t. The source is returned with the parser that was used.
+func (t *Template) parseTrees(name string, s source) (map[string]*parse.Tree, source, error) {
+	p, ok := Parsers[s.parser]
 	if !ok {
 		p = &defaultParser{}
+		s.parser = "tmpl"
 	}
 
 	t2, _ := t.Clone()
-	trees, err := p.ParseTemplate(name, src, t2.Funcs(generateFuncs(t)).funcs)
+	trees, err := p.ParseTemplate(name, s.src, t2.Funcs(generateFuncs(t)).funcs)
+	if err == nil {
+		err = t.Sandbox.check(s.src, trees)
+	}
 	if err != nil {
-		return nil, err
+		return nil, s, parseError(name, s, err)
+	}
+	return trees, s, nil
+}
+
+func (t *Template) addTrees(name string, s source, trees map[string]*parse.Tree) (*Template, error) {
+	s.name = name
+	if t.sources == nil {
+		t.sources = map[string]source{}
 	}
+	var err error
 	for n, tree := range trees {
-		// text/template/parse needs the text of the template to generate errors,
-		// but you can't set that without parsing, so make a fake parse run, then swap
-		// out the roots while no one's looking. Use 25 delimeters so it all gets parsed
-		// as text
-		ptt := parse.New(tree.Name)
-		ptt.Parse(src, "{{{{{{{{{{{{{{{{{{{{{{{{{{{{{{", "}}}}}}}}}}}}}}}}}}}}}}}}}}}}}}", map[string]*parse.Tree{})
-		ptt.Root = tree.Root
-		t, err = t.AddParseTree(n, ptt)
+		t, err = t.AddParseTree(n, tree)
 		if err != nil {
-			return nil, err
+			return nil, parseError(name, s, err)
 		}
+		t.sources[n] = s
 	}
+	t.sources[name] = s
+	for i, ps := range t.parsed {
+		if ps.name == name {
+			t.parsed = append(t.parsed[:i:i], t.parsed[i+1:]...)
+			break
+		}
+	}
+	t.parsed = append(t.parsed, s)
 	return t, nil
 }
 
@@ -191,7 +412,7 @@ func (t *Template) ParseFiles(filenames ...string) (*Template, error) {
 		if e != nil {
 			return t, e
 		}
-		t, e = t.Parse(n, string(b), p)
+		t, e = t.parse(n, source{file: f, src: string(b), parser: p})
 		if e != nil {
 			return t, e
 		}
@@ -218,18 +439,23 @@ func (t *Template) stripBase(filename string) (name, parser string) {
 	if filename[0] == '/' || filename[0] == '\\' {
 		name = filename[1:]
 	}
-	base, exts := extensions(name)
-	if len(exts) > 0 {
-		for _, ext := range exts {
-			if _, ok := Parsers[ext]; ok {
-				parser = ext
-			} else {
-				base = base + "." + ext
-			}
+	return templateName(name)
+}
+
+// templateName removes the extension of the parser for a file from its
+// path, so "app/index.html.bham" is named "app/index.html" and parsed
+// with bham.
+func templateName(path string) (name, parser string) {
+	base, exts := extensions(path)
+	// extensions are listed from the last one back
+	for i := len(exts) - 1; i >= 0; i-- {
+		if _, ok := Parsers[exts[i]]; ok {
+			parser = exts[i]
+		} else {
+			base = base + "." + exts[i]
 		}
 	}
-	name = base
-	return
+	return base, parser
 }
 
 func extensions(filename string) (string, []string) {
@@ -246,10 +472,18 @@ func extensions(filename string) (string, []string) {
 }
 
 func (t *Template) Templates() []*Template {
+	if t.TextTmpl != nil {
+		tmpls := t.TextTmpl.Templates()
+		ret := make([]*Template, len(tmpls))
+		for i, tmpl := range tmpls {
+			ret[i] = &Template{TextTmpl: tmpl, Base: t.Base, Sandbox: t.Sandbox, funcs: t.funcs, contextFuncs: t.contextFuncs, sources: t.sources, parsed: t.parsed}
+		}
+		return ret
+	}
 	tmpls := t.Tmpl.Templates()
 	ret := make([]*Template, len(tmpls))
 	for i, tmpl := range tmpls {
-		ret[i] = &Template{tmpl, t.Base, nil, t.funcs}
+		ret[i] = &Template{Tmpl: tmpl, Base: t.Base, Sandbox: t.Sandbox, funcs: t.funcs, contextFuncs: t.contextFuncs, sources: t.sources, parsed: t.parsed}
 	}
 	return ret
 }
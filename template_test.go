@@ -19,6 +19,18 @@ func TestTemplate(tst *testing.T) {
 	})
 }
 
+// parseSet parses templates into one set, for tests that need more than
+// one template.
+func parseSet(test *Test, templates map[string]string) *Template {
+	t := New("test")
+	for name, src := range templates {
+		var e error
+		t, e = t.Parse(name, src, "tmpl")
+		test.NoError(e)
+	}
+	return t
+}
+
 type templateTest struct {
 	Expected string
 	Cases    map[string]string
@@ -92,3 +104,20 @@ func TestDefineBlock2(tst *testing.T) {
 
 	})
 }
+
+func TestClone(tst *testing.T) {
+	Within(tst, func(test *Test) {
+		t, e := New("view.html").Parse("view.html", `<b>{{ . }}</b>`, "stdlib")
+		test.NoError(e)
+		clone, e := t.Clone()
+		test.NoError(e)
+		_, e = clone.Parse("other.html", `<i>{{ . }}</i>`, "stdlib")
+		test.NoError(e)
+
+		_, ok := clone.sources["other.html"]
+		test.AreEqual(true, ok)
+		_, ok = t.sources["other.html"]
+		test.AreEqual(false, ok)
+		test.IsNil(t.Lookup("other.html"))
+	})
+}
@@ -4,37 +4,29 @@ import (
 	"html/template"
 	"strings"
 	"text/template/parse"
+
+	"github.com/acsellers/multitemplate"
 )
 
-func compile(name string, funcs template.FuncMap, tt tokenTree) (map[string]*parse.Tree, error) {
+func compile(name, src string, funcs template.FuncMap, tt tokenTree) (map[string]*parse.Tree, error) {
 	if tt.err != nil {
 		return map[string]*parse.Tree{}, tt.err
 	}
 
-	r := &resources{funcs: funcs, tt: &tt}
+	r := &resources{funcs: funcs, tt: &tt, src: src}
 	setResources(tt.roots, r)
 
-	tmpls := map[string]*parse.Tree{
-		name: &parse.Tree{
-			Name: name,
-			Root: &parse.ListNode{
-				NodeType: parse.NodeList,
-				Pos:      parse.Pos(0),
-				Nodes:    compileTokens(tt.roots, ""),
-			},
-		},
-	}
+	tree := multitemplate.NewTree(name, src)
+	tree.Root.Nodes = compileTokens(tt.roots, "")
+	tmpls := map[string]*parse.Tree{name: tree}
 
 	for _, def := range tt.defs {
 		tn := strings.TrimSpace(def.Content)
-		tmpls[tn] = &parse.Tree{
-			Name: tn,
-			Root: &parse.ListNode{
-				NodeType: parse.NodeList,
-				Pos:      parse.Pos(def.Pos),
-				Nodes:    compileTokens(def.Children, ""),
-			},
-		}
+		tree := multitemplate.NewTree(tn, src)
+		tree.ParseName = name
+		tree.Root.Pos = parse.Pos(def.Pos)
+		tree.Root.Nodes = compileTokens(def.Children, "")
+		tmpls[tn] = tree
 	}
 
 	return tmpls, r.err
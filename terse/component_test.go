@@ -0,0 +1,30 @@
+package terse
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/acsellers/multitemplate"
+)
+
+func TestComponent(t *testing.T) {
+	tmpl := multitemplate.New("terse")
+	var e error
+	for tn, tc := range map[string]string{
+		"card": ".card\n  ? has_slot \"header\"\n    = yield_slot \"header\"\n  = yield_slot\n  = .Title",
+		"main": "+card (locals \"Title\" \"Hi\")\n  +:header\n    h2 Head\n  p Body\n+card .\n  p Plain",
+	} {
+		if tmpl, e = tmpl.Parse(tn, tc, "terse"); e != nil {
+			t.Fatal("Parse Error:", e)
+		}
+	}
+
+	b := &bytes.Buffer{}
+	if e = tmpl.ExecuteTemplate(b, "main", map[string]string{"Title": "Bye"}); e != nil {
+		t.Fatal("Execute Error:", e)
+	}
+	expected := "<div class=\"card\"><h2>Head</h2>\n<p>\nBody\n</p>Hi</div><div class=\"card\">\n<p>\nPlain\n</p>Bye</div>"
+	if b.String() != expected {
+		t.Errorf("Result Error, Expected:`%s`\nReceived:`%s`", expected, b.String())
+	}
+}
@@ -0,0 +1,55 @@
+package terse
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/acsellers/multitemplate"
+)
+
+// TestDecompile renders each parse test from the decompiled source of its
+// templates, which should give the same output as the terse source.
+func TestDecompile(t *testing.T) {
+	for _, test := range parseTests {
+		sources := test.Sources
+		if len(sources) == 0 {
+			sources = map[string]string{"parse": test.Content}
+		}
+		tmpl := multitemplate.New("terse").Funcs(test.Funcs)
+		var e error
+		for tn, tc := range sources {
+			if tmpl, e = tmpl.Parse(tn, tc, "terse"); e != nil {
+				break
+			}
+		}
+		if e != nil {
+			continue
+		}
+
+		decompiled := multitemplate.New("terse").Funcs(test.Funcs)
+		for tn := range sources {
+			src, e := tmpl.Decompile(tn)
+			if e != nil {
+				t.Errorf("In test %s: %v", test.Name, e)
+				continue
+			}
+			if decompiled, e = decompiled.Parse(tn, src, "tmpl"); e != nil {
+				t.Errorf("In test %s, could not parse:\n%s\n%v", test.Name, src, e)
+			}
+		}
+		if t.Failed() {
+			continue
+		}
+
+		name := test.Template
+		if name == "" {
+			name = "parse"
+		}
+		expected, received := &bytes.Buffer{}, &bytes.Buffer{}
+		tmpl.ExecuteTemplate(expected, name, test.Data)
+		decompiled.ExecuteTemplate(received, name, test.Data)
+		if expected.String() != received.String() {
+			t.Errorf("In test %s, Expected:`%s`\nReceived:`%s`", test.Name, expected, received)
+		}
+	}
+}
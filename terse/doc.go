@@ -356,6 +356,25 @@ where name is the name you are using for that block or template.
     {{ yield "content" }}
   </div>
 
+Component Statements
+
+Components are called with a + followed by the name of the component
+template and the data for it, which is dot if it is left out. Slots
+are filled in by nested lines starting with +:, any other nested lines
+fill in the unnamed slot.
+
+  // Source
+  +cards/user.html .User
+    +:header
+      h2 Profile
+    p Details
+
+  // Output
+  {{ component "cards/user.html" .User }}
+    {{ slot "header" }}<h2>Profile</h2>{{ end_slot }}
+    <p>Details</p>
+  {{ end_component }}
+
 Extend Statements
 
 Extend statements (for inheriting from other templates) are written
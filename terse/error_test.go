@@ -1,6 +1,7 @@
 package terse
 
 import (
+	"bytes"
 	"strings"
 	"testing"
 
@@ -119,3 +120,28 @@ type errorTest struct {
 	Source   string
 	Contains string
 }
+
+func TestErrorPositions(t *testing.T) {
+	tmpl := multitemplate.New("terse")
+	_, e := tmpl.Parse("parse", "html\n  head\n  body name=(link_to", "terse")
+	me, ok := e.(*multitemplate.Error)
+	if !ok {
+		t.Fatal("Not a multitemplate.Error:", e)
+	}
+	if me.Parser != "terse" || me.Line != 3 || me.Excerpt != "  body name=(link_to" {
+		t.Error("Incorrect position for parse error:", me.Parser, me.Line, me.Excerpt)
+	}
+
+	tmpl, e = tmpl.Parse("exec", "html\n  body\n    = index .List 3", "terse")
+	if e != nil {
+		t.Fatal(e)
+	}
+	e = tmpl.ExecuteTemplate(&bytes.Buffer{}, "exec", map[string][]string{"List": {"a"}})
+	me, ok = e.(*multitemplate.Error)
+	if !ok {
+		t.Fatal("Not a multitemplate.Error:", e)
+	}
+	if me.Name != "exec" || me.Line != 3 || me.Excerpt != "    = index .List 3" {
+		t.Error("Incorrect position for execution error:", me.Name, me.Line, me.Excerpt)
+	}
+}
@@ -22,9 +22,12 @@ type multiStruct struct{}
 func (*multiStruct) ParseTemplate(name, src string, funcs template.FuncMap) (map[string]*parse.Tree, error) {
 	tt := tokenize(scan(src))
 	if tt.err != nil {
+		if le, ok := tt.err.(lineError); ok {
+			return map[string]*parse.Tree{}, multitemplate.NewError(src, le.pos, le.err)
+		}
 		return map[string]*parse.Tree{}, tt.err
 	}
-	return compile(name, funcs, tt)
+	return compile(name, src, funcs, tt)
 }
 func (*multiStruct) String() string {
 	return "terse: HTML Templating gone concise"
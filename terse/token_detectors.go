@@ -85,6 +85,14 @@ func execBlockCode(code string) bool {
 	return false
 }
 
+func componentCode(code string) bool {
+	return strippedPrefix(code, "+") && !slotCode(code)
+}
+
+func slotCode(code string) bool {
+	return strippedPrefix(code, "+:")
+}
+
 func extendCode(code string) bool {
 	return strippedPrefix(code, "@@")
 }
@@ -208,6 +208,55 @@ func execBlockToken(node *rawNode) (*token, error) {
 	return t, e
 }
 
+func componentToken(node *rawNode) (*token, error) {
+	code := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(node.Code), "+"))
+	name, args := code, "."
+	if i := strings.IndexAny(code, " \t"); i >= 0 {
+		name, args = code[:i], strings.TrimSpace(code[i:])
+	}
+
+	t := &token{Type: BlockToken, Pos: node.Pos}
+	t.Opening = []*token{
+		&token{
+			Type:    ExecToken,
+			Pos:     node.Pos,
+			Content: fmt.Sprintf("component \"%s\" %s", name, args),
+		},
+	}
+	var e error
+	t.Children, e = childTokenize(node)
+	t.Closing = []*token{
+		&token{
+			Type:    ExecToken,
+			Pos:     node.Pos,
+			Content: "end_component",
+		},
+	}
+	return t, e
+}
+
+func slotToken(node *rawNode) (*token, error) {
+	t := &token{Type: BlockToken, Pos: node.Pos}
+	slotName := firstTextToken(strings.TrimPrefix(strings.TrimSpace(node.Code), "+:"))
+	t.Opening = []*token{
+		&token{
+			Type:    ExecToken,
+			Pos:     node.Pos,
+			Content: fmt.Sprintf("slot \"%s\"", slotName),
+		},
+	}
+	var e error
+	t.Children, e = childTokenize(node)
+	t.Closing = []*token{
+		&token{
+			Type:    ExecToken,
+			Pos:     node.Pos,
+			Content: "end_slot",
+		},
+	}
+	return t, e
+}
+
 func extendToken(node *rawNode) (*token, error) {
 	parentName := strings.TrimSpace(strings.TrimPrefix(node.Code, "@@"))
 	return &token{
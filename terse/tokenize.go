@@ -6,6 +6,7 @@ func tokenize(rt rawTree) tokenTree {
 	for _, root := range rt.Children {
 		current, tt.err = codeTokenizer(root.Code)(root)
 		if tt.err != nil {
+			tt.err = atLine(root, tt.err)
 			return tt
 		}
 		tt.roots = append(tt.roots, current)
@@ -23,7 +24,7 @@ func childTokenize(node *rawNode) ([]*token, error) {
 	for _, child := range node.Children {
 		current, err := codeTokenizer(child.Code)(child)
 		if err != nil {
-			return []*token{}, err
+			return []*token{}, atLine(child, err)
 		}
 		tokens = append(tokens, current)
 	}
@@ -31,6 +32,26 @@ func childTokenize(node *rawNode) ([]*token, error) {
 	return tokens, nil
 }
 
+// A lineError is an error from tokenizing a line, along with the position
+// of the line in the source.
+type lineError struct {
+	pos int
+	err error
+}
+
+func (le lineError) Error() string {
+	return le.err.Error()
+}
+
+// atLine attaches the position of node to err, unless a line nested in
+// node already caused it.
+func atLine(node *rawNode, err error) error {
+	if _, ok := err.(lineError); ok {
+		return err
+	}
+	return lineError{node.Pos, err}
+}
+
 func codeTokenizer(code string) func(*rawNode) (*token, error) {
 	switch {
 	case doctypeCode(code):
@@ -53,6 +74,10 @@ func codeTokenizer(code string) func(*rawNode) (*token, error) {
 		return defineBlockToken
 	case execBlockCode(code):
 		return execBlockToken
+	case slotCode(code):
+		return slotToken
+	case componentCode(code):
+		return componentToken
 	case extendCode(code):
 		return extendToken
 	case yieldCode(code):
@@ -6,6 +6,8 @@ import (
 	"strings"
 	"text/template"
 	"text/template/parse"
+
+	"github.com/acsellers/multitemplate"
 )
 
 type resources struct {
@@ -13,6 +15,12 @@ type resources struct {
 	tt    *tokenTree
 	vars  []string
 	err   error
+	src   string
+}
+
+// errorAt locates err at pos in the source being compiled.
+func (rsc *resources) errorAt(pos int, err error) error {
+	return multitemplate.NewError(rsc.src, pos, err)
 }
 
 func (rsc *resources) Prelude() string {
@@ -65,7 +73,7 @@ func actionNode(code string, rsc *resources, pos int) (*parse.ActionNode, error)
 	t := template.New("mule").Funcs(template.FuncMap(rsc.funcs)).Delims(LeftDelim, RightDelim)
 	t, err := t.Parse(rsc.Prelude() + surround(code))
 	if err != nil {
-		return nil, err
+		return nil, rsc.errorAt(pos, err)
 	}
 
 	ln := t.Tree.Root.Nodes[len(t.Tree.Root.Nodes)-1]
@@ -82,48 +90,25 @@ func actionNode(code string, rsc *resources, pos int) (*parse.ActionNode, error)
 				rsc.vars = append(rsc.vars, vs)
 			}
 		}
-		normalize(an, pos)
-		return an, nil
-	}
-	return nil, fmt.Errorf("Node could not be parsed: %s", code)
-}
-
-func normalize(an *parse.ActionNode, pos int) {
-	drop := int(an.Pos)
-	an.Pos = parse.Pos(pos)
-	an.Pipe.Pos = parse.Pos(int(an.Pipe.Pos) - drop + pos)
-	for _, decl := range an.Pipe.Decl {
-		decl.Pos = parse.Pos(int(decl.Pos) - drop + pos)
-	}
-	for _, cmd := range an.Pipe.Cmds {
-		cmd.Pos = parse.Pos(int(cmd.Pos) - drop + pos)
+		return multitemplate.Relocate(an, pos).(*parse.ActionNode), nil
 	}
+	return nil, rsc.errorAt(pos, fmt.Errorf("Node could not be parsed: %s", code))
 }
 
 func textNodes(text string, rsc *resources, pos int) []parse.Node {
 	t := template.New("mule").Funcs(template.FuncMap(rsc.funcs)).Delims(LeftDelim, RightDelim)
 	t, err := t.Parse(rsc.Prelude() + text)
 	if err != nil {
-		rsc.err = err
+		rsc.err = rsc.errorAt(pos, err)
 		return nil
 	}
 
 	ln := t.Tree.Root.Nodes[len(rsc.vars):]
 	drop := int(ln[0].Position())
-	for _, n := range ln {
-		setPos(n, int(n.Position())-drop+pos)
-		rsc.UpdateVars(n)
-	}
-	return ln
-}
-
-func setPos(n parse.Node, pos int) {
-	switch an := n.(type) {
-	case *parse.ActionNode:
-		an.Pos = parse.Pos(pos)
-	case *parse.TextNode:
-		an.Pos = parse.Pos(pos)
-	case *parse.TemplateNode:
-		an.Pos = parse.Pos(pos)
+	nodes := make([]parse.Node, len(ln))
+	for i, n := range ln {
+		nodes[i] = multitemplate.Relocate(n, int(n.Position())-drop+pos)
+		rsc.UpdateVars(nodes[i])
 	}
+	return nodes
 }
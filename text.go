@@ -0,0 +1,108 @@
+package multitemplate
+
+import (
+	"io"
+	textTmpl "text/template"
+	"text/template/parse"
+)
+
+// NewText returns a Template that renders plain text with text/template,
+// for emails, CSV exports and config files that shouldn't be HTML
+// escaped. It is used just like a Template from New, with the same
+// parsers, layouts, yields and blocks, but nothing is escaped and the
+// content of blocks can be output anywhere.
+func NewText(name string) *Template {
+	t := &Template{TextTmpl: textTmpl.New(name).Funcs(textTmpl.FuncMap{}), Base: name, sources: map[string]source{}}
+	t.Funcs(baseFuncMap())
+	return t
+}
+
+// IsText reports whether t renders plain text, instead of HTML.
+func (t *Template) IsText() bool {
+	return t.TextTmpl != nil
+}
+
+// AsText returns a plain text copy of t, with the same templates and
+// functions, so the same templates can be rendered as HTML and as text.
+// Templates parsed from source are parsed again, in the order they were
+// parsed, others are copied, so those should be added before t is
+// executed, as that escapes them.
+func (t *Template) AsText() (*Template, error) {
+	tt := NewText(t.Name())
+	tt.Base, tt.Sandbox = t.Base, t.Sandbox
+	tt.Funcs(t.funcs)
+	tt.ContextFuncs(t.contextFuncs)
+
+	var err error
+	for _, s := range t.parsed {
+		if tt, err = tt.parse(s.name, s); err != nil {
+			return nil, err
+		}
+	}
+	t.eachTemplate(func(name string, tree *parse.Tree) {
+		if _, ok := t.sources[name]; !ok && err == nil {
+			_, err = tt.AddParseTree(name, tree.Copy())
+		}
+	})
+	return tt, err
+}
+
+// defined reports whether the set has a template with the name.
+func (t *Template) defined(name string) bool {
+	if t.TextTmpl != nil {
+		return t.TextTmpl.Lookup(name) != nil
+	}
+	return t.Tmpl.Lookup(name) != nil
+}
+
+// lookupTree returns the parse tree of the named template, or nil.
+func (t *Template) lookupTree(name string) *parse.Tree {
+	if t.TextTmpl != nil {
+		if tmpl := t.TextTmpl.Lookup(name); tmpl != nil {
+			return tmpl.Tree
+		}
+	} else if tmpl := t.Tmpl.Lookup(name); tmpl != nil {
+		return tmpl.Tree
+	}
+	return nil
+}
+
+// eachTemplate calls fn with each template of the set that has a tree.
+func (t *Template) eachTemplate(fn func(name string, tree *parse.Tree)) {
+	if t.TextTmpl != nil {
+		for _, tmpl := range t.TextTmpl.Templates() {
+			if tmpl.Tree != nil {
+				fn(tmpl.Name(), tmpl.Tree)
+			}
+		}
+		return
+	}
+	for _, tmpl := range t.Tmpl.Templates() {
+		if tmpl.Tree != nil {
+			fn(tmpl.Name(), tmpl.Tree)
+		}
+	}
+}
+
+// run executes the named template of the set, or t itself if name is
+// empty, without a Context.
+func (t *Template) run(w io.Writer, name string, data interface{}) error {
+	switch {
+	case t.TextTmpl != nil && name == "":
+		return t.TextTmpl.Execute(w, data)
+	case t.TextTmpl != nil:
+		return t.TextTmpl.ExecuteTemplate(w, name, data)
+	case name == "":
+		return t.Tmpl.Execute(w, data)
+	}
+	return t.Tmpl.ExecuteTemplate(w, name, data)
+}
+
+// rendered is the Ruleset of content rendered by templates, text isn't
+// escaped so it can be output anywhere.
+func (c *Context) rendered() Ruleset {
+	if c.tmpl != nil && c.tmpl.IsText() {
+		return User
+	}
+	return HTML
+}
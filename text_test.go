@@ -0,0 +1,92 @@
+package multitemplate
+
+import (
+	"bytes"
+	"testing"
+
+	. "github.com/acsellers/assert"
+)
+
+func TestTextTemplate(t *testing.T) {
+	Within(t, func(test *Test) {
+		tmpl := NewText("text")
+		test.AreEqual(true, tmpl.IsText())
+		for name, src := range map[string]string{
+			"email":     `{{ define_block "subject" }}Order for {{ .Name }}{{ end_block }}Your order: {{ .Item }}{{ content_for "footer" "signature" }}`,
+			"signature": `-- {{ .Shop }}`,
+			"layout":    "Subject: {{ yield \"subject\" }}\n\n{{ yield }}\n{{ yield \"footer\" }}\n<script>var s = \"{{ yield \"subject\" }}\";</script>",
+			"row":       `{{ extend "csv" }}{{ define_block "row" }}{{ .Name }},{{ .Item }}{{ end_block }}`,
+			"csv":       "name,item\n{{ exec_block \"row\" }}{{ end_block }}",
+		} {
+			var e error
+			tmpl, e = tmpl.Parse(name, src, "tmpl")
+			test.NoError(e)
+		}
+
+		data := map[string]string{"Name": "Tom & <Jerry>", "Item": `"Cheese"`, "Shop": "Mouse's"}
+		c := NewContext(data)
+		c.Main = "email"
+		c.Layout = "layout"
+		b := bytes.Buffer{}
+		test.NoError(tmpl.ExecuteContext(&b, c))
+		test.AreEqual("Subject: Order for Tom & <Jerry>\n\nYour order: \"Cheese\"\n-- Mouse's\n<script>var s = \"Order for Tom & <Jerry>\";</script>", b.String())
+
+		b.Reset()
+		test.NoError(tmpl.ExecuteTemplate(&b, "row", data))
+		test.AreEqual("name,item\nTom & <Jerry>,\"Cheese\"", b.String())
+	})
+}
+
+func TestAsText(t *testing.T) {
+	Within(t, func(test *Test) {
+		tmpl, e := New("page").Parse("page", `<p>{{ yield "greeting" }} {{ . }}</p>`, "tmpl")
+		test.NoError(e)
+		tmpl, e = tmpl.Parse("greeting", `Hi & welcome`, "tmpl")
+		test.NoError(e)
+		text, e := tmpl.AsText()
+		test.NoError(e)
+		test.AreEqual(false, tmpl.IsText())
+		test.AreEqual(true, text.IsText())
+
+		for _, tt := range []struct {
+			Tmpl     *Template
+			Expected string
+		}{
+			{tmpl, `<p>Hi & welcome Tom &amp; Jerry</p>`},
+			{text, `<p>Hi & welcome Tom & Jerry</p>`},
+		} {
+			c := NewContext("Tom & Jerry")
+			c.Main = "page"
+			c.Yields["greeting"] = "greeting"
+			b := bytes.Buffer{}
+			test.NoError(tt.Tmpl.ExecuteContext(&b, c))
+			test.AreEqual(tt.Expected, b.String())
+		}
+	})
+}
+
+func TestAsTextOrder(t *testing.T) {
+	Within(t, func(test *Test) {
+		tmpl := New("order")
+		for _, name := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+			var e error
+			tmpl, e = tmpl.Parse(name, `{{ define "shared" }}`+name+`{{ end }}`, "tmpl")
+			test.NoError(e)
+		}
+		// parsing a again makes it the last definition of shared
+		tmpl, e := tmpl.Parse("a", `{{ define "shared" }}A{{ end }}`, "tmpl")
+		test.NoError(e)
+
+		// the text copy keeps the definition that won in the HTML set
+		for i := 0; i < 10; i++ {
+			text, e := tmpl.AsText()
+			test.NoError(e)
+			b := bytes.Buffer{}
+			test.NoError(text.ExecuteTemplate(&b, "shared", nil))
+			test.AreEqual("A", b.String())
+		}
+		b := bytes.Buffer{}
+		test.NoError(tmpl.ExecuteTemplate(&b, "shared", nil))
+		test.AreEqual("A", b.String())
+	})
+}
@@ -0,0 +1,157 @@
+package multitemplate
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"runtime/trace"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A Step is a part of a render that is traced.
+type Step string
+
+const (
+	// MainStep is the main template of a Context
+	MainStep Step = "main"
+	// LayoutStep is a layout, the outermost layout contains the rest
+	LayoutStep Step = "layout"
+	// YieldStep is a call to yield with the name of a template or block
+	YieldStep Step = "yield"
+	// ExecStep is a template executed by exec, a partial, a component, or
+	// a template set for a yield
+	ExecStep Step = "exec"
+	// BlockStep is a block, from its block or exec_block to its end_block
+	BlockStep Step = "block"
+	// ExtendStep is a template extended by another
+	ExtendStep Step = "extend"
+)
+
+// A TraceEvent is sent to a Tracer when a step starts and ends.
+type TraceEvent struct {
+	Step Step
+	// Name is the name of the template, or the name of the yield or block
+	Name  string
+	Start time.Time
+	// Duration is only set when the step ends
+	Duration time.Duration
+}
+
+// A Tracer is told about each step of rendering a Context, so slow
+// templates can be found. Steps are nested, each step ends before the
+// step it started in.
+type Tracer interface {
+	Start(ev TraceEvent)
+	End(ev TraceEvent)
+}
+
+// trace starts a step, the returned function ends it.
+func (c *Context) trace(step Step, name string) func() {
+	if c.Tracer == nil {
+		return func() {}
+	}
+	ev := TraceEvent{Step: step, Name: name, Start: time.Now()}
+	c.Tracer.Start(ev)
+	return func() {
+		ev.Duration = time.Since(ev.Start)
+		c.Tracer.End(ev)
+	}
+}
+
+// A TraceTree collects the steps of renders into a tree, it can be shared
+// by renders in different goroutines, though their steps are only kept
+// apart if the renders don't overlap.
+type TraceTree struct {
+	Roots []*TraceNode
+
+	mu    sync.Mutex
+	stack []*TraceNode
+}
+
+// A TraceNode is a step, with the steps that were run inside it.
+type TraceNode struct {
+	TraceEvent
+	Children []*TraceNode
+}
+
+func (tt *TraceTree) Start(ev TraceEvent) {
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+	node := &TraceNode{TraceEvent: ev}
+	if len(tt.stack) == 0 {
+		tt.Roots = append(tt.Roots, node)
+	} else {
+		parent := tt.stack[len(tt.stack)-1]
+		parent.Children = append(parent.Children, node)
+	}
+	tt.stack = append(tt.stack, node)
+}
+
+func (tt *TraceTree) End(ev TraceEvent) {
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+	if len(tt.stack) == 0 {
+		return
+	}
+	tt.stack[len(tt.stack)-1].Duration = ev.Duration
+	tt.stack = tt.stack[:len(tt.stack)-1]
+}
+
+// WriteTo writes the tree with a line for each step, indented under the
+// step it ran in, with how long it took and its share of the render it
+// is part of.
+func (tt *TraceTree) WriteTo(w io.Writer) (int64, error) {
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+	var b strings.Builder
+	for _, root := range tt.Roots {
+		root.write(&b, 0, root.Duration)
+	}
+	n, e := io.WriteString(w, b.String())
+	return int64(n), e
+}
+
+func (tt *TraceTree) String() string {
+	var b strings.Builder
+	tt.WriteTo(&b)
+	return b.String()
+}
+
+func (tn *TraceNode) write(b *strings.Builder, depth int, total time.Duration) {
+	share := 100.0
+	if total > 0 {
+		share = float64(tn.Duration) / float64(total) * 100
+	}
+	fmt.Fprintf(b, "%s%s %s %v %.1f%%\n", strings.Repeat("  ", depth), tn.Step, tn.Name, tn.Duration, share)
+	for _, child := range tn.Children {
+		child.write(b, depth+1, total)
+	}
+}
+
+// A RuntimeTracer marks each step as a region for runtime/trace, so
+// renders show up in go tool trace. Like a Context, it should only be
+// used by one render at a time.
+type RuntimeTracer struct {
+	ctx     context.Context
+	regions []*trace.Region
+}
+
+// NewRuntimeTracer returns a RuntimeTracer that adds regions to the task
+// in ctx, if there is one.
+func NewRuntimeTracer(ctx context.Context) *RuntimeTracer {
+	return &RuntimeTracer{ctx: ctx}
+}
+
+func (rt *RuntimeTracer) Start(ev TraceEvent) {
+	rt.regions = append(rt.regions, trace.StartRegion(rt.ctx, string(ev.Step)+" "+ev.Name))
+}
+
+func (rt *RuntimeTracer) End(ev TraceEvent) {
+	if len(rt.regions) == 0 {
+		return
+	}
+	rt.regions[len(rt.regions)-1].End()
+	rt.regions = rt.regions[:len(rt.regions)-1]
+}
@@ -0,0 +1,128 @@
+package multitemplate
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	. "github.com/acsellers/assert"
+)
+
+// steps lists the steps of a trace tree without their timings.
+func steps(nodes []*TraceNode, depth int) string {
+	var s string
+	for _, n := range nodes {
+		s += strings.Repeat("  ", depth) + string(n.Step) + " " + n.Name + "\n"
+		s += steps(n.Children, depth+1)
+	}
+	return s
+}
+
+func TestTraceTree(t *testing.T) {
+	Within(t, func(test *Test) {
+		tmpl := New("trace")
+		for name, src := range map[string]string{
+			"page":   `{{ define_block "title" }}Users{{ end_block }}{{ content_for "side" "side" }}{{ exec "row" . }}`,
+			"row":    `<p>row</p>`,
+			"side":   `<aside>side</aside>`,
+			"layout": `<title>{{ exec_block "title" }}{{ end_block }}</title>{{ yield "side" }}{{ yield }}`,
+		} {
+			var e error
+			tmpl, e = tmpl.Parse(name, src, "tmpl")
+			test.NoError(e)
+		}
+
+		expected := `layout layout
+  main page
+    exec row
+  block title
+  yield side
+    exec side
+`
+		streamed := `layout layout
+  block title
+  yield side
+  main page
+    exec row
+  exec side
+`
+		for _, stream := range []bool{false, true} {
+			tree := &TraceTree{}
+			c := NewContext(nil)
+			c.Main = "page"
+			c.Layout = "layout"
+			c.Stream = stream
+			c.Tracer = tree
+			b := bytes.Buffer{}
+			test.NoError(tmpl.ExecuteContext(&b, c))
+			test.AreEqual(`<title>Users</title><aside>side</aside><p>row</p>`, b.String())
+			if stream {
+				// main is rendered at the yield for it, and held blocks after it
+				test.AreEqual(streamed, steps(tree.Roots, 0))
+			} else {
+				test.AreEqual(expected, steps(tree.Roots, 0))
+			}
+
+			lines := strings.Split(strings.TrimSpace(tree.String()), "\n")
+			test.AreEqual(true, strings.HasPrefix(lines[0], "layout layout "))
+			test.AreEqual(true, strings.HasSuffix(lines[0], " 100.0%"))
+		}
+	})
+}
+
+func TestTraceExtend(t *testing.T) {
+	Within(t, func(test *Test) {
+		tmpl := New("trace")
+		var e error
+		tmpl, e = tmpl.Parse("child", `{{ extend "parent" }}{{ define_block "content" }}child{{ end_block }}`, "tmpl")
+		test.NoError(e)
+		tmpl, e = tmpl.Parse("parent", `<div>{{ exec_block "content" }}parent{{ end_block }}</div>`, "tmpl")
+		test.NoError(e)
+
+		tree := &TraceTree{}
+		c := NewContext(nil)
+		c.Main = "child"
+		c.Tracer = NewRuntimeTracer(context.Background())
+		b := bytes.Buffer{}
+		test.NoError(tmpl.ExecuteContext(&b, c))
+		test.AreEqual(`<div>child</div>`, b.String())
+
+		c = NewContext(nil)
+		c.Main = "child"
+		c.Tracer = tree
+		b.Reset()
+		test.NoError(tmpl.ExecuteContext(&b, c))
+		test.AreEqual("main child\n  extend parent\n    block content\n", steps(tree.Roots, 0))
+	})
+}
+
+func TestTraceBlock(t *testing.T) {
+	Within(t, func(test *Test) {
+		tmpl := New("trace")
+		var e error
+		tmpl, e = tmpl.Parse("child", `{{ extend "parent" }}{{ define_block "content" }}child{{ end_block }}`, "tmpl")
+		test.NoError(e)
+		tmpl, e = tmpl.Parse("parent", `<div>{{ exec_block "content" }}{{ exec "row" . }}{{ end_block }}{{ exec_block "side" }}{{ exec "row" . }}{{ end_block }}</div>`, "tmpl")
+		test.NoError(e)
+		tmpl, e = tmpl.Parse("row", `<p>row</p>`, "tmpl")
+		test.NoError(e)
+
+		tree := &TraceTree{}
+		c := NewContext(nil)
+		c.Main = "child"
+		c.Tracer = tree
+		b := bytes.Buffer{}
+		test.NoError(tmpl.ExecuteContext(&b, c))
+		test.AreEqual(`<div>child<p>row</p></div>`, b.String())
+		// steps run in a block are nested under it, whether the block is
+		// replaced or output where it is
+		test.AreEqual(`main child
+  extend parent
+    block content
+      exec row
+    block side
+      exec row
+`, steps(tree.Roots, 0))
+	})
+}
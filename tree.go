@@ -0,0 +1,150 @@
+package multitemplate
+
+import (
+	"strings"
+	"text/template/parse"
+)
+
+// NewTree returns an empty parse tree for a template with the source src.
+// Parsers that build their nodes themselves should add them to its Root,
+// positioned at the byte offsets of src they came from, so errors while
+// executing them point at the right place in src.
+func NewTree(name, src string) *parse.Tree {
+	// parse.Tree only learns its source by parsing it, so parse src with a
+	// delimiter that doesn't appear in it, then throw away the text node
+	left := "{{"
+	for strings.Contains(src, left) {
+		left += "{"
+	}
+	tree := parse.New(name)
+	tree.Parse(src, left, "}}", map[string]*parse.Tree{})
+	tree.Root = &parse.ListNode{NodeType: parse.NodeList}
+	return tree
+}
+
+// Relocate returns a copy of n that is moved to the byte offset pos, with
+// its children keeping their positions relative to it. Nodes taken from
+// a tree text/template parsed for a snippet of a template need to be
+// relocated before they're added to a tree from NewTree, otherwise their
+// errors will point into the snippet.
+func Relocate(n parse.Node, pos int) parse.Node {
+	if n == nil {
+		return nil
+	}
+	return relocate(n, parse.Pos(pos)-n.Position())
+}
+
+func relocate(n parse.Node, shift parse.Pos) parse.Node {
+	switch n := n.(type) {
+	case *parse.ActionNode:
+		return &parse.ActionNode{NodeType: n.NodeType, Pos: moved(n.Pos, shift), Line: n.Line, Pipe: relocatePipe(n.Pipe, shift)}
+	case *parse.BoolNode:
+		return &parse.BoolNode{NodeType: n.NodeType, Pos: moved(n.Pos, shift), True: n.True}
+	case *parse.BreakNode:
+		return &parse.BreakNode{NodeType: n.NodeType, Pos: moved(n.Pos, shift), Line: n.Line}
+	case *parse.ChainNode:
+		return &parse.ChainNode{NodeType: n.NodeType, Pos: moved(n.Pos, shift), Node: relocate(n.Node, shift), Field: n.Field}
+	case *parse.CommandNode:
+		return relocateCommand(n, shift)
+	case *parse.CommentNode:
+		return &parse.CommentNode{NodeType: n.NodeType, Pos: moved(n.Pos, shift), Text: n.Text}
+	case *parse.ContinueNode:
+		return &parse.ContinueNode{NodeType: n.NodeType, Pos: moved(n.Pos, shift), Line: n.Line}
+	case *parse.DotNode:
+		return &parse.DotNode{NodeType: n.NodeType, Pos: moved(n.Pos, shift)}
+	case *parse.FieldNode:
+		return &parse.FieldNode{NodeType: n.NodeType, Pos: moved(n.Pos, shift), Ident: n.Ident}
+	case *parse.IdentifierNode:
+		return &parse.IdentifierNode{NodeType: n.NodeType, Pos: moved(n.Pos, shift), Ident: n.Ident}
+	case *parse.IfNode:
+		return &parse.IfNode{BranchNode: relocateBranch(n.BranchNode, shift)}
+	case *parse.ListNode:
+		return relocateList(n, shift)
+	case *parse.NilNode:
+		return &parse.NilNode{NodeType: n.NodeType, Pos: moved(n.Pos, shift)}
+	case *parse.NumberNode:
+		return &parse.NumberNode{
+			NodeType:   n.NodeType,
+			Pos:        moved(n.Pos, shift),
+			IsInt:      n.IsInt,
+			IsUint:     n.IsUint,
+			IsFloat:    n.IsFloat,
+			IsComplex:  n.IsComplex,
+			Int64:      n.Int64,
+			Uint64:     n.Uint64,
+			Float64:    n.Float64,
+			Complex128: n.Complex128,
+			Text:       n.Text,
+		}
+	case *parse.PipeNode:
+		return relocatePipe(n, shift)
+	case *parse.RangeNode:
+		return &parse.RangeNode{BranchNode: relocateBranch(n.BranchNode, shift)}
+	case *parse.StringNode:
+		return &parse.StringNode{NodeType: n.NodeType, Pos: moved(n.Pos, shift), Quoted: n.Quoted, Text: n.Text}
+	case *parse.TemplateNode:
+		return &parse.TemplateNode{NodeType: n.NodeType, Pos: moved(n.Pos, shift), Line: n.Line, Name: n.Name, Pipe: relocatePipe(n.Pipe, shift)}
+	case *parse.TextNode:
+		return &parse.TextNode{NodeType: n.NodeType, Pos: moved(n.Pos, shift), Text: n.Text}
+	case *parse.VariableNode:
+		return relocateVariable(n, shift)
+	case *parse.WithNode:
+		return &parse.WithNode{BranchNode: relocateBranch(n.BranchNode, shift)}
+	}
+	return n
+}
+
+func relocateList(n *parse.ListNode, shift parse.Pos) *parse.ListNode {
+	if n == nil {
+		return nil
+	}
+	ln := &parse.ListNode{NodeType: n.NodeType, Pos: moved(n.Pos, shift)}
+	for _, node := range n.Nodes {
+		ln.Nodes = append(ln.Nodes, relocate(node, shift))
+	}
+	return ln
+}
+
+func relocatePipe(n *parse.PipeNode, shift parse.Pos) *parse.PipeNode {
+	if n == nil {
+		return nil
+	}
+	pn := &parse.PipeNode{NodeType: n.NodeType, Pos: moved(n.Pos, shift), Line: n.Line, IsAssign: n.IsAssign}
+	for _, v := range n.Decl {
+		pn.Decl = append(pn.Decl, relocateVariable(v, shift))
+	}
+	for _, c := range n.Cmds {
+		pn.Cmds = append(pn.Cmds, relocateCommand(c, shift))
+	}
+	return pn
+}
+
+func relocateCommand(n *parse.CommandNode, shift parse.Pos) *parse.CommandNode {
+	cn := &parse.CommandNode{NodeType: n.NodeType, Pos: moved(n.Pos, shift)}
+	for _, arg := range n.Args {
+		cn.Args = append(cn.Args, relocate(arg, shift))
+	}
+	return cn
+}
+
+func relocateVariable(n *parse.VariableNode, shift parse.Pos) *parse.VariableNode {
+	return &parse.VariableNode{NodeType: n.NodeType, Pos: moved(n.Pos, shift), Ident: n.Ident}
+}
+
+func relocateBranch(n parse.BranchNode, shift parse.Pos) parse.BranchNode {
+	return parse.BranchNode{
+		NodeType: n.NodeType,
+		Pos:      moved(n.Pos, shift),
+		Line:     n.Line,
+		Pipe:     relocatePipe(n.Pipe, shift),
+		List:     relocateList(n.List, shift),
+		ElseList: relocateList(n.ElseList, shift),
+	}
+}
+
+func moved(p, shift parse.Pos) parse.Pos {
+	if p+shift < 0 {
+		return 0
+	}
+	return p + shift
+}
@@ -0,0 +1,421 @@
+package multitemplate
+
+import (
+	"fmt"
+	"reflect"
+	"text/template/parse"
+)
+
+// TypeCheck checks the named template against the type of the data it
+// will be executed with, so mistakes like {{ .User.Nmae }} are found
+// before the template is executed. Fields, methods, map values and calls
+// to functions are checked through with, range and variables, and the
+// templates run by exec, template, extend, component, render_partial,
+// render_collection and yield fallbacks are checked against the data
+// they would be given. Anything whose type can't be known, like an
+// interface{} value, is not checked. The problems are returned as a
+// *CheckError, in the same way as Check.
+func (t *Template) TypeCheck(name string, dot reflect.Type) error {
+	funcs := map[string]reflect.Type{}
+	for n, f := range generateFuncs(t) {
+		funcs[n] = reflect.TypeOf(f)
+	}
+	for n, f := range t.funcs {
+		funcs[n] = reflect.TypeOf(f)
+	}
+
+	tc := &typeChecker{t: t, root: dot, funcs: funcs, seen: map[typedTemplate]bool{}}
+	if !t.defined(name) {
+		return fmt.Errorf("multitemplate: no template named %q", name)
+	}
+	tc.template(name, dot)
+	if len(tc.errs) > 0 {
+		return &CheckError{Errors: tc.errs}
+	}
+	return nil
+}
+
+type typedTemplate struct {
+	name string
+	dot  reflect.Type
+}
+
+type typeChecker struct {
+	t     *Template
+	root  reflect.Type
+	funcs map[string]reflect.Type
+	seen  map[typedTemplate]bool
+	errs  []*Error
+
+	// the template being checked, and its variables
+	name string
+	vars []map[string]reflect.Type
+}
+
+var (
+	errorType = reflect.TypeOf((*error)(nil)).Elem()
+	stringT   = reflect.TypeOf("")
+	intT      = reflect.TypeOf(0)
+	boolT     = reflect.TypeOf(true)
+)
+
+// template checks a template when it is executed with dot, each template
+// is only checked once for each type.
+func (tc *typeChecker) template(name string, dot reflect.Type) {
+	tree := tc.t.lookupTree(name)
+	if tree == nil || tc.seen[typedTemplate{name, dot}] {
+		return
+	}
+	tc.seen[typedTemplate{name, dot}] = true
+
+	outer, outerVars := tc.name, tc.vars
+	tc.name = name
+	tc.vars = []map[string]reflect.Type{{"$": dot}}
+	tc.list(tree.Root, dot)
+	tc.name, tc.vars = outer, outerVars
+}
+
+func (tc *typeChecker) errorf(pos parse.Pos, format string, args ...interface{}) {
+	tc.errs = append(tc.errs, tc.t.errorAt(tc.name, pos, fmt.Errorf(format, args...)))
+}
+
+func (tc *typeChecker) list(n *parse.ListNode, dot reflect.Type) {
+	if n == nil {
+		return
+	}
+	for _, c := range n.Nodes {
+		tc.node(c, dot)
+	}
+}
+
+func (tc *typeChecker) node(n parse.Node, dot reflect.Type) {
+	switch n := n.(type) {
+	case *parse.ActionNode:
+		tc.pipe(n.Pipe, dot)
+	case *parse.IfNode:
+		tc.push()
+		tc.pipe(n.Pipe, dot)
+		tc.list(n.List, dot)
+		tc.list(n.ElseList, dot)
+		tc.pop()
+	case *parse.WithNode:
+		tc.push()
+		typ := tc.pipe(n.Pipe, dot)
+		tc.list(n.List, typ)
+		tc.list(n.ElseList, dot)
+		tc.pop()
+	case *parse.RangeNode:
+		tc.push()
+		key, elem := tc.rangeTypes(n.Pipe, dot)
+		switch len(n.Pipe.Decl) {
+		case 1:
+			tc.declare(n.Pipe.Decl[0], elem)
+		case 2:
+			tc.declare(n.Pipe.Decl[0], key)
+			tc.declare(n.Pipe.Decl[1], elem)
+		}
+		tc.list(n.List, elem)
+		tc.list(n.ElseList, dot)
+		tc.pop()
+	case *parse.TemplateNode:
+		var typ reflect.Type
+		if n.Pipe != nil {
+			typ = tc.pipe(n.Pipe, dot)
+		}
+		tc.template(n.Name, typ)
+	}
+}
+
+func (tc *typeChecker) push() {
+	tc.vars = append(tc.vars, map[string]reflect.Type{})
+}
+
+func (tc *typeChecker) pop() {
+	tc.vars = tc.vars[:len(tc.vars)-1]
+}
+
+func (tc *typeChecker) declare(v *parse.VariableNode, typ reflect.Type) {
+	tc.vars[len(tc.vars)-1][v.Ident[0]] = typ
+}
+
+func (tc *typeChecker) variable(name string) reflect.Type {
+	for i := len(tc.vars) - 1; i >= 0; i-- {
+		if typ, ok := tc.vars[i][name]; ok {
+			return typ
+		}
+	}
+	return nil
+}
+
+// rangeTypes returns the types of the keys and elements ranged over.
+func (tc *typeChecker) rangeTypes(pipe *parse.PipeNode, dot reflect.Type) (key, elem reflect.Type) {
+	// the declarations belong to the elements, not the pipeline
+	typ := indirect(tc.commands(pipe, dot))
+	if typ == nil {
+		return nil, nil
+	}
+	switch typ.Kind() {
+	case reflect.Slice, reflect.Array:
+		return intT, typ.Elem()
+	case reflect.Map:
+		return typ.Key(), typ.Elem()
+	case reflect.Chan:
+		return typ.Elem(), typ.Elem()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return typ, typ
+	case reflect.Func:
+		return nil, nil
+	}
+	tc.errorf(pipe.Position(), "range can't iterate over type %s", typ)
+	return nil, nil
+}
+
+// pipe checks a pipeline, declaring its variables, and returns the type
+// of its result.
+func (tc *typeChecker) pipe(pipe *parse.PipeNode, dot reflect.Type) reflect.Type {
+	typ := tc.commands(pipe, dot)
+	if pipe != nil && !pipe.IsAssign {
+		for _, v := range pipe.Decl {
+			tc.declare(v, typ)
+		}
+	}
+	return typ
+}
+
+// commands checks the commands of a pipeline and returns the type of the
+// last one.
+func (tc *typeChecker) commands(pipe *parse.PipeNode, dot reflect.Type) reflect.Type {
+	if pipe == nil {
+		return nil
+	}
+	var typ reflect.Type
+	for i, c := range pipe.Cmds {
+		typ = tc.command(c, dot, typ, i > 0)
+	}
+	return typ
+}
+
+// command checks a command, piped is set when the result of the previous
+// command is passed to it as its final argument.
+func (tc *typeChecker) command(c *parse.CommandNode, dot, prev reflect.Type, piped bool) reflect.Type {
+	args := len(c.Args) - 1
+	if piped {
+		args++
+	}
+	argTypes := make([]reflect.Type, 0, args)
+	for _, arg := range c.Args[1:] {
+		argTypes = append(argTypes, tc.arg(arg, dot))
+	}
+	if piped {
+		argTypes = append(argTypes, prev)
+	}
+
+	switch n := c.Args[0].(type) {
+	case *parse.IdentifierNode:
+		return tc.call(n, c.Args[1:], argTypes)
+	case *parse.FieldNode:
+		return tc.fields(n.Position(), dot, n.Ident, args)
+	case *parse.VariableNode:
+		return tc.fields(n.Position(), tc.variable(n.Ident[0]), n.Ident[1:], args)
+	case *parse.ChainNode:
+		return tc.fields(n.Position(), tc.arg(n.Node, dot), n.Field, args)
+	}
+	return tc.arg(c.Args[0], dot)
+}
+
+// arg returns the type of an argument.
+func (tc *typeChecker) arg(n parse.Node, dot reflect.Type) reflect.Type {
+	switch n := n.(type) {
+	case *parse.DotNode:
+		return dot
+	case *parse.FieldNode:
+		return tc.fields(n.Position(), dot, n.Ident, 0)
+	case *parse.VariableNode:
+		return tc.fields(n.Position(), tc.variable(n.Ident[0]), n.Ident[1:], 0)
+	case *parse.ChainNode:
+		return tc.fields(n.Position(), tc.arg(n.Node, dot), n.Field, 0)
+	case *parse.PipeNode:
+		return tc.pipe(n, dot)
+	case *parse.IdentifierNode:
+		return tc.call(n, nil, nil)
+	case *parse.StringNode:
+		return stringT
+	case *parse.BoolNode:
+		return boolT
+	case *parse.NumberNode:
+		if n.IsInt {
+			return intT
+		}
+	}
+	return nil
+}
+
+// call checks a call to a function, and returns the type of its result.
+func (tc *typeChecker) call(id *parse.IdentifierNode, args []parse.Node, argTypes []reflect.Type) reflect.Type {
+	switch id.Ident {
+	case "root_dot":
+		return tc.root
+	case "exec":
+		if len(args) == 2 {
+			if s, ok := args[0].(*parse.StringNode); ok {
+				tc.template(s.Text, argTypes[1])
+			}
+		}
+	case "render_partial", "component":
+		// locals turn the data into a map, so only partials without them
+		// can be checked
+		if len(args) == 2 {
+			if s, ok := args[0].(*parse.StringNode); ok {
+				tc.template(s.Text, argTypes[1])
+			}
+		}
+	case "render_collection":
+		if len(args) == 2 && argTypes[1] != nil {
+			if s, ok := args[0].(*parse.StringNode); ok {
+				if k := argTypes[1].Kind(); k == reflect.Slice || k == reflect.Array {
+					tc.template(s.Text, argTypes[1].Elem())
+				}
+			}
+		}
+	case "extend":
+		if len(args) == 1 {
+			if s, ok := args[0].(*parse.StringNode); ok {
+				tc.template(s.Text, tc.root)
+			}
+		}
+	case "yield":
+		tc.yield(args, argTypes)
+	}
+
+	ft, ok := tc.funcs[id.Ident]
+	if !ok || ft == nil {
+		if !ok && !builtinFuncs[id.Ident] {
+			tc.errorf(id.Position(), "function %q not defined", id.Ident)
+		}
+		return nil
+	}
+	tc.arity(id.Position(), id.Ident, ft, 0, len(argTypes))
+	if ft.NumOut() == 0 {
+		return nil
+	}
+	return ft.Out(0)
+}
+
+// yield checks the fallback template of a yield with the data it would
+// be given, which is the root data if no data is passed.
+func (tc *typeChecker) yield(args []parse.Node, argTypes []reflect.Type) {
+	var fallback string
+	data, hasData := tc.root, false
+	for i, arg := range args {
+		if i == 0 {
+			continue
+		}
+		if p, ok := arg.(*parse.PipeNode); ok && len(p.Cmds) == 1 && len(p.Cmds[0].Args) == 2 {
+			if id, ok := p.Cmds[0].Args[0].(*parse.IdentifierNode); ok && id.Ident == "fallback" {
+				if s, ok := p.Cmds[0].Args[1].(*parse.StringNode); ok {
+					fallback = s.Text
+				}
+				continue
+			}
+		}
+		if !hasData {
+			data, hasData = argTypes[i], true
+		}
+	}
+	if fallback != "" {
+		tc.template(fallback, data)
+	}
+}
+
+// arity checks that a function or method of type ft, that skip is the
+// number of receivers for, can be called with args arguments.
+func (tc *typeChecker) arity(pos parse.Pos, name string, ft reflect.Type, skip, args int) {
+	in := ft.NumIn() - skip
+	if ft.IsVariadic() {
+		if args < in-1 {
+			tc.errorf(pos, "wrong number of args for %s: want at least %d got %d", name, in-1, args)
+		}
+	} else if args != in {
+		tc.errorf(pos, "wrong number of args for %s: want %d got %d", name, in, args)
+	}
+	out := ft.NumOut()
+	if out == 0 || out > 2 || (out == 2 && ft.Out(1) != errorType) {
+		tc.errorf(pos, "can't call %s, it must return one value, or a value and an error", name)
+	}
+}
+
+// fields follows a chain of field names from a value of type typ, the last
+// one is called with args arguments if it is a method.
+func (tc *typeChecker) fields(pos parse.Pos, typ reflect.Type, idents []string, args int) reflect.Type {
+	for i, ident := range idents {
+		if typ == nil {
+			return nil
+		}
+		n := 0
+		if i == len(idents)-1 {
+			n = args
+		}
+
+		if m, ok := method(typ, ident); ok {
+			tc.arity(pos, ident, m.Type, 1, n)
+			if m.Type.NumOut() == 0 {
+				return nil
+			}
+			typ = m.Type.Out(0)
+			continue
+		}
+		if n > 0 {
+			tc.errorf(pos, "%s is not a method but has arguments", ident)
+		}
+
+		base := indirect(typ)
+		switch base.Kind() {
+		case reflect.Interface:
+			return nil
+		case reflect.Struct:
+			f, ok := base.FieldByName(ident)
+			if !ok {
+				tc.errorf(pos, "can't evaluate field %s in type %s", ident, typ)
+				return nil
+			}
+			if f.PkgPath != "" {
+				tc.errorf(pos, "%s is an unexported field of struct type %s", ident, typ)
+				return nil
+			}
+			typ = f.Type
+		case reflect.Map:
+			if base.Key().Kind() != reflect.String {
+				tc.errorf(pos, "can't evaluate field %s in type %s", ident, typ)
+				return nil
+			}
+			typ = base.Elem()
+		default:
+			tc.errorf(pos, "can't evaluate field %s in type %s", ident, typ)
+			return nil
+		}
+	}
+	return typ
+}
+
+// method finds a method on typ or a pointer to it, since text/template
+// will take the address of a value to call a pointer method.
+func method(typ reflect.Type, name string) (reflect.Method, bool) {
+	if typ.Kind() == reflect.Interface {
+		return reflect.Method{}, false
+	}
+	if m, ok := typ.MethodByName(name); ok {
+		return m, true
+	}
+	if typ.Kind() != reflect.Ptr {
+		return reflect.PtrTo(typ).MethodByName(name)
+	}
+	return reflect.Method{}, false
+}
+
+func indirect(typ reflect.Type) reflect.Type {
+	for typ != nil && typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	return typ
+}
@@ -0,0 +1,85 @@
+package multitemplate
+
+import (
+	"errors"
+	"html/template"
+	"reflect"
+	"strings"
+	"testing"
+
+	. "github.com/acsellers/assert"
+)
+
+type typedUser struct {
+	Name   string
+	Emails []string
+	Roles  map[string]typedRole
+	secret string
+}
+
+func (u *typedUser) Greeting(prefix string) string {
+	return prefix + u.Name
+}
+
+type typedRole struct {
+	Title string
+}
+
+type typedPage struct {
+	Title string
+	User  *typedUser
+	Users []typedUser
+	Extra interface{}
+}
+
+func typeCheckErrors(test *Test, e error) []string {
+	var ce *CheckError
+	if !errors.As(e, &ce) {
+		test.IsNotNil(ce)
+		return nil
+	}
+	msgs := make([]string, len(ce.Errors))
+	for i, err := range ce.Errors {
+		msgs[i] = err.Err.Error()
+	}
+	return msgs
+}
+
+func TestTypeCheck(t *testing.T) {
+	Within(t, func(test *Test) {
+		tmpl := New("typed").Funcs(template.FuncMap{"upper": strings.ToUpper})
+		var e error
+		tmpl, e = tmpl.Parse("layout", `<title>{{ .Title }}</title>{{ yield }}`, "tmpl")
+		test.NoError(e)
+		tmpl, e = tmpl.Parse("user", `<p>{{ .Name }}</p>`, "tmpl")
+		test.NoError(e)
+		tmpl, e = tmpl.Parse("good", `{{ extend "layout" }}
+{{ with .User }}{{ .Greeting "Hi " }}{{ range $i, $e := .Emails }}{{ $i }}{{ upper $e }}{{ end }}{{ end }}
+{{ range .Users }}{{ exec "user" . }}{{ .Roles.admin.Title }}{{ end }}
+{{ $u := .User }}{{ $u.Name | upper }}{{ .Extra.Anything }}{{ root_dot.Title }}
+{{ yield "side" .User (fallback "user") }}`, "tmpl")
+		test.NoError(e)
+		test.NoError(tmpl.TypeCheck("good", reflect.TypeOf(typedPage{})))
+
+		tmpl, e = tmpl.Parse("bad", "{{ .Titel }}\n{{ with .User }}{{ .Nmae }}{{ .Greeting }}{{ .secret }}{{ end }}\n{{ upper .Title .Title }}{{ range .Title }}{{ end }}{{ exec \"user\" .Users }}", "tmpl")
+		test.NoError(e)
+		e = tmpl.TypeCheck("bad", reflect.TypeOf(&typedPage{}))
+		test.AreEqual([]string{
+			"can't evaluate field Titel in type *multitemplate.typedPage",
+			"can't evaluate field Nmae in type *multitemplate.typedUser",
+			"wrong number of args for Greeting: want 1 got 0",
+			"secret is an unexported field of struct type *multitemplate.typedUser",
+			"wrong number of args for upper: want 1 got 2",
+			"range can't iterate over type string",
+			"can't evaluate field Name in type []multitemplate.typedUser",
+		}, typeCheckErrors(test, e))
+
+		var me *Error
+		test.AreEqual(true, errors.As(e, &me))
+		test.AreEqual("bad", me.Name)
+		test.AreEqual(1, me.Line)
+		test.AreEqual(4, me.Column)
+
+		test.IsError(tmpl.TypeCheck("missing", nil))
+	})
+}